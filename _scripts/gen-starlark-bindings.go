@@ -0,0 +1,463 @@
+// gen-starlark-bindings generates internal/starbind/starlark_mapping.go and
+// the table of API builtins in doc/starlark.md from the vendored delve
+// client in internal/dlvclient/service/rpc2.
+//
+// Usage:
+//
+//	go run _scripts/gen-starlark-bindings.go [-check]
+//
+// The script can also be run by go generate in internal/starbind.
+//
+// With -check the generated files are compared with the ones in the tree
+// and the script fails if they are stale.
+//
+// Every method called by RPCClient is mapped to a builtin. The
+// documentation of the builtins isn't available in the vendored client, it
+// is taken from the current starlark_mapping.go (where it was originally
+// copied from delve) and can be edited there.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	clientDir   = "internal/dlvclient/service/rpc2"
+	apiTypes    = "internal/dlvclient/service/api/types.go"
+	mappingPath = "internal/starbind/starlark_mapping.go"
+	docPath     = "doc/starlark.md"
+
+	beginTable = "<!-- BEGIN MAPPING TABLE -->"
+	endTable   = "<!-- END MAPPING TABLE -->"
+	apiRowMark = "Equivalent to API call"
+)
+
+// skipMethods are API calls made by RPCClient that should not be exposed to
+// starlark scripts.
+var skipMethods = map[string]string{
+	"GetEvents":     "events are consumed by the client",
+	"SetApiVersion": "not part of rpc2",
+}
+
+// ignoredFields are fields of the arguments of API calls that are accepted
+// by the builtins, so that the position of the following arguments does not
+// change, but are not passed to the API call.
+var ignoredFields = map[string]string{
+	"DebuggerCommand.WithEvents": "used internally to drain events",
+}
+
+// builtinNames overrides the name of the builtin for some API calls.
+var builtinNames = map[string]string{
+	"Command": "raw_command",
+	"Set":     "set_expr",
+}
+
+// returnTypes overrides the name of the return type for some API calls.
+var returnTypes = map[string]string{
+	"ExamineMemory": "ExaminedMemoryOut",
+}
+
+type binding struct {
+	method  string // name of the API call
+	name    string // name of the builtin
+	argType string
+	retType string
+	fields  []string
+}
+
+func must(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func parseFile(fset *token.FileSet, path string) *ast.File {
+	f, err := parser.ParseFile(fset, path, nil, 0)
+	must(err)
+	return f
+}
+
+// structFields returns the exported fields of all struct types declared in f.
+func structFields(f *ast.File) map[string][]string {
+	r := map[string][]string{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		spec, ok := n.(*ast.TypeSpec)
+		if !ok {
+			return true
+		}
+		st, ok := spec.Type.(*ast.StructType)
+		if !ok {
+			return false
+		}
+		fields := []string{}
+		for _, field := range st.Fields.List {
+			for _, name := range fieldNames(field) {
+				if name.IsExported() {
+					fields = append(fields, name.Name)
+				}
+			}
+		}
+		r[spec.Name.Name] = fields
+		return false
+	})
+	return r
+}
+
+// fieldNames returns the names of field, the name of an embedded field is
+// the name of its type.
+func fieldNames(field *ast.Field) []*ast.Ident {
+	if len(field.Names) > 0 {
+		return field.Names
+	}
+	typ := field.Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	switch typ := typ.(type) {
+	case *ast.Ident:
+		return []*ast.Ident{typ}
+	case *ast.SelectorExpr:
+		return []*ast.Ident{typ.Sel}
+	}
+	return nil
+}
+
+// fieldTypes returns the type of all fields of struct types declared in f,
+// indexed by "Type.Field".
+func fieldTypes(fset *token.FileSet, f *ast.File) map[string]string {
+	r := map[string]string{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		spec, ok := n.(*ast.TypeSpec)
+		if !ok {
+			return true
+		}
+		if st, ok := spec.Type.(*ast.StructType); ok {
+			for _, field := range st.Fields.List {
+				var buf bytes.Buffer
+				format.Node(&buf, fset, field.Type)
+				for _, name := range fieldNames(field) {
+					r[spec.Name.Name+"."+name.Name] = buf.String()
+				}
+			}
+		}
+		return false
+	})
+	return r
+}
+
+// calledMethods returns the names of all API calls made by RPCClient.
+func calledMethods(files []*ast.File) []string {
+	seen := map[string]bool{}
+	r := []string{}
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) == 0 {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || (sel.Sel.Name != "call" && sel.Sel.Name != "callWhileDrainingEvents") {
+				return true
+			}
+			lit, ok := call.Args[0].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			method, _ := strconv.Unquote(lit.Value)
+			if !seen[method] {
+				seen[method] = true
+				r = append(r, method)
+			}
+			return true
+		})
+	}
+	sort.Strings(r)
+	return r
+}
+
+// currentDocs returns the documentation strings of the builtins in the
+// current starlark_mapping.go.
+func currentDocs(fset *token.FileSet) map[string]string {
+	r := map[string]string{}
+	if _, err := os.Stat(mappingPath); err != nil {
+		return r
+	}
+	f := parseFile(fset, mappingPath)
+	ast.Inspect(f, func(n ast.Node) bool {
+		assign, ok := n.(*ast.AssignStmt)
+		if !ok || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+			return true
+		}
+		idx, ok := assign.Lhs[0].(*ast.IndexExpr)
+		if !ok {
+			return true
+		}
+		if id, ok := idx.X.(*ast.Ident); !ok || id.Name != "doc" {
+			return true
+		}
+		key, ok1 := idx.Index.(*ast.BasicLit)
+		val, ok2 := assign.Rhs[0].(*ast.BasicLit)
+		if !ok1 || !ok2 {
+			return true
+		}
+		name, _ := strconv.Unquote(key.Value)
+		docstr, _ := strconv.Unquote(val.Value)
+		r[name] = docstr
+		return true
+	})
+	return r
+}
+
+// snakeCase converts a method name to the name of a builtin.
+func snakeCase(name string) string {
+	if builtinName, ok := builtinNames[name]; ok {
+		return builtinName
+	}
+	if strings.HasPrefix(name, "List") {
+		name = name[len("List"):]
+	}
+	rs := []rune(name)
+	var buf strings.Builder
+	for i, ch := range rs {
+		if i > 0 && unicode.IsUpper(ch) && (unicode.IsLower(rs[i-1]) || (i+1 < len(rs) && unicode.IsLower(rs[i+1]))) {
+			buf.WriteByte('_')
+		}
+		buf.WriteRune(unicode.ToLower(ch))
+	}
+	return buf.String()
+}
+
+func bindings() []binding {
+	var fset token.FileSet
+	client := parseFile(&fset, filepath.Join(clientDir, "client.go"))
+	clientCustom := parseFile(&fset, filepath.Join(clientDir, "client_custom.go"))
+	server := parseFile(&fset, filepath.Join(clientDir, "server.go"))
+	api := parseFile(&fset, apiTypes)
+
+	serverFields := structFields(server)
+	apiFields := structFields(api)
+
+	r := []binding{}
+	for _, method := range calledMethods([]*ast.File{client, clientCustom}) {
+		if _, skip := skipMethods[method]; skip {
+			continue
+		}
+		retType := method + "Out"
+		if t, ok := returnTypes[method]; ok {
+			retType = t
+		}
+		b := binding{method: method, name: snakeCase(method), argType: "rpc2." + method + "In", retType: "rpc2." + retType}
+		var ok bool
+		if method == "Command" {
+			b.argType = "api.DebuggerCommand"
+			b.fields, ok = apiFields["DebuggerCommand"]
+		} else {
+			b.fields, ok = serverFields[method+"In"]
+		}
+		if _, hasRet := serverFields[retType]; !ok || !hasRet {
+			must(fmt.Errorf("argument or return type of %s not found in %s", method, filepath.Join(clientDir, "server.go")))
+		}
+		r = append(r, b)
+	}
+	return r
+}
+
+func genMapping(bindings []binding, docs map[string]string, types map[string]string) []byte {
+	var buf bytes.Buffer
+	p := func(format string, args ...interface{}) {
+		fmt.Fprintf(&buf, format, args...)
+		buf.WriteByte('\n')
+	}
+
+	p("// DO NOT EDIT: auto-generated using _scripts/gen-starlark-bindings.go")
+	p("package starbind")
+	p("import (")
+	p("\"fmt\"")
+	p("\"github.com/aarzilli/gdlv/internal/dlvclient/service/api\"")
+	p("\"github.com/aarzilli/gdlv/internal/dlvclient/service/rpc2\"")
+	p("\"go.starlark.net/starlark\"")
+	p(")")
+
+	p("func (env *Env) starlarkPredeclare() (starlark.StringDict, map[string]string) {")
+	p("r := starlark.StringDict{}")
+	p("doc := make(map[string]string)")
+	p("")
+
+	for _, b := range bindings {
+		argStruct := strings.TrimPrefix(strings.TrimPrefix(b.argType, "rpc2."), "api.")
+
+		p("r[%q] = starlark.NewBuiltin(%q, func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {", b.name, b.name)
+		p("if err := isCancelled(thread); err != nil {")
+		p("return starlark.None, decorateError(thread, err)")
+		p("}")
+		p("var rpcArgs %s", b.argType)
+		p("var rpcRet %s", b.retType)
+
+		for i, field := range b.fields {
+			if _, ignored := ignoredFields[argStruct+"."+field]; ignored {
+				continue
+			}
+			p("if len(args) > %d && args[%d] != starlark.None {", i, i)
+			p("err := unmarshalStarlarkValue(args[%d], &rpcArgs.%s, %q)", i, field, field)
+			p("if err != nil {")
+			p("return starlark.None, decorateError(thread, err)")
+			p("}")
+			switch typ := types[argStruct+"."+field]; {
+			case (field == "Scope" || field == "EvalScope") && typ == "api.EvalScope":
+				p("} else {")
+				p("rpcArgs.%s = env.scope(thread)", field)
+			case (field == "Scope" || field == "EvalScope") && typ == "*api.EvalScope":
+				p("} else {")
+				p("scope := env.scope(thread)")
+				p("rpcArgs.%s = &scope", field)
+			case (field == "Cfg" || field == "ReturnInfoLoadConfig") && b.method != "Stacktrace" && (typ == "api.LoadConfig" || typ == "LoadConfig"):
+				p("} else {")
+				p("rpcArgs.%s = env.ctx.LoadConfig()", field)
+			case (field == "Cfg" || field == "ReturnInfoLoadConfig") && b.method != "Stacktrace" && (typ == "*api.LoadConfig" || typ == "*LoadConfig"):
+				// a nil load configuration for Stacktrace means that variables should not be loaded
+				p("} else {")
+				p("cfg := env.ctx.LoadConfig()")
+				p("rpcArgs.%s = &cfg", field)
+			}
+			p("}")
+		}
+
+		if len(b.fields) > 0 {
+			p("for _, kv := range kwargs {")
+			p("var err error")
+			p("switch kv[0].(starlark.String) {")
+			for _, field := range b.fields {
+				if reason, ignored := ignoredFields[argStruct+"."+field]; ignored {
+					p("case %q: // ignored, %s", field, reason)
+					continue
+				}
+				p("case %q:", field)
+				p("err = unmarshalStarlarkValue(kv[1], &rpcArgs.%s, %q)", field, field)
+			}
+			p("default:")
+			p("err = fmt.Errorf(\"unknown argument %%q\", kv[0])")
+			p("}")
+			p("if err != nil {")
+			p("return starlark.None, decorateError(thread, err)")
+			p("}")
+			p("}")
+		}
+
+		p("err := env.ctx.Client().CallAPI(%q, &rpcArgs, &rpcRet)", b.method)
+		p("if err != nil {")
+		p("return starlark.None, err")
+		p("}")
+		p("return env.interfaceToStarlarkValue(&rpcRet), nil")
+		p("})")
+
+		docstr := docs[b.name]
+		if docstr == "" {
+			docstr = fmt.Sprintf("builtin %s(%s)", b.name, strings.Join(b.fields, ", "))
+		} else if idx := strings.Index(docstr, "\n\n"); idx >= 0 {
+			docstr = fmt.Sprintf("builtin %s(%s)", b.name, strings.Join(b.fields, ", ")) + docstr[idx:]
+		} else {
+			docstr = fmt.Sprintf("builtin %s(%s)", b.name, strings.Join(b.fields, ", "))
+		}
+		p("doc[%q] = %q", b.name, docstr)
+	}
+
+	p("return r, doc")
+	p("}")
+	p("")
+
+	p("// apiNames maps builtins defined in starlark_mapping.go to the name of the")
+	p("// corresponding RPCServer method.")
+	p("var apiNames = map[string]string{")
+	for _, b := range bindings {
+		p("%q: %q,", b.name, b.method)
+	}
+	p("}")
+
+	out, err := format.Source(buf.Bytes())
+	must(err)
+	return out
+}
+
+func genDoc(bindings []binding) []byte {
+	buf, err := os.ReadFile(docPath)
+	must(err)
+	doc := string(buf)
+	start := strings.Index(doc, beginTable)
+	end := strings.Index(doc, endTable)
+	if start < 0 || end < start {
+		must(fmt.Errorf("mapping table markers not found in %s", docPath))
+	}
+	start += len(beginTable) + 1
+
+	var table strings.Builder
+	table.WriteString("Function | API Call\n---------|---------\n")
+	for _, b := range bindings {
+		fmt.Fprintf(&table, "%s(%s) | %s [%s](https://godoc.org/github.com/go-delve/delve/service/rpc2#RPCServer.%s)\n", b.name, strings.Join(b.fields, ", "), apiRowMark, b.method, b.method)
+	}
+
+	// keep rows for builtins that aren't API calls
+	for i, line := range strings.Split(doc[start:end], "\n") {
+		if i < 2 || line == "" || strings.Contains(line, apiRowMark) {
+			continue
+		}
+		table.WriteString(line + "\n")
+	}
+
+	return []byte(doc[:start] + table.String() + doc[end:])
+}
+
+func main() {
+	check := flag.Bool("check", false, "check that the generated files are up to date")
+	flag.Parse()
+
+	for _, dir := range []string{".", "..", "../.."} {
+		if _, err := os.Stat(filepath.Join(dir, apiTypes)); err == nil {
+			must(os.Chdir(dir))
+			break
+		}
+	}
+
+	var fset token.FileSet
+	api := parseFile(&fset, apiTypes)
+	server := parseFile(&fset, filepath.Join(clientDir, "server.go"))
+	types := fieldTypes(&fset, api)
+	for k, v := range fieldTypes(&fset, server) {
+		types[k] = v
+	}
+
+	bs := bindings()
+	files := map[string][]byte{
+		mappingPath: genMapping(bs, currentDocs(&fset), types),
+		docPath:     genDoc(bs),
+	}
+
+	stale := false
+	for _, path := range []string{mappingPath, docPath} {
+		if *check {
+			cur, err := os.ReadFile(path)
+			must(err)
+			if !bytes.Equal(cur, files[path]) {
+				fmt.Fprintf(os.Stderr, "%s is stale, run go run _scripts/gen-starlark-bindings.go\n", path)
+				stale = true
+			}
+			continue
+		}
+		must(os.WriteFile(path, files[path], 0644))
+	}
+	if stale {
+		os.Exit(1)
+	}
+}
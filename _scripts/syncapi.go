@@ -239,36 +239,6 @@ func syncClient() {
 	})
 }
 
-func syncStarlark() {
-	copyChanged("internal/starbind/starlark_mapping.go", "pkg/terminal/starbind/starlark_mapping.go", func(fset *token.FileSet, f *ast.File) {
-		oldDecls := f.Decls
-		f.Decls = f.Decls[:0]
-		for _, decl := range oldDecls {
-			gendecl, isgendecl := decl.(*ast.GenDecl)
-
-			if isgendecl && gendecl.Tok == token.IMPORT {
-				oldSpecs := gendecl.Specs
-				gendecl.Specs = gendecl.Specs[:0]
-				for _, spec := range oldSpecs {
-					spec := spec.(*ast.ImportSpec)
-					s, _ := strconv.Unquote(spec.Path.Value)
-					if !strings.HasPrefix(s, "github.com/go-delve") {
-						gendecl.Specs = append(gendecl.Specs, spec)
-					} else if s == "github.com/go-delve/delve/service/api" {
-						spec.Path.Value = `"github.com/aarzilli/gdlv/internal/dlvclient/service/api"`
-						gendecl.Specs = append(gendecl.Specs, spec)
-					} else if s == "github.com/go-delve/delve/service/rpc2" {
-						spec.Path.Value = `"github.com/aarzilli/gdlv/internal/dlvclient/service/rpc2"`
-						gendecl.Specs = append(gendecl.Specs, spec)
-					}
-				}
-			}
-
-			f.Decls = append(f.Decls, decl)
-		}
-	})
-}
-
 func main() {
 	if len(os.Args) != 2 {
 		fmt.Fprintf(os.Stderr, "usage: go run _scripts/syncapi.go <delve directory>\n")
@@ -285,5 +255,6 @@ func main() {
 	syncTypes()
 	syncServer()
 	syncClient()
-	syncStarlark()
+
+	fmt.Printf("Run go run _scripts/gen-starlark-bindings.go to update the starlark mapping\n")
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sync"
 
 	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
 )
@@ -13,28 +14,62 @@ type frozenBreakpoint struct {
 	Bp             api.Breakpoint
 	LineInFunction int
 	LineContents   string
+	StarlarkCond   string
 }
 
 var FrozenBreakpoints []frozenBreakpoint
 
+// starlarkConds maps breakpoint IDs to starlark conditions, they are
+// evaluated by gdlv every time the breakpoint is hit instead of by delve.
+var starlarkConds = map[int]string{}
+var starlarkCondsMu sync.Mutex
+
+func starlarkCond(id int) string {
+	starlarkCondsMu.Lock()
+	defer starlarkCondsMu.Unlock()
+	return starlarkConds[id]
+}
+
+func setStarlarkCond(id int, cond string) {
+	starlarkCondsMu.Lock()
+	defer starlarkCondsMu.Unlock()
+	if cond == "" {
+		delete(starlarkConds, id)
+	} else {
+		starlarkConds[id] = cond
+	}
+}
+
 // Saves position information for bp in FrozenBreakpoints
 func freezeBreakpoint(out io.Writer, bp *api.Breakpoint) {
-	if bp == nil || bp.ID < 0 || bp.FunctionName == "" || bp.File == "" {
+	fbp, ok := makeFrozenBreakpoint(out, bp)
+	if !ok {
 		return
 	}
+	FrozenBreakpoints = append(FrozenBreakpoints, fbp)
+	saveConfiguration()
+}
+
+// Returns the position information needed to restore bp in a new instance
+// of the target.
+func makeFrozenBreakpoint(out io.Writer, bp *api.Breakpoint) (frozenBreakpoint, bool) {
+	if bp == nil || bp.ID < 0 || bp.FunctionName == "" || bp.File == "" {
+		return frozenBreakpoint{}, false
+	}
 	var fbp frozenBreakpoint
 	fbp.Bp = *bp
+	fbp.StarlarkCond = starlarkCond(bp.ID)
 
 	locs, _, err := client.FindLocation(api.EvalScope{-1, 0, 0}, fbp.Bp.FunctionName, true, nil)
 	if err != nil || len(locs) != 1 || locs[0].Function == nil || locs[0].Function.Name() != fbp.Bp.FunctionName {
 		fmt.Fprintf(out, "Function not found while recording breakpoint\n")
-		return
+		return frozenBreakpoint{}, false
 	}
 	functionLoc := locs[0]
 
 	if functionLoc.File != bp.File {
 		fmt.Fprintf(out, "File mismatch while recording breakpoint\n")
-		return
+		return frozenBreakpoint{}, false
 	}
 
 	fbp.LineInFunction = bp.Line - functionLoc.Line
@@ -43,7 +78,7 @@ func freezeBreakpoint(out io.Writer, bp *api.Breakpoint) {
 		fh, err := os.Open(bp.File)
 		if err != nil {
 			fmt.Fprintf(out, "Could not open source file while recording breakpoint\n")
-			return
+			return frozenBreakpoint{}, false
 		}
 		defer fh.Close()
 
@@ -53,7 +88,7 @@ func freezeBreakpoint(out io.Writer, bp *api.Breakpoint) {
 		if fi.ModTime().After(lastModExe) {
 			// executable is stale
 			fmt.Fprintf(out, "Breakpoint set on stale executable\n")
-			return
+			return frozenBreakpoint{}, false
 		}
 
 		buf := bufio.NewScanner(fh)
@@ -67,14 +102,14 @@ func freezeBreakpoint(out io.Writer, bp *api.Breakpoint) {
 		}
 	}
 
-	FrozenBreakpoints = append(FrozenBreakpoints, fbp)
-	saveConfiguration()
+	return fbp, true
 }
 
 func removeFrozenBreakpoint(bp *api.Breakpoint) {
 	if bp == nil {
 		return
 	}
+	setStarlarkCond(bp.ID, "")
 	for i := range FrozenBreakpoints {
 		if FrozenBreakpoints[i].Bp.ID == bp.ID {
 			copy(FrozenBreakpoints[i:], FrozenBreakpoints[i+1:])
@@ -91,6 +126,7 @@ func updateFrozenBreakpoints() {
 		bp, err := client.GetBreakpoint(FrozenBreakpoints[i].Bp.ID)
 		if err == nil {
 			FrozenBreakpoints[i].Bp = *bp
+			FrozenBreakpoints[i].StarlarkCond = starlarkCond(bp.ID)
 		}
 	}
 }
@@ -130,10 +166,12 @@ func (fbp *frozenBreakpoint) Restore(out io.Writer) {
 		fbp.Bp.Addr = 0
 		fbp.Bp.File = ""
 		fbp.Bp.Line = -1
-		_, err := client.CreateBreakpoint(&fbp.Bp)
+		bp, err := client.CreateBreakpoint(&fbp.Bp)
 		if err != nil {
 			fmt.Fprintf(out, "Could not restore breakpoint at function %s: %v\n", fbp.Bp.FunctionName, err)
+			return
 		}
+		setStarlarkCond(bp.ID, fbp.StarlarkCond)
 		return
 	}
 
@@ -196,6 +234,7 @@ func (fbp *frozenBreakpoint) Set(out io.Writer, functionLoc *api.Location) {
 	savedDisabled := fbp.Bp.Disabled
 	fbp.Bp = *bp
 	fbp.Bp.Disabled = savedDisabled
+	setStarlarkCond(bp.ID, fbp.StarlarkCond)
 
 	if functionLoc != nil {
 		if bp.FunctionName != functionLoc.Function.Name() {
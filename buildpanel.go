@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aarzilli/nucular"
+	"golang.org/x/mobile/event/mouse"
+
+	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
+)
+
+// buildError is a diagnostic reported by the go command.
+type buildError struct {
+	File      string
+	Line, Col int
+	Msg       string
+}
+
+var buildErrorsPanel = struct {
+	mu     sync.Mutex
+	errors []buildError
+	id     int
+	// time of the last build, successful or not
+	lastBuild time.Time
+}{}
+
+// buildErrorRe matches an error message of the go command, the file name
+// can start with a drive letter on Windows.
+var buildErrorRe = regexp.MustCompile(`^((?:[A-Za-z]:[\\/])?[^\s:#][^:]*\.go):(\d+)(?::(\d+))?: (.*)$`)
+
+// parseBuildErrors parses the output of the go command, relative paths are
+// resolved against dir.
+func parseBuildErrors(out, dir string) []buildError {
+	var r []buildError
+	for _, line := range strings.Split(out, "\n") {
+		if len(r) > 0 && strings.HasPrefix(line, "\t") {
+			// continuation of the previous message
+			r[len(r)-1].Msg += "\n" + strings.TrimSpace(line)
+			continue
+		}
+		m := buildErrorRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		file := m[1]
+		if !filepath.IsAbs(file) && file[1] != ':' { // paths with a drive letter are absolute
+			file = filepath.Join(dir, file)
+		}
+		lineno, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+		r = append(r, buildError{File: file, Line: lineno, Col: col, Msg: m[4]})
+	}
+	return r
+}
+
+// setBuildErrors replaces the contents of the build errors panel.
+func setBuildErrors(errs []buildError) {
+	buildErrorsPanel.mu.Lock()
+	buildErrorsPanel.errors = errs
+	buildErrorsPanel.id++
+	buildErrorsPanel.lastBuild = time.Now()
+	buildErrorsPanel.mu.Unlock()
+	wnd.Changed()
+}
+
+func updateBuildErrors(w *nucular.Window) {
+	if w.HelpClicked {
+		showHelp(w.Master(), "BuildErrors Panel Help", buildErrorsPanelHelp)
+	}
+
+	w.Row(20).Static(150, 0)
+	if w.CheckboxText("Rebuild on save", &conf.RebuildOnSave) {
+		saveConfiguration()
+	}
+	w.Spacing(1)
+
+	buildErrorsPanel.mu.Lock()
+	defer buildErrorsPanel.mu.Unlock()
+
+	if len(buildErrorsPanel.errors) == 0 {
+		w.Row(20).Dynamic(1)
+		w.Label("No build errors", "LC")
+		return
+	}
+
+	for _, e := range buildErrorsPanel.errors {
+		pos := fmt.Sprintf("%s:%d", ShortenFilePath(e.File), e.Line)
+		if e.Col > 0 {
+			pos = fmt.Sprintf("%s:%d", pos, e.Col)
+		}
+		w.Row(20).Static()
+		w.LayoutFitWidth(buildErrorsPanel.id, 1)
+		w.LabelColored(pos, "LC", linkColor)
+		if w.Input().Mouse.IsClickInRect(mouse.ButtonLeft, w.LastWidgetBounds) {
+			listingPanel.pinnedLoc = &api.Location{File: e.File, Line: e.Line}
+			go refreshState(refreshToSameFrame, clearNothing, nil)
+		}
+		w.LayoutFitWidth(buildErrorsPanel.id, 1)
+		w.Label(strings.Replace(e.Msg, "\n", " ", -1), "LC")
+	}
+}
+
+// watchSources rebuilds and restarts the target whenever one of its source
+// files is saved, if conf.RebuildOnSave is set.
+func watchSources() {
+	for range time.Tick(time.Second) {
+		wnd.Lock()
+		descr := BackendServer
+		ok := conf.RebuildOnSave && descr.buildcmd != nil && client != nil && !client.Running() && !client.Recorded()
+		wnd.Unlock()
+		if !ok || !descr.sourcesChanged() {
+			continue
+		}
+		pseudoCommandWrap(func(w io.Writer) error {
+			return doRebuild(w, false, nil)
+		})
+	}
+}
+
+// sourcesChanged returns true if a source file of the package being built
+// was modified after the last build.
+func (descr *ServerDescr) sourcesChanged() bool {
+	dir := descr.debugid
+	if filepath.Ext(dir) == ".go" {
+		dir = filepath.Dir(dir)
+	}
+	buildErrorsPanel.mu.Lock()
+	since := buildErrorsPanel.lastBuild
+	buildErrorsPanel.mu.Unlock()
+	if lastModExe.After(since) {
+		since = lastModExe
+	}
+
+	sources, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, source := range sourcesPanel.slice {
+		if strings.HasPrefix(source, dir+string(os.PathSeparator)) {
+			sources = append(sources, source)
+		}
+	}
+	for _, source := range sources {
+		fi, err := os.Stat(source)
+		if err == nil && fi.ModTime().After(since) {
+			return true
+		}
+	}
+	return false
+}
@@ -24,13 +24,11 @@ import (
 
 	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
 	"github.com/aarzilli/gdlv/internal/prettyprint"
+	"github.com/aarzilli/gdlv/internal/starbind"
 
 	"github.com/aarzilli/nucular"
-	"github.com/aarzilli/nucular/font"
 	"github.com/aarzilli/nucular/label"
 	"github.com/aarzilli/nucular/rect"
-	"github.com/aarzilli/nucular/richtext"
-	"github.com/aarzilli/nucular/style"
 	"github.com/aarzilli/nucular/style-editor"
 )
 
@@ -134,6 +132,12 @@ Use:
 	
 To clear the arguments passed to the program.
 
+Use:
+
+	restart -profile <name> [arguments]
+
+To rebuild the program with the build profile <name>, build profiles are defined in the BuildProfiles section of the configuration file. The default profiles are "debug", "optimized" and "race".
+
 If the target is recorded:
 
 	restart [<checkpoint>]
@@ -150,6 +154,44 @@ All forms of restart that support specifying a list of arguments to pass to the
 	>output.txt	redirects the standard output of the target process to output.txt
 	2>error.txt	redirects the standard error of the target process to error.txt
 `},
+		{aliases: []string{"launch"}, group: runCmds, cmdFn: launch, complete: completeLaunch, helpMsg: `Restarts the debugger using a launch configuration.
+
+	launch
+	
+Lists the launch configurations defined in .gdlv/config.json.
+
+	launch <name>
+	
+Terminates the current target and starts the one described by the launch configuration <name>. A launch configuration specifies the command (debug, run, exec, test, ...), its arguments, build directory, tags, build flags, redirects, environment, working directory, backend and whether the target runs in the Terminal panel ("Tty": true), for example:
+
+	{
+		"Launch": {
+			"foo": {
+				"Command": "test",
+				"Args": ["-run", "TestFoo"],
+				"BuildDir": "./pkg/foo",
+				"Tags": "integration",
+				"Stdin": "in.txt"
+			}
+		}
+	}
+	
+The same configuration can be used at startup with 'gdlv -launch foo'.`},
+		{aliases: []string{"env"}, group: runCmds, cmdFn: env, helpMsg: `Changes the environment of the target process.
+
+	env
+	
+Lists the environment variables added to the environment of the target process, followed by the ones removed from it.
+
+	env <name>=<value>...
+	
+Sets one or more environment variables.
+
+	env -u <name>...
+	
+Removes one or more environment variables, including the ones inherited from gdlv.
+
+Changes take effect on the next 'restart', which will start a new instance of delve with the new environment.`},
 		{aliases: []string{"continue", "c"}, group: runCmds, cmdFn: cont, helpMsg: "Run until breakpoint or program termination."},
 		{aliases: []string{"rewind", "rw"}, group: revCmds, cmdFn: rewind, helpMsg: "Run backwards until breakpoint or program termination."},
 		{aliases: []string{"rev"}, group: revCmds, cmdFn: c.reverse, helpMsg: `Executes program backwards.
@@ -226,17 +268,76 @@ Lists saved layouts.`},
 	config
 	config alias <command> <alias>
 	config zoom <factor>
+	config zoom in|out|reset
+	config formatters
+	config bind
+	config bind <key> [command]
+	config bind preset <name>
+	config theme
+	config theme <name>
+	config theme load <file>
+	config theme export <file>
 	
 Without arguments opens the configuration window.
 With the 'alias' subcommand sets up a command alias.
 With the 'zoom' subcommand changes the display scaling factor (makes fonts larger or smaller).
+With the 'bind' subcommand lists the key bindings, binds key to command or, if command is omitted, removes the binding of key. Command can be any command, including aliases and commands defined by starlark scripts. Key is a key name optionally preceded by modifiers, for example Ctrl+Shift+F5 or Alt+1, keys other than function keys and Pause need a Ctrl, Alt or Meta modifier.
+The 'bind preset' subcommand replaces the bindings for continue, next, step, stepout and interrupt with one of the following presets:
+
+	default		F5 continue, F10 next, F11 step, Shift+F11 stepout, Shift+F5 interrupt, Alt+arrows for stepping
+	vs		Visual Studio layout: F5 continue, F10 next, F11 step, Shift+F11 stepout, Ctrl+Alt+Pause interrupt
+	goland		GoLand layout: F9 continue, F8 next, F7 step, Shift+F8 stepout
+	gdb		DDD layout: F9 continue, F6 next, F5 step, F8 stepout, Shift+F5/F6 step/next instruction
+
+With the 'theme' subcommand lists the available themes or selects one. The 'theme load' subcommand loads a theme definition file and selects it, the 'theme export' subcommand writes the current theme to file, as a starting point for a new theme. A theme definition file is a JSON file like this:
+
+	{
+		"Name": "My theme",
+		"Base": "Dark theme",
+		"Style": { "Text.Color": "#afafafff", "NormalWindow.Background": "#2d2d2d" },
+		"Colors": { "ChangedVariable": "#ff0000ff", "Link": "#0088dd" }
+	}
+
+Base is the built-in theme providing sizes and the colors that are not specified, Style contains the colors of the style properties, Colors the other colors used by gdlv: ChangedVariable, Link, LinkHover, Breakpoint, DisabledBreakpoint, CurrentLine, SearchMatch, OutputTimestamp and OutputStderr. Colors are written as #rrggbb or #rrggbbaa. Loaded themes are stored in the configuration file.
+
+With the 'formatters' subcommand reloads the type formatters from the project configuration file (.gdlv/config.json).
+
+Type formatters are specified in the "Formatters" list of the project configuration, for example:
+
+	"Formatters": [
+		{
+			"Type": "main.Stack",
+			"Summary": "{{len .items}} items",
+			"Children": [ { "Name": "top", "Expr": "{{expr}}.items[len({{expr}}.items)-1]" } ]
+		},
+		{ "TypeRegexp": "main\\.Pair\\[.*\\]", "Summary": "<{{.a}}, {{.b}}>" }
+	]
+
+A formatter matches either the type named by "Type", and all its instantiations if it's a generic type, or all types matching the regular expression "TypeRegexp". Summary is a Go text/template executed with the value of the variable: struct fields and map keys are accessed by name, pointers and interfaces are followed automatically. Children, optional, replace the fields of the variable in the variables panel, their Expr is a template producing an expression that will be evaluated, the template function 'expr' returns an expression for the variable being formatted.
+Formatters also apply to the detail viewer, which has a checkbox to show the raw value of the variable instead.
 `},
 		{aliases: []string{"scroll"}, group: winCmds, cmdFn: scrollCommand, helpMsg: `Controls scrollback behavior.
 	
 	scroll clear		Clears scrollback
 	scroll silence		Silences output from inferior
 	scroll noise		Re-enables output from inferior.
+	scroll filter <src>	Only shows output from src, one of all, gdlv, stdout or stderr.
+	scroll save <file>	Saves the transcript of the session to file.
+
+The transcript saved by 'scroll save' contains everything written to the scrollback since gdlv started, including what was removed by 'scroll clear' or because the scrollback got too long. If file ends in .html or .htm it is saved as HTML, otherwise as text.
+
+Press Ctrl+F in the command window to search the scrollback. Ctrl+Shift+F toggles the display of rendering performance statistics (this used to be Ctrl+F).
 `},
+		{aliases: []string{"history"}, cmdFn: historyCommand, helpMsg: `Shows and re-runs entries of the command history.
+
+	history			Lists all entries of the command history.
+	history search <text>	Lists the entries containing text.
+	history run <n>		Executes entry n again.
+	history clear		Removes all entries.
+
+The history is saved in .gdlv/history if the .gdlv directory exists in the current directory, and in the configuration directory otherwise. Commands already in the history are moved to its end instead of being added again. The maximum number of entries is set in the configuration window.
+
+Press Ctrl+R in the command window to search the history.`},
 		{aliases: []string{"exit", "quit", "q"}, cmdFn: exitCommand, helpMsg: "Exit the debugger."},
 
 		{aliases: []string{"window", "win"}, complete: completeWindow, cmdFn: windowCommand, helpMsg: `Opens a window.
@@ -245,7 +346,7 @@ With the 'zoom' subcommand changes the display scaling factor (makes fonts large
 	
 Kind is one of listing, diassembly, goroutines, stacktrace, variables, globals, breakpoints, threads, registers, sources, functions, types and checkpoints.
 
-Shortcuts:
+Default shortcuts (see 'config bind'):
 	Alt-1	Listing window
 	Alt-2	Variables window
 	Alt-3	Globals window
@@ -261,6 +362,8 @@ Shortcuts:
 	source <path>
 
 If path is a single '-' character an interactive starlark interpreter will start instead. Type 'exit' to exit.
+
+At startup gdlv executes ` + configLoc() + `.star, followed by the scripts in ` + scriptsDir() + ` and in .gdlv/scripts.
 See documentation in doc/starlark.md.`},
 
 		{aliases: []string{"stack"}, cmdFn: stackCommand, helpMsg: `Prints stacktrace
@@ -456,18 +559,15 @@ and GDLV_BOLD_FONT to the path of two ttf files.
 	}
 	fmt.Fprintln(out, "Type help followed by a command for full documentation.")
 	fmt.Fprintln(out)
-	fmt.Fprintln(out, "Keybindings:")
+	fmt.Fprintln(out, "Keybindings (change them with 'config bind'):")
 	{
 		w := new(tabwriter.Writer)
 		w.Init(out, 0, 8, 0, ' ', 0)
-		fmt.Fprintf(w, "    %s +/-/0 \t Zoom in/out/reset\n", zoomMetaKeyStr)
 		fmt.Fprintln(w, "    Escape \t Focus command line")
-		fmt.Fprintln(w, "    Shift-F5, Ctrl-delete \t Request manual stop")
-		fmt.Fprintln(w, "    F5, Alt-enter \t Continue")
-		fmt.Fprintln(w, "    F10, Alt-right \t Next")
-		fmt.Fprintln(w, "    F11, Alt-down \t Step")
-		fmt.Fprintln(w, "    Shift-F11, Alt-up \t Step Out")
 		fmt.Fprintln(w, "    Shift-enter \t Add new expression to the variables window")
+		for _, kb := range keybindings {
+			fmt.Fprintf(w, "    %s \t %s\n", kb.chord, kb.cmd)
+		}
 		if err := w.Flush(); err != nil {
 			return err
 		}
@@ -620,8 +720,7 @@ func setBreakpointEx(out io.Writer, requestedBp *api.Breakpoint, locspec string)
 func listBreakpoints() {
 	wnd.Lock()
 	defer wnd.Unlock()
-	style := wnd.Style()
-	c := scrollbackEditor.Append(true)
+	c := scrollbackAppend()
 	defer c.End()
 	bps, err := client.ListBreakpoints(false)
 	if err != nil {
@@ -635,11 +734,14 @@ func listBreakpoints() {
 		} else {
 			c.Text("\n        ")
 		}
-		writeLinkToLocation(c, style, bp.File, bp.Line, bp.Addr)
+		writeLinkToLocation(c, bp.File, bp.Line, bp.Addr)
 		c.Text(fmt.Sprintf(" (%d)\n", bp.TotalHitCount))
 		if bp.Cond != "" {
 			c.Text(fmt.Sprintf("\tcond %s\n", bp.Cond))
 		}
+		if cond := starlarkCond(bp.ID); cond != "" {
+			c.Text(fmt.Sprintf("\tstarlark cond %s\n", cond))
+		}
 	}
 }
 
@@ -672,6 +774,7 @@ func restart(out io.Writer, args string) error {
 	rerecord := false
 	args = strings.TrimSpace(args)
 	restartCheckpoint := ""
+	profile := ""
 	if args != "" {
 		argv := splitQuotedFields(args, '\'')
 		if len(argv) > 0 {
@@ -681,6 +784,13 @@ func restart(out io.Writer, args string) error {
 				argv = argv[1:]
 			}
 		}
+		if len(argv) > 0 && argv[0] == "-profile" {
+			if len(argv) < 2 {
+				return fmt.Errorf("not enough arguments to -profile")
+			}
+			profile = argv[1]
+			argv = argv[2:]
+		}
 		if len(argv) > 0 {
 			if argv[0] == "--" {
 				argv = argv[1:]
@@ -704,6 +814,34 @@ func restart(out io.Writer, args string) error {
 		newArgs = addTestPrefix(newArgs)
 	}
 
+	if profile != "" {
+		if BackendServer.buildopts == nil {
+			return fmt.Errorf("can not use -profile, the target was not built by gdlv")
+		}
+		if client != nil && client.Recorded() && !rerecord {
+			return fmt.Errorf("can not change build profile without re-recording, use 'restart -r -profile %s'", profile)
+		}
+		opts := *BackendServer.buildopts
+		opts.profile = profile
+		if err := BackendServer.setBuildCommand(&opts); err != nil {
+			return err
+		}
+	}
+
+	if BackendServer.envChanged && BackendServer.serverProcess != nil && (client == nil || !client.Recorded() || rerecord) {
+		// delve can not change the environment of the target, start a new
+		// instance of it instead.
+		descr, err := BackendServer.relaunchDescr(resetArgs, newArgs)
+		if err != nil {
+			return err
+		}
+		go pseudoCommandWrap(func(w io.Writer) error {
+			switchBackendServer(w, descr, true)
+			return nil
+		})
+		return nil
+	}
+
 	if client == nil {
 		go pseudoCommandWrap(func(w io.Writer) error {
 			return doRebuild(w, resetArgs, newArgs)
@@ -711,6 +849,13 @@ func restart(out io.Writer, args string) error {
 		return nil
 	}
 
+	if profile != "" {
+		go pseudoCommandWrap(func(w io.Writer) error {
+			return doRebuild(w, resetArgs, newArgs)
+		})
+		return nil
+	}
+
 	if BackendServer.StaleExecutable() && (!client.Recorded() || rerecord) {
 		wnd.PopupOpen("Recompile?", dynamicPopupFlags, rect.Rect{100, 100, 550, 400}, true, func(w *nucular.Window) {
 			w.Row(30).Static(0)
@@ -736,6 +881,130 @@ func restart(out io.Writer, args string) error {
 	return doRestart(out, restartCheckpoint, resetArgs, newArgs, rerecord)
 }
 
+func env(out io.Writer, args string) error {
+	argv := splitQuotedFields(strings.TrimSpace(args), '\'')
+	if len(argv) == 0 {
+		for _, kv := range BackendServer.env {
+			fmt.Fprintln(out, kv)
+		}
+		for _, name := range BackendServer.unsetenv {
+			fmt.Fprintf(out, "-u %s\n", name)
+		}
+		return nil
+	}
+	if !BackendServer.atStart || BackendServer.dlvargs == nil {
+		return errors.New("can not change the environment of a process that wasn't started by gdlv")
+	}
+	if argv[0] == "-u" {
+		for _, name := range argv[1:] {
+			if strings.Contains(name, "=") {
+				return fmt.Errorf("wrong argument %q, expected name", name)
+			}
+		}
+		for _, name := range argv[1:] {
+			BackendServer.setenv(name)
+		}
+	} else {
+		for _, kv := range argv {
+			if !strings.Contains(kv, "=") {
+				return fmt.Errorf("wrong argument %q, expected name=value", kv)
+			}
+		}
+		for _, kv := range argv {
+			BackendServer.setenv(kv)
+		}
+	}
+	fmt.Fprintf(out, "The new environment will be used after the next restart\n")
+	return nil
+}
+
+func launch(out io.Writer, args string) error {
+	args = strings.TrimSpace(args)
+	if args == "" {
+		names := make([]string, 0, len(projectConf.Launch))
+		for name := range projectConf.Launch {
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			fmt.Fprintf(out, "No launch configurations in %s\n", projectConfigLoc())
+			return nil
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			lc := projectConf.Launch[name]
+			fmt.Fprintf(out, "%s\t%s %s\n", name, lc.Command, strings.Join(lc.Args, " "))
+		}
+		return nil
+	}
+
+	lc := projectConf.Launch[args]
+	if lc == nil {
+		return fmt.Errorf("unknown launch configuration %q", args)
+	}
+	opts := lc.commandLineOptions()
+	descr, err := newServerDescr(&opts)
+	if err != nil {
+		return err
+	}
+
+	go pseudoCommandWrap(func(w io.Writer) error {
+		switchBackendServer(w, descr, false)
+		return nil
+	})
+	return nil
+}
+
+// switchBackendServer terminates the current target and starts the backend
+// server described by descr. If keepBreakpoints is set all breakpoints of
+// the current target, with their starlark conditions, are recreated in the
+// new one, otherwise the frozen breakpoints of the new target are used.
+func switchBackendServer(out io.Writer, descr *ServerDescr, keepBreakpoints bool) {
+	var keptBreakpoints []frozenBreakpoint
+	if client != nil {
+		updateFrozenBreakpoints()
+		saveConfiguration()
+		if keepBreakpoints {
+			bps, _ := client.ListBreakpoints(false)
+			for _, bp := range bps {
+				if fbp, ok := makeFrozenBreakpoint(out, bp); ok {
+					keptBreakpoints = append(keptBreakpoints, fbp)
+				}
+			}
+		}
+		if BackendServer.serverProcess != nil {
+			client.Detach(true)
+		} else {
+			client.Disconnect(true)
+		}
+		wnd.Lock()
+		client = nil
+		curThread = -1
+		curGid = -1
+		wnd.Unlock()
+	}
+	if BackendServer.stdinChan != nil {
+		close(BackendServer.stdinChan)
+	}
+	BackendServer.removeExecutable()
+
+	starlarkCondsMu.Lock()
+	starlarkConds = map[int]string{}
+	starlarkCondsMu.Unlock()
+
+	wnd.Lock()
+	BackendServer = descr
+	FrozenBreakpoints = FrozenBreakpoints[:0]
+	if keepBreakpoints {
+		FrozenBreakpoints = append(FrozenBreakpoints, keptBreakpoints...)
+	} else if BackendServer.debugid != "" && conf.FrozenBreakpoints != nil {
+		FrozenBreakpoints = append(FrozenBreakpoints, conf.FrozenBreakpoints[BackendServer.debugid]...)
+	}
+	wnd.Unlock()
+
+	fmt.Fprintf(out, "Launching %s\n", strings.Join(descr.dlvargs, " "))
+	BackendServer.Start()
+}
+
 func yesno(w *nucular.Window) (yes, no bool) {
 	for _, e := range w.Input().Keyboard.Keys {
 		switch {
@@ -836,6 +1105,7 @@ func doRestart(out io.Writer, restartCheckpoint string, resetArgs bool, argsAndR
 		finishRestart(out, true)
 	}
 	firstStop = true
+	callHook(starbind.OnRestartHook)
 	refreshState(refreshToFrameZero, clearStop, nil)
 	return nil
 }
@@ -870,6 +1140,7 @@ func doRebuild(out io.Writer, resetArgs bool, argsAndRedirects []string) error {
 
 	finishRestart(out, true)
 
+	callHook(starbind.OnRestartHook)
 	refreshState(refreshToFrameZero, clearStop, nil)
 	return nil
 }
@@ -1416,18 +1687,43 @@ func configCommand(out io.Writer, args string) error {
 	const (
 		aliasPrefix = "alias "
 		zoomPrefix  = "zoom "
+		bindPrefix  = "bind "
+		themePrefix = "theme "
 	)
 	switch {
+	case args == "formatters":
+		err := reloadFormatters()
+		if client != nil {
+			go refreshState(refreshToSameFrame, clearFrameSwitch, nil)
+		}
+		return err
 	case strings.HasPrefix(args, aliasPrefix):
 		return configureSetAlias(strings.TrimSpace(args[len(aliasPrefix):]))
 	case strings.HasPrefix(args, zoomPrefix):
-		s, err := strconv.ParseFloat(strings.TrimSpace(args[len(zoomPrefix):]), 64)
-		if err != nil {
-			return err
+		switch arg := strings.TrimSpace(args[len(zoomPrefix):]); arg {
+		case "in":
+			conf.Scaling += 0.1
+		case "out":
+			conf.Scaling -= 0.1
+		case "reset":
+			conf.Scaling = 1.0
+		default:
+			s, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return err
+			}
+			conf.Scaling = s
 		}
-		conf.Scaling = s
 		setupStyle()
 		return nil
+	case args == "theme":
+		return configureTheme(out, "")
+	case strings.HasPrefix(args, themePrefix):
+		return configureTheme(out, strings.TrimSpace(args[len(themePrefix):]))
+	case args == "bind":
+		return configureBind(out, "")
+	case strings.HasPrefix(args, bindPrefix):
+		return configureBind(out, strings.TrimSpace(args[len(bindPrefix):]))
 	}
 	cw := newConfigWindow()
 	wnd.PopupOpen("Configuration", dynamicPopupFlags, rect.Rect{100, 100, 600, 700}, true, cw.Update)
@@ -1486,7 +1782,7 @@ func (cw *configWindow) Update(w *nucular.Window) {
 	}
 	if w := w.Combo(label.TA(conf.Theme, "LC"), 500, nil); w != nil {
 		w.Row(20).Dynamic(1)
-		for _, theme := range themes {
+		for _, theme := range themeNames() {
 			if w.MenuItem(label.TA(theme, "LC")) {
 				conf.Theme = theme
 				setupStyle()
@@ -1549,6 +1845,10 @@ func (cw *configWindow) Update(w *nucular.Window) {
 	w.Spacing(1)
 	w.PropertyInt("Max string load:", 1, &conf.MaxStringLen, 4096, 1, 1)
 
+	w.Row(30).Static(200, 200)
+	w.Label("Command history:", "LC")
+	w.PropertyInt("Size:", 10, &conf.HistorySize, 100000, 10, 10)
+
 	w.Row(30).Static(0)
 	if w.TreePush(nucular.TreeTab, "Path substitutions:", false) {
 		w.Row(240).Static(0, 200)
@@ -1629,10 +1929,38 @@ func stringCombo(w *nucular.Window, values []string, value *string) {
 }
 
 func scrollCommand(out io.Writer, args string) error {
+	const (
+		filterPrefix = "filter "
+		savePrefix   = "save "
+	)
+	switch {
+	case strings.HasPrefix(args, filterPrefix):
+		filter := 0
+		if name := strings.TrimSpace(args[len(filterPrefix):]); name != "all" {
+			filter = scrollbackFilterValue(name)
+			if filter == 0 {
+				return fmt.Errorf("unknown output source %q", name)
+			}
+		}
+		wnd.Lock()
+		scrollbackMu.Lock()
+		search := scrollback.search
+		scrollbackMu.Unlock()
+		setScrollbackView(filter, search)
+		wnd.Unlock()
+		return nil
+	case strings.HasPrefix(args, savePrefix):
+		path := strings.TrimSpace(args[len(savePrefix):])
+		if err := saveScrollback(path); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Transcript saved to %s\n", path)
+		return nil
+	}
 	switch args {
 	case "clear":
 		wnd.Lock()
-		scrollbackClear = true
+		clearScrollback()
 		wnd.Unlock()
 	case "silence":
 		wnd.Lock()
@@ -1779,7 +2107,7 @@ func stackCommand(out io.Writer, args string) error {
 func goroutinesCommand(out io.Writer, args string) error {
 	wnd.Lock()
 	defer wnd.Unlock()
-	c := scrollbackEditor.Append(true)
+	c := scrollbackAppend()
 	defer c.End()
 
 	lim := goroutinesPanel.limit
@@ -1796,8 +2124,7 @@ func goroutinesCommand(out io.Writer, args string) error {
 	return nil
 }
 
-func printGoroutines(c *richtext.Ctor, gs []*api.Goroutine) {
-	style := wnd.Style()
+func printGoroutines(c *scrollbackCtor, gs []*api.Goroutine) {
 	for _, g := range gs {
 		if g.ID == curGid {
 			c.Text("* ")
@@ -1819,7 +2146,7 @@ func printGoroutines(c *richtext.Ctor, gs []*api.Goroutine) {
 		}
 		loc := goroutineGetDisplayLiocation(g)
 		gid := g.ID
-		writeLink(c, style, fmt.Sprintf("Goroutine %d", g.ID), func() {
+		writeLink(c, fmt.Sprintf("Goroutine %d", g.ID), func() {
 			state, err := client.SwitchGoroutine(gid)
 			if err != nil {
 				fmt.Fprintf(&editorWriter{true}, "Could not switch goroutine: %v\n", err)
@@ -1828,7 +2155,7 @@ func printGoroutines(c *richtext.Ctor, gs []*api.Goroutine) {
 			}
 		})
 		c.Text(fmt.Sprintf(" - %s: ", locType))
-		writeLinkToLocation(c, style, loc.File, loc.Line, loc.PC)
+		writeLinkToLocation(c, loc.File, loc.Line, loc.PC)
 		c.Text(fmt.Sprintf(" %s (%#x)", loc.Function.Name(), loc.PC))
 
 		if g.ThreadID != 0 {
@@ -2133,6 +2460,11 @@ func printcontext(out io.Writer, state *api.DebuggerState) error {
 		}
 	}
 
+	if !evalStarlarkConds(state) {
+		// the target will be continued by callStopHooks
+		return nil
+	}
+
 	if !onNewline {
 		out.Write([]byte{'\n'})
 	}
@@ -2160,7 +2492,7 @@ func printcontext(out io.Writer, state *api.DebuggerState) error {
 	return nil
 }
 
-func printReturnValues(c *richtext.Ctor, th *api.Thread) {
+func printReturnValues(c *scrollbackCtor, th *api.Thread) {
 	if len(th.ReturnValues) == 0 {
 		return
 	}
@@ -2174,15 +2506,14 @@ func printReturnValues(c *richtext.Ctor, th *api.Thread) {
 func printcontextThread(th *api.Thread) {
 	wnd.Lock()
 	defer wnd.Unlock()
-	style := wnd.Style()
-	c := scrollbackEditor.Append(true)
+	c := scrollbackAppend()
 	defer c.End()
 
 	fn := th.Function
 
 	if th.Breakpoint == nil {
 		c.Text(fmt.Sprintf("> %s() ", fn.Name()))
-		writeLinkToLocation(c, style, th.File, th.Line, th.PC)
+		writeLinkToLocation(c, th.File, th.Line, th.PC)
 		c.Text(fmt.Sprintf(" (PC %#x)\n", th.PC))
 		printReturnValues(c, th)
 		return
@@ -2203,7 +2534,7 @@ func printcontextThread(th *api.Thread) {
 	}
 
 	c.Text(fmt.Sprintf("> %s%s(%s) ", bpname, fn.Name(), args))
-	writeLinkToLocation(c, style, th.File, th.Line, th.PC)
+	writeLinkToLocation(c, th.File, th.Line, th.PC)
 	if hitCount, ok := th.Breakpoint.HitCount[strconv.FormatInt(th.GoroutineID, 10)]; ok {
 		c.Text(fmt.Sprintf(" (hits goroutine(%d):%d total:%d) (PC: %#v)\n",
 			th.GoroutineID,
@@ -2265,24 +2596,22 @@ func writeGoroutineLong(w io.Writer, g *api.Goroutine, prefix string) {
 		prefix, formatLocation(g.GoStatementLoc))
 }
 
-func writeLink(c *richtext.Ctor, style *style.Style, text string, fn func()) {
-	c.SetStyle(richtext.TextStyle{Face: style.Font, Color: linkColor, Flags: richtext.Underline})
-	c.Link(text, linkHoverColor, fn)
-	c.SetStyle(richtext.TextStyle{Face: style.Font, Cursor: font.TextCursor})
+func writeLink(c *scrollbackCtor, text string, fn func()) {
+	c.Link(text, "", fn)
 }
 
-func writeLinkToLocation(c *richtext.Ctor, style *style.Style, file string, line int, pc uint64) {
-	writeLink(c, style, fmt.Sprintf("%s:%d", ShortenFilePath(file), line), func() {
+func writeLinkToLocation(c *scrollbackCtor, file string, line int, pc uint64) {
+	c.Link(fmt.Sprintf("%s:%d", ShortenFilePath(file), line), fmt.Sprintf("file://%s#L%d", file, line), func() {
 		listingPanel.pinnedLoc = &api.Location{File: file, Line: line, PC: pc}
 		go refreshState(refreshToSameFrame, clearNothing, nil)
 	})
 }
 
-func printStack(c *richtext.Ctor, stack []api.Stackframe, ind string) {
+func printStack(c *scrollbackCtor, stack []api.Stackframe, ind string) {
 	if c == nil {
 		wnd.Lock()
 		defer wnd.Unlock()
-		c = scrollbackEditor.Append(true)
+		c = scrollbackAppend()
 		defer c.End()
 	}
 	if len(stack) == 0 {
@@ -2292,11 +2621,9 @@ func printStack(c *richtext.Ctor, stack []api.Stackframe, ind string) {
 	fmtstr := "%s%" + strconv.Itoa(d) + "d  0x%016x in %s\n%sat "
 	s := ind + strings.Repeat(" ", d+2+len(ind))
 
-	style := wnd.Style()
-
 	for i := range stack {
 		c.Text(fmt.Sprintf(fmtstr, ind, i, stack[i].PC, stack[i].Function.Name(), s))
-		writeLinkToLocation(c, style, stack[i].File, stack[i].Line, stack[i].PC)
+		writeLinkToLocation(c, stack[i].File, stack[i].Line, stack[i].PC)
 		c.Text("\n")
 
 		for j := range stack[i].Arguments {
@@ -2490,7 +2817,7 @@ func chanGoroutines(v *Variable) {
 		fmt.Fprintf(&editorWriter{true}, "error getting list of goroutines for channel: %v", err)
 		return
 	}
-	c := scrollbackEditor.Append(true)
+	c := scrollbackAppend()
 	defer c.End()
 
 	if v.Expression != "" && len(v.Expression) < 30 {
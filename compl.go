@@ -7,8 +7,17 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
 )
 
 var fullpathCompl []string
@@ -34,6 +43,10 @@ func completeLocationSetup() {
 }
 
 func completeAny() {
+	if starlarkMode != nil {
+		completeStarlark()
+		return
+	}
 	buf := commandLineEditor.Buffer
 	if len(buf) == commandLineEditor.Cursor {
 		completeCommand()
@@ -91,14 +104,208 @@ func completeWord(word string, completionLists ...[]string) {
 			cm.add(compl)
 		}
 	}
-	cm.finish(cleins, &editorWriter{false})
+	cm.finish(clereplace, &editorWriter{false})
+}
+
+func completeLaunch() {
+	names := make([]string, 0, len(projectConf.Launch))
+	for name := range projectConf.Launch {
+		names = append(names, name)
+	}
+	completeWord(lastWord([]rune{' '}), names)
 }
 
 func completeVariable() {
 	word := lastWord([]rune{' '})
+	switch {
+	case strings.HasPrefix(word, "@"):
+		completeWord(word, scopeCompletions())
+		return
+	case strings.HasPrefix(word, "%"):
+		completeWord(word, formatDirectives)
+		return
+	}
+
+	if bracket := strings.LastIndex(word, "["); bracket > 0 && !strings.Contains(word[bracket:], "]") {
+		if keys, ok := completeMapKeys(word[:bracket]); ok {
+			completeWord(word[bracket+1:], keys)
+			return
+		}
+	} else if dot := strings.LastIndex(word, "."); dot > 0 {
+		if fields, ok := completeFields(word[:dot]); ok {
+			completeWord(word[dot+1:], fields)
+			return
+		}
+	}
+
 	cm := completeMachine{word: word}
 	completeAddVariables(&cm)
-	cm.finish(cleins, &editorWriter{false})
+	cm.finish(clereplace, &editorWriter{false})
+}
+
+// formatDirectives are the format directives accepted before an expression,
+// see ParseScopedExpr.
+var formatDirectives = []string{"%s", "%#s", "%a", "%v", "%t", "%x", "%X", "%o", "%O", "%b", "%d", "%e", "%f", "%g", "%E", "%F", "%G"}
+
+// scopeCompletions returns the scope prefixes for the goroutines and frames
+// currently loaded in the goroutines and stacktrace panels.
+func scopeCompletions() []string {
+	r := []string{"@g", "@f", "@d"}
+	func() {
+		goroutinesPanel.asyncLoad.mu.Lock()
+		defer goroutinesPanel.asyncLoad.mu.Unlock()
+		if !goroutinesPanel.asyncLoad.loaded {
+			return
+		}
+		for _, g := range goroutinesPanel.goroutines {
+			r = append(r, fmt.Sprintf("@g%d", g.ID))
+		}
+	}()
+	func() {
+		stackPanel.asyncLoad.mu.Lock()
+		defer stackPanel.asyncLoad.mu.Unlock()
+		if !stackPanel.asyncLoad.loaded {
+			return
+		}
+		for i, frame := range stackPanel.stack {
+			r = append(r, fmt.Sprintf("@f%d", i))
+			if frame.Function != nil {
+				r = append(r, "@f/"+escapeSlash(regexp.QuoteMeta(frame.Function.Name()))+"/")
+			}
+		}
+	}()
+	return r
+}
+
+// completionEvalTimeout is how long evalForCompletion waits for the
+// evaluation of an expression, completion is run while the UI is locked.
+const completionEvalTimeout = 200 * time.Millisecond
+
+// completionEval is set while an evaluation started by evalForCompletion is
+// running, further completions will not evaluate expressions until it
+// finishes.
+var completionEval struct {
+	mu      sync.Mutex
+	running bool
+}
+
+// evalForCompletion evaluates expr, using the scope and format prefix of
+// the expression being completed. Returns nil if the evaluation takes
+// longer than completionEvalTimeout.
+func evalForCompletion(expr string) *api.Variable {
+	if client == nil || client.Running() {
+		return nil
+	}
+	buf := commandLineEditor.Buffer
+	if commandLineEditor.Cursor < len(buf) {
+		buf = buf[:commandLineEditor.Cursor]
+	}
+	// prefix is the text between the command and the word being completed
+	prefix := ""
+	if sp := strings.Index(string(buf), " "); sp >= 0 {
+		prefix = strings.TrimSpace(string(buf[sp:]))
+		if i := strings.LastIndex(prefix, " "); i >= 0 {
+			prefix = prefix[:i+1]
+		} else {
+			prefix = ""
+		}
+	}
+	if prefix != "" && prefix[0] != '@' && prefix[0] != '%' {
+		prefix = ""
+	}
+
+	completionEval.mu.Lock()
+	if completionEval.running {
+		completionEval.mu.Unlock()
+		return nil
+	}
+	completionEval.running = true
+	completionEval.mu.Unlock()
+
+	done := make(chan *Variable, 1)
+	go func() {
+		v, _ := evalScopedExpr(prefix+expr, api.LoadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 64, MaxArrayValues: 100, MaxStructFields: -1}, false)
+		completionEval.mu.Lock()
+		completionEval.running = false
+		completionEval.mu.Unlock()
+		done <- v
+	}()
+
+	var v *Variable
+	select {
+	case v = <-done:
+	case <-time.After(completionEvalTimeout):
+		return nil
+	}
+	if v == nil || v.Variable == nil || v.Unreadable != "" {
+		return nil
+	}
+	v2 := v.Variable
+	for (v2.Kind == reflect.Ptr || v2.Kind == reflect.Interface) && len(v2.Children) == 1 && v2.Children[0].Kind != reflect.Invalid {
+		v2 = &v2.Children[0]
+	}
+	return v2
+}
+
+// completeFields returns the fields and methods of the value of expr.
+func completeFields(expr string) ([]string, bool) {
+	v := evalForCompletion(expr)
+	if v == nil {
+		return nil, false
+	}
+	var r []string
+	if v.Kind == reflect.Struct {
+		for i := range v.Children {
+			if v.Children[i].Name != "" {
+				r = append(r, v.Children[i].Name)
+			}
+		}
+	}
+	r = append(r, methodsOf(v.Type)...)
+	return r, len(r) > 0
+}
+
+// methodsOf returns the names of the methods of typ and *typ, using the
+// list of functions of the target.
+func methodsOf(typ string) []string {
+	typ = strings.TrimPrefix(typ, "*")
+	generic := ""
+	if i := strings.Index(typ, "["); i >= 0 {
+		typ = typ[:i]
+		generic = "[...]"
+	}
+	dot := strings.LastIndex(typ, ".")
+	if dot < 0 {
+		return nil
+	}
+	pkg, name := typ[:dot], typ[dot+1:]
+	prefixes := []string{pkg + "." + name + generic + ".", pkg + ".(*" + name + generic + ")."}
+	var r []string
+	for _, fn := range funcsPanel.slice {
+		for _, pfx := range prefixes {
+			if strings.HasPrefix(fn, pfx) && !strings.Contains(fn[len(pfx):], ".") {
+				r = append(r, fn[len(pfx):])
+			}
+		}
+	}
+	return r
+}
+
+// completeMapKeys returns the keys of the value of expr, if it is a map
+// with string keys, quoted and followed by the closing bracket.
+func completeMapKeys(expr string) ([]string, bool) {
+	v := evalForCompletion(expr)
+	if v == nil || v.Kind != reflect.Map {
+		return nil, false
+	}
+	var r []string
+	for i := 0; i+1 < len(v.Children); i += 2 {
+		if v.Children[i].Kind != reflect.String {
+			return nil, false
+		}
+		r = append(r, strconv.Quote(v.Children[i].Value)+"]")
+	}
+	return r, true
 }
 
 func completeAddVariables(cm *completeMachine) {
@@ -139,7 +346,12 @@ func completeCommand() {
 			cm.add(alias)
 		}
 	}
-	cm.finish(cleins, &editorWriter{false})
+	cm.finish(clereplace, &editorWriter{false})
+}
+
+func completeStarlark() {
+	word, compls := StarlarkEnv.Complete(string(commandLineEditor.Buffer[:commandLineEditor.Cursor]))
+	completeWord(word, compls)
 }
 
 func completeWindow() {
@@ -150,7 +362,7 @@ func completeWindow() {
 	for _, w := range infoModes {
 		cm.add(strings.ToLower(w))
 	}
-	cm.finish(cleins, &editorWriter{false})
+	cm.finish(clereplace, &editorWriter{false})
 }
 
 func completeFilesystem() {
@@ -195,38 +407,135 @@ func expandTilde(path string) string {
 
 type completeMachine struct {
 	word   string
-	compls []string
+	compls []string // completions starting with word
+	fuzzy  []fuzzyCompl
+}
+
+// fuzzyCompl is a completion containing the characters of word, in order,
+// but not starting with it.
+type fuzzyCompl struct {
+	compl string
+	score int
 }
 
 func (cm *completeMachine) add(compl string) {
 	if strings.HasPrefix(compl, cm.word) {
 		cm.compls = append(cm.compls, compl)
+	} else if score, ok := fuzzyMatch(cm.word, compl); ok {
+		cm.fuzzy = append(cm.fuzzy, fuzzyCompl{compl, score})
 	}
 }
 
-func cleins(s string) {
-	commandLineEditor.Text([]rune(s))
+// clereplace replaces the n bytes before the cursor of the command line
+// with s.
+func clereplace(n int, s string) {
+	ed := &commandLineEditor
+	end := ed.Cursor
+	if end > len(ed.Buffer) {
+		end = len(ed.Buffer)
+	}
+	before := string(ed.Buffer[:end])
+	if n > len(before) {
+		n = len(before)
+	}
+	start := end - utf8.RuneCountInString(before[len(before)-n:])
+	ed.Buffer = append(ed.Buffer[:start], append([]rune(s), ed.Buffer[end:]...)...)
+	ed.Cursor = start + len([]rune(s))
+	ed.CursorFollow = true
 }
 
-func (cm *completeMachine) finish(insert func(string), additional io.Writer) {
+// finish completes word, calling replace to replace the n bytes before the
+// cursor with s. If some completions start with word their common prefix is
+// inserted, otherwise if only one completion matches word fuzzily it
+// replaces word. The best completions are written to additional.
+func (cm *completeMachine) finish(replace func(n int, s string), additional io.Writer) {
 	cm.compls = dedup(cm.compls)
+	var ranked []string
 	switch len(cm.compls) {
 	case 0:
-		return
+		if len(cm.fuzzy) == 0 {
+			return
+		}
+		sort.SliceStable(cm.fuzzy, func(i, j int) bool {
+			a, b := cm.fuzzy[i], cm.fuzzy[j]
+			if a.score != b.score {
+				return a.score > b.score
+			}
+			if len(a.compl) != len(b.compl) {
+				return len(a.compl) < len(b.compl)
+			}
+			return a.compl < b.compl
+		})
+		for _, fc := range cm.fuzzy {
+			if len(ranked) == 0 || ranked[len(ranked)-1] != fc.compl {
+				ranked = append(ranked, fc.compl)
+			}
+		}
+		if len(ranked) == 1 {
+			replace(len(cm.word), ranked[0])
+			return
+		}
 	case 1:
-		insert(cm.compls[0][len(cm.word):])
+		replace(0, cm.compls[0][len(cm.word):])
+		return
 	default:
 		compl := commonPrefix(cm.compls)
-		insert(compl[len(cm.word):])
-		more := ""
-		if len(cm.compls) > 5 {
-			more = "..."
-			cm.compls = cm.compls[:5]
+		replace(0, compl[len(cm.word):])
+		ranked = cm.compls
+		sort.SliceStable(ranked, func(i, j int) bool {
+			return len(ranked[i]) < len(ranked[j])
+		})
+	}
+	more := ""
+	if len(ranked) > 5 {
+		more = "..."
+		ranked = ranked[:5]
+	}
+	if additional != nil {
+		fmt.Fprintf(additional, "Completions: %s%s\n", strings.Join(ranked, ", "), more)
+	}
+}
+
+// fuzzyMatch returns true if the characters of word appear in compl in the
+// same order, the match is case insensitive unless word contains upper case
+// letters. The returned score is higher for matches at the start of words
+// and for consecutive characters.
+func fuzzyMatch(word, compl string) (int, bool) {
+	if len(word) < 2 {
+		return 0, false
+	}
+	fold := strings.ToLower(word) == word
+	score := 0
+	wr := []rune(word)
+	j := 0
+	var prev rune
+	prevMatched := false
+	for i, ch := range compl {
+		if j >= len(wr) {
+			break
+		}
+		cur := ch
+		if fold {
+			cur = unicode.ToLower(ch)
 		}
-		if additional != nil {
-			fmt.Fprintf(additional, "Completions: %s%s\n", strings.Join(cm.compls, ", "), more)
+		matched := cur == wr[j]
+		if matched {
+			j++
+			score++
+			if prevMatched {
+				score += 4
+			}
+			if i == 0 || strings.ContainsRune("./_-*( ", prev) || (unicode.IsUpper(ch) && !unicode.IsUpper(prev)) {
+				score += 2
+			}
 		}
+		prev = ch
+		prevMatched = matched
+	}
+	if j < len(wr) {
+		return 0, false
 	}
+	return score - len(compl)/4, true
 }
 
 func dedup(v []string) []string {
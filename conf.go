@@ -4,11 +4,15 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 
 	"github.com/aarzilli/nucular/rect"
+
+	"github.com/aarzilli/gdlv/internal/prettyprint"
 )
 
 const (
@@ -18,8 +22,6 @@ const (
 	boringTheme = "Pastel theme"
 )
 
-var themes = []string{darkTheme, whiteTheme, redTheme, boringTheme}
-
 type Configuration struct {
 	Scaling              float64
 	Theme                string
@@ -34,6 +36,20 @@ type Configuration struct {
 	MaxStringLen         int
 	SubstitutePath       []SubstitutePathRule
 	FrozenBreakpoints    map[string][]frozenBreakpoint
+	ScriptPath           []string
+	BuildProfiles        map[string]BuildProfile
+	RebuildOnSave        bool
+	HistorySize          int               // maximum number of entries of the command history
+	Keybindings          map[string]string // maps key chords to commands
+	Themes               map[string]*Theme // themes loaded with 'config theme load'
+}
+
+// BuildProfile describes a set of flags used to build the target.
+type BuildProfile struct {
+	Description string
+	Flags       string // additional flags for 'go build'
+	GoFlags     string // value of GOFLAGS
+	Optimized   bool   // do not disable optimizations and inlining
 }
 
 type LayoutDescr struct {
@@ -64,9 +80,23 @@ func adjustConfiguration() {
 	if ld, ok := conf.Layouts["default"]; !ok || ld.Layout == "" {
 		conf.Layouts["default"] = LayoutDescr{"|300_250LC_180Sl", "Default layout"}
 	}
+	if conf.BuildProfiles == nil {
+		conf.BuildProfiles = map[string]BuildProfile{
+			"debug":     {Description: "Optimizations disabled"},
+			"optimized": {Description: "Optimizations enabled", Optimized: true},
+			"race":      {Description: "Race detector enabled", Flags: "-race"},
+		}
+	}
 	if conf.SavedBounds == nil {
 		conf.SavedBounds = make(map[string]rect.Rect)
 	}
+	if conf.HistorySize <= 0 {
+		conf.HistorySize = defaultHistorySize
+	}
+	if conf.Keybindings == nil {
+		conf.Keybindings = defaultKeybindings()
+	}
+	setupKeybindings()
 }
 
 func configLoc() string {
@@ -77,6 +107,112 @@ func configLoc() string {
 	return os.ExpandEnv(loc)
 }
 
+// scriptsDir returns the directory containing the starlark scripts that are
+// loaded at startup.
+func scriptsDir() string {
+	return configLoc() + "-scripts"
+}
+
+// projectDir returns the directory containing the project-local
+// configuration, which is the .gdlv directory in the current directory.
+func projectDir() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return ".gdlv"
+	}
+	return filepath.Join(wd, ".gdlv")
+}
+
+// ProjectConfiguration is the project-local configuration, stored in
+// .gdlv/config.json.
+type ProjectConfiguration struct {
+	Launch     map[string]*LaunchConfig
+	Formatters []*prettyprint.TypeFormatter
+}
+
+// LaunchConfig describes a named way of starting the target program.
+type LaunchConfig struct {
+	Command    string   // one of debug, run, exec, test, ... optionally prefixed by a backend
+	Args       []string // arguments of the command
+	BuildDir   string
+	Tags       string
+	BuildFlags string
+	Profile    string // build profile
+	Stdin      string
+	Stdout     string
+	Stderr     string
+	Env        []string // environment variables, in the form "name=value"
+	WorkingDir string
+	Backend    string
+	Tty        bool // runs the target in the Terminal panel, Linux only
+}
+
+var projectConf ProjectConfiguration
+
+func projectConfigLoc() string {
+	return filepath.Join(projectDir(), "config.json")
+}
+
+func loadProjectConfiguration() {
+	fh, err := os.Open(projectConfigLoc())
+	if err != nil {
+		return
+	}
+	defer fh.Close()
+	if err := json.NewDecoder(fh).Decode(&projectConf); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading %s:\n%v\n", projectConfigLoc(), err)
+	}
+	if err := prettyprint.SetTypeFormatters(projectConf.Formatters); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading formatters from %s:\n%v\n", projectConfigLoc(), err)
+	}
+}
+
+// reloadFormatters reads the type formatters from the project configuration
+// file again.
+func reloadFormatters() error {
+	buf, err := os.ReadFile(projectConfigLoc())
+	if err != nil {
+		return err
+	}
+	var pc ProjectConfiguration
+	if err := json.Unmarshal(buf, &pc); err != nil {
+		return fmt.Errorf("%s: %v", projectConfigLoc(), err)
+	}
+	projectConf.Formatters = pc.Formatters
+	return prettyprint.SetTypeFormatters(projectConf.Formatters)
+}
+
+// commandLineOptions returns the command line options equivalent to lc.
+func (lc *LaunchConfig) commandLineOptions() commandLineOptions {
+	opts := commandLineOptions{
+		cmd:            lc.Command,
+		cmdArgs:        lc.Args,
+		backend:        "--backend=default",
+		defaultBackend: true,
+		buildDir:       lc.BuildDir,
+		tags:           lc.Tags,
+		buildFlags:     lc.BuildFlags,
+		profile:        lc.Profile,
+		redirects:      [3]string{lc.Stdin, lc.Stdout, lc.Stderr},
+		env:            lc.Env,
+		wd:             lc.WorkingDir,
+		tty:            lc.Tty,
+	}
+	if opts.cmd == "" {
+		opts.cmd = "debug"
+	}
+	backend := lc.Backend
+	if colon := strings.Index(opts.cmd, ":"); colon >= 0 {
+		backend = opts.cmd[:colon]
+		opts.cmd = opts.cmd[colon+1:]
+	}
+	if backend != "" {
+		opts.backend = "--backend=" + backend
+		opts.defaultBackend = backend != "rr"
+	}
+	return opts
+}
+
 func loadConfiguration() {
 	defer adjustConfiguration()
 	fh, err := os.Open(configLoc())
@@ -51,6 +51,7 @@ type detailViewer struct {
 	ed         nucular.TextEditor
 	showAddr   bool
 	fullTypes  bool
+	raw        bool // ignore type formatters and custom formatters
 
 	mu sync.Mutex
 }
@@ -84,7 +85,7 @@ func (dv *detailViewer) load(p *asyncLoad) {
 	cfg := getVariableLoadConfig()
 	cfg.MaxArrayValues = dv.len
 	cfg.MaxStringLen = dv.len
-	dv.v, _ = evalScopedExpr(expr, cfg, true)
+	dv.v, _ = evalScopedExpr(expr, cfg, !dv.raw)
 	markChangedVariable(dv.v, oldv)
 
 	switch dv.v.Type {
@@ -324,6 +325,12 @@ func (dv *detailViewer) Update(container *nucular.Window) {
 			showing()
 			dv.stringUpdate(w)
 		} else {
+			if prettyprint.LookupTypeFormatter(dv.v.Type) != nil || conf.CustomFormatters[dv.v.Type] != nil {
+				w.Row(30).Static(0)
+				if w.CheckboxText("Raw value (ignore type formatter)", &dv.raw) {
+					dv.load(nil)
+				}
+			}
 			w.MenubarEnd()
 			showVariable(w, 0, newShowVariableFlags(dv.showAddr, dv.fullTypes)|showVariableAlwaysExpand, -1, dv.v)
 		}
@@ -4,6 +4,7 @@ require (
 	github.com/aarzilli/nucular v0.0.0-20250326143821-b95de069f8be
 	go.starlark.net v0.0.0-20200821142938-949cc6f4b097
 	golang.org/x/mobile v0.0.0-20231127183840-76ac6878050a
+	golang.org/x/sys v0.22.0
 )
 
 require (
@@ -20,7 +21,6 @@ require (
 	golang.org/x/exp v0.0.0-20240707233637-46b078467d37 // indirect
 	golang.org/x/exp/shiny v0.0.0-20240707233637-46b078467d37 // indirect
 	golang.org/x/image v0.18.0 // indirect
-	golang.org/x/sys v0.22.0 // indirect
 	golang.org/x/text v0.16.0 // indirect
 )
 
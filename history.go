@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const defaultHistorySize = 1000
+
+// historyPath is the file where the command history is saved, the history
+// is not saved if it is empty.
+var historyPath string
+
+// historyLoc returns the path of the history file, the history is kept in
+// the project directory if it exists.
+func historyLoc() string {
+	if fi, err := os.Stat(projectDir()); err == nil && fi.IsDir() {
+		return filepath.Join(projectDir(), "history")
+	}
+	return configLoc() + "-history"
+}
+
+// loadHistory reads the command history saved by previous sessions.
+func loadHistory() {
+	historyPath = historyLoc()
+	buf, err := os.ReadFile(historyPath)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(buf), "\n") {
+		if line != "" {
+			addHistoryEntry(line)
+		}
+	}
+}
+
+// addHistory adds cmd to the command history and saves it.
+func addHistory(cmd string) {
+	addHistoryEntry(cmd)
+	saveHistory()
+}
+
+// addHistoryEntry appends cmd to the command history, removing previous
+// occurrences of it and the oldest entries if the history is longer than
+// conf.HistorySize. The first entry of cmdhistory is always empty.
+func addHistoryEntry(cmd string) {
+	for i := 1; i < len(cmdhistory); i++ {
+		if cmdhistory[i] == cmd {
+			cmdhistory = append(cmdhistory[:i], cmdhistory[i+1:]...)
+			break
+		}
+	}
+	cmdhistory = append(cmdhistory, cmd)
+	size := conf.HistorySize
+	if size <= 0 {
+		size = defaultHistorySize
+	}
+	if n := len(cmdhistory) - 1 - size; n > 0 {
+		cmdhistory = append(cmdhistory[:1], cmdhistory[1+n:]...)
+	}
+}
+
+func saveHistory() {
+	if historyPath == "" {
+		return
+	}
+	var buf strings.Builder
+	for _, cmd := range cmdhistory[1:] {
+		buf.WriteString(cmd)
+		buf.WriteByte('\n')
+	}
+	os.MkdirAll(filepath.Dir(historyPath), 0755)
+	os.WriteFile(historyPath, []byte(buf.String()), 0600)
+}
+
+func historyCommand(out io.Writer, args string) error {
+	const (
+		searchPrefix = "search "
+		runPrefix    = "run "
+	)
+	wnd.Lock()
+	history := append([]string(nil), cmdhistory...)
+	wnd.Unlock()
+
+	switch {
+	case args == "":
+		for i := 1; i < len(history); i++ {
+			fmt.Fprintf(out, "%5d  %s\n", i, history[i])
+		}
+	case strings.HasPrefix(args, searchPrefix):
+		needle := strings.TrimSpace(args[len(searchPrefix):])
+		for i := 1; i < len(history); i++ {
+			if strings.Contains(history[i], needle) {
+				fmt.Fprintf(out, "%5d  %s\n", i, history[i])
+			}
+		}
+	case strings.HasPrefix(args, runPrefix):
+		n, err := strconv.Atoi(strings.TrimSpace(args[len(runPrefix):]))
+		if err != nil || n <= 0 || n >= len(history) {
+			return fmt.Errorf("invalid history entry %q", strings.TrimSpace(args[len(runPrefix):]))
+		}
+		cmd := history[n]
+		cmdname, _ := parseCommand(cmd)
+		if c := cmds.findCommand(cmdname); c != nil && c.aliases[0] == "history" {
+			return fmt.Errorf("can not run history commands from the history")
+		}
+		wnd.Lock()
+		addHistory(cmd)
+		historyShown = len(cmdhistory)
+		wnd.Unlock()
+		fmt.Fprintf(out, "%s %s\n", currentPrompt(), cmd)
+		executeCommand(cmd)
+	case args == "clear":
+		wnd.Lock()
+		cmdhistory = cmdhistory[:1]
+		historyShown = len(cmdhistory)
+		saveHistory()
+		wnd.Unlock()
+	default:
+		return fmt.Errorf("unknown argument %q", args)
+	}
+	return nil
+}
@@ -25,6 +25,7 @@ import (
 
 	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
 	"github.com/aarzilli/gdlv/internal/prettyprint"
+	"github.com/aarzilli/gdlv/internal/starbind"
 
 	"golang.org/x/mobile/event/mouse"
 )
@@ -1029,7 +1030,9 @@ func breakpointContextualMenu(w *nucular.Window) {
 				_, err := client.ClearBreakpoint(bp.ID)
 				if err != nil {
 					fmt.Fprintf(&scrollbackOut, "Could not clear breakpoint %d: %v\n", bp.ID, err)
+					continue
 				}
+				setStarlarkCond(bp.ID, "")
 			}
 			FrozenBreakpoints = nil
 			saveConfiguration()
@@ -1058,6 +1061,7 @@ func execRestartCheckpoint(id int, gid int64, where string) {
 		return
 	}
 	fmt.Fprintf(&scrollbackOut, "Process restarted from c%d %s\n", id, where)
+	callHook(starbind.OnRestartHook)
 	refreshState(refreshToFrameZero, clearStop, nil)
 }
 
@@ -1090,6 +1094,7 @@ type breakpointEditor struct {
 	printEditor   nucular.TextEditor
 	condEditor    nucular.TextEditor
 	hitCondEditor nucular.TextEditor
+	starlarkCond  bool
 }
 
 func openBreakpointEditor(mw nucular.MasterWindow, bp *api.Breakpoint) {
@@ -1103,6 +1108,10 @@ func openBreakpointEditor(mw nucular.MasterWindow, bp *api.Breakpoint) {
 
 	ed.condEditor.Flags = nucular.EditClipboard | nucular.EditSelectable | nucular.EditSigEnter
 	ed.condEditor.Buffer = []rune(ed.bp.Cond)
+	if cond := starlarkCond(bp.ID); cond != "" {
+		ed.condEditor.Buffer = []rune(cond)
+		ed.starlarkCond = true
+	}
 
 	ed.hitCondEditor.Flags = nucular.EditClipboard | nucular.EditSelectable | nucular.EditSigEnter
 	ed.hitCondEditor.Buffer = []rune(ed.bp.HitCond)
@@ -1169,8 +1178,15 @@ func (bped *breakpointEditor) update(w *nucular.Window) {
 
 	committed := false
 
-	w.Row(30).Static(100, 0)
+	w.Row(20).Static(100, 80, 80)
 	w.Label("Condition:", "LC")
+	if w.OptionText("Go", !bped.starlarkCond) {
+		bped.starlarkCond = false
+	}
+	if w.OptionText("Starlark", bped.starlarkCond) {
+		bped.starlarkCond = true
+	}
+	w.Row(30).Dynamic(1)
 	ev := bped.condEditor.Edit(w)
 	committed = committed || (ev&nucular.EditCommitted != 0)
 
@@ -1196,6 +1212,12 @@ func (bped *breakpointEditor) update(w *nucular.Window) {
 	}
 	if w.ButtonText("OK") || committed {
 		bped.bp.Cond = string(bped.condEditor.Buffer)
+		if bped.starlarkCond {
+			setStarlarkCond(bped.bp.ID, bped.bp.Cond)
+			bped.bp.Cond = ""
+		} else {
+			setStarlarkCond(bped.bp.ID, "")
+		}
 		bped.bp.HitCond = string(bped.hitCondEditor.Buffer)
 		bped.bp.Variables = bped.bp.Variables[:0]
 		for _, p := range strings.Split(string(bped.printEditor.Buffer), "\n") {
@@ -1218,6 +1240,7 @@ func (bped *breakpointEditor) amendBreakpoint() {
 		for i := range FrozenBreakpoints {
 			if FrozenBreakpoints[i].Bp.ID == bped.bp.ID {
 				FrozenBreakpoints[i].Bp = *bped.bp
+				FrozenBreakpoints[i].StarlarkCond = starlarkCond(bped.bp.ID)
 				saveConfiguration()
 				break
 			}
@@ -1491,9 +1514,9 @@ func abbrevFileName(path string) string {
 func breakpointIcon(w *nucular.Window, atbp, enabledbp bool, align label.Align, style *nstyle.Style) {
 	if atbp {
 		iconFace, style.Font = style.Font, iconFace
-		c := color.RGBA{0xff, 0x00, 0x00, 0xff}
+		c := breakpointColor
 		if !enabledbp {
-			c = color.RGBA{0x80, 0x00, 0x00, 0x80}
+			c = disabledBreakpointColor
 		}
 		w.LabelColored(breakpointIconChar, align, c)
 		iconFace, style.Font = style.Font, iconFace
@@ -1502,6 +1525,62 @@ func breakpointIcon(w *nucular.Window, atbp, enabledbp bool, align label.Align,
 	}
 }
 
+// listingSelection is a range of lines of the listing panel selected by
+// dragging the mouse over their text.
+type listingSelection struct {
+	start, end int  // first and last line selected, in the order they were selected
+	dragging   bool // the left mouse button is still down
+	moved      bool // the mouse moved away from where it was pressed, a click does not select anything
+}
+
+// update updates the selection with the mouse input for line lineno, whose
+// text is displayed in textbounds.
+func (sel *listingSelection) update(in *nucular.MouseInput, lineno int, textbounds, linebounds rect.Rect) {
+	if in.IsClickDownInRect(mouse.ButtonLeft, textbounds, true) {
+		*sel = listingSelection{start: lineno, end: lineno, dragging: true}
+	}
+	if !sel.dragging {
+		return
+	}
+	if !in.Down(mouse.ButtonLeft) {
+		sel.dragging = false
+		return
+	}
+	if in.Pos != in.Buttons[mouse.ButtonLeft].ClickedPos {
+		sel.moved = true
+	}
+	if in.HoveringRect(linebounds) {
+		sel.end = lineno
+	}
+}
+
+func (sel *listingSelection) lines() (first, last int) {
+	if !sel.moved {
+		return 0, -1
+	}
+	if sel.start <= sel.end {
+		return sel.start, sel.end
+	}
+	return sel.end, sel.start
+}
+
+func (sel *listingSelection) contains(lineno int) bool {
+	first, last := sel.lines()
+	return lineno >= first && lineno <= last
+}
+
+// listingSelectedText returns the text of the lines selected in the listing
+// panel.
+func listingSelectedText() string {
+	var r []string
+	for _, line := range listingPanel.listing {
+		if listingPanel.sel.contains(line.lineno) {
+			r = append(r, line.textWithTabs)
+		}
+	}
+	return strings.Join(r, "\n")
+}
+
 func updateListingPanel(container *nucular.Window) {
 	if len(listingPanel.listing) == 0 {
 		updateDisassemblyPanel(container)
@@ -1542,6 +1621,10 @@ func updateListingPanel(container *nucular.Window) {
 		centerlineBounds.X = listp.Bounds.X
 		centerlineBounds.W = listp.Bounds.W
 
+		if listingPanel.sel.contains(line.lineno) {
+			listp.Commands().FillRect(centerlineBounds, 0, style.Selectable.HoverActive.Data.Color)
+		}
+
 		if centerline {
 			cmds := listp.Commands()
 			cmds.FillRect(centerlineBounds, 0, style.Selectable.PressedActive.Data.Color)
@@ -1559,10 +1642,19 @@ func updateListingPanel(container *nucular.Window) {
 		isCurrentLine := line.pc && curFrame == 0 && curDeferredCall == 0 && !client.Running() && curThread >= 0
 
 		listp.LayoutSetWidth(arroww)
+		test, isTest := listingPanel.tests[line.lineno]
+		isTest = isTest && BackendServer.isTest()
 		if isCurrentLine {
 			iconFace, style.Font = style.Font, iconFace
-			listp.LabelColored(arrowIconChar, "CC", color.RGBA{0xff, 0xff, 0x00, 0xff})
+			listp.LabelColored(arrowIconChar, "CC", currentLineColor)
+			iconFace, style.Font = style.Font, iconFace
+		} else if isTest && !client.Running() {
 			iconFace, style.Font = style.Font, iconFace
+			listp.LabelColored(runTestIconChar, "CC", linkColor)
+			iconFace, style.Font = style.Font, iconFace
+			if listp.Input().Mouse.IsClickInRect(mouse.ButtonLeft, listp.LastWidgetBounds) {
+				debugListingTest(test)
+			}
 		} else {
 			listp.Spacing(1)
 		}
@@ -1578,6 +1670,8 @@ func updateListingPanel(container *nucular.Window) {
 		listp.LabelColored(line.text, "LC", textColor)
 		textbounds := listp.LastWidgetBounds
 
+		listingPanel.sel.update(&listp.Input().Mouse, line.lineno, textbounds, centerlineBounds)
+
 		if centerline && listingPanel.recenterListing {
 			listingPanel.recenterListing = false
 			gl.Center()
@@ -1638,6 +1732,11 @@ func updateListingPanel(container *nucular.Window) {
 						go listingSetBreakpoint(listingPanel.file, line.lineno)
 					}
 				}
+				if isTest {
+					if w.MenuItem(label.TA("Debug this test", "LC")) {
+						debugListingTest(test)
+					}
+				}
 				if isCurrentLine {
 					if listingPanel.stepIntoInfo.Valid {
 						if w.MenuItem(label.TA(listingPanel.stepIntoInfo.Msg, "LC")) {
@@ -1653,14 +1752,18 @@ func updateListingPanel(container *nucular.Window) {
 		}
 
 		// Breakpoint Info
-		if line.bp != nil && (line.bp.Cond != "" || line.bp.HitCond != "" || len(line.bp.Variables) > 0) {
+		if line.bp != nil && (line.bp.Cond != "" || line.bp.HitCond != "" || len(line.bp.Variables) > 0 || starlarkCond(line.bp.ID) != "") {
 			listp.Row(lineheight).Static(0)
 			bpcolor := style.Text.Color
 			darken(&bpcolor)
 			var bpinfo bytes.Buffer
 			fmt.Fprintf(&bpinfo, "// ")
-			if line.bp.Cond != "" {
-				fmt.Fprintf(&bpinfo, "when %s ", line.bp.Cond)
+			cond := line.bp.Cond
+			if scond := starlarkCond(line.bp.ID); scond != "" {
+				cond = "starlark " + scond
+			}
+			if cond != "" {
+				fmt.Fprintf(&bpinfo, "when %s ", cond)
 				if line.bp.HitCond != "" {
 					fmt.Fprintf(&bpinfo, " AND hitcount %s ", line.bp.HitCond)
 				}
@@ -1814,7 +1917,7 @@ func updateDisassemblyPanel(container *nucular.Window) {
 
 		if instr.AtPC {
 			iconFace, style.Font = style.Font, iconFace
-			listp.LabelColored(arrowIconChar, "CC", color.RGBA{0xff, 0xff, 0x00, 0xff})
+			listp.LabelColored(arrowIconChar, "CC", currentLineColor)
 			iconFace, style.Font = style.Font, iconFace
 		} else {
 			listp.Label(" ", "LC")
@@ -59,6 +59,8 @@ type Variable struct {
 	customFormat   bool // custom value
 	requestedLines int  // number of lines needed to display the value of the variable
 
+	synthetic []prettyprint.SyntheticChild // children defined by a type formatter, loaded when the variable is expanded
+
 	Children []*Variable
 
 	ed   *nucular.TextEditor
@@ -120,8 +122,23 @@ func wrapApiVariable(fnname string, v *api.Variable, name, expr string, customFo
 		}
 	} else if f := conf.CustomFormatters[v.Type]; f != nil && customFormatters && depth < 10 {
 		f.Format(r)
-	} else if v.Type == "time.Time" {
-		r.Value = formatTime(v)
+	} else if pretty, ok := prettyprint.Pretty(v); ok {
+		r.Value = pretty
+	}
+
+	if customFormatters && depth < 10 && v.Kind == reflect.Struct {
+		if tf := prettyprint.LookupTypeFormatter(v.Type); tf != nil {
+			// synthetic children are loaded later using the current scope,
+			// use an address based expression when possible so that they
+			// also work for variables evaluated in a different scope.
+			texpr := expr
+			if v.Addr != 0 {
+				texpr = fmt.Sprintf("(*(*%q)(%#x))", v.Type, v.Addr)
+			}
+			if r.synthetic = tf.ChildExprs(v, texpr); r.synthetic != nil {
+				r.Children = nil
+			}
+		}
 	}
 
 	r.sfmt = sfmt
@@ -132,54 +149,6 @@ func wrapApiVariable(fnname string, v *api.Variable, name, expr string, customFo
 	return r
 }
 
-func formatTime(v *api.Variable) string {
-	const (
-		timeTimeWallHasMonotonicBit uint64        = (1 << 63)                                                  // hasMonotonic bit of time.Time.wall
-		maxAddSeconds               time.Duration = (time.Duration(^uint64(0)>>1) / time.Second) * time.Second // maximum number of seconds that can be added with (time.Time).Add, measured in nanoseconds
-		wallNsecShift                             = 30                                                         // size of the nanoseconds field of time.Time.wall
-		unixTimestampOfWallEpoch                  = -2682288000                                                // number of seconds between the unix epoch and the epoch for time.Time.wall (1 jan 1885)
-	)
-
-	wallv := fieldVariable(v, "wall")
-	extv := fieldVariable(v, "ext")
-	if wallv == nil || extv == nil || wallv.Unreadable != "" || extv.Unreadable != "" || wallv.Value == "" || extv.Value == "" {
-		return v.Value
-	}
-	wall, err1 := strconv.ParseUint(wallv.Value, 10, 64)
-	ext, err2 := strconv.ParseInt(extv.Value, 10, 64)
-	if err1 != nil || err2 != nil {
-		return v.Value
-	}
-	_ = ext
-	hasMonotonic := (wall & timeTimeWallHasMonotonicBit) != 0
-	if hasMonotonic {
-		// the 33-bit field of wall holds a 33-bit unsigned wall
-		// seconds since Jan 1 year 1885, and ext holds a signed 64-bit monotonic
-		// clock reading, nanoseconds since process start
-		sec := int64(wall << 1 >> (wallNsecShift + 1)) // seconds since 1 Jan 1885
-		t := time.Unix(sec+unixTimestampOfWallEpoch, 0).UTC()
-		return fmt.Sprintf("time.Time(%s, %+d)", t.Format(time.RFC3339), ext)
-	} else {
-		// the full signed 64-bit wall seconds since Jan 1 year 1 is stored in ext
-		var t time.Time
-		for ext > int64(maxAddSeconds/time.Second) {
-			t = t.Add(maxAddSeconds)
-			ext -= int64(maxAddSeconds / time.Second)
-		}
-		t = t.Add(time.Duration(ext) * time.Second)
-		return t.Format(time.RFC3339)
-	}
-}
-
-func fieldVariable(v *api.Variable, name string) *api.Variable {
-	for i := range v.Children {
-		if v.Children[i].Name == name {
-			return &v.Children[i]
-		}
-	}
-	return nil
-}
-
 func wrapApiVariables(fnname string, vs []api.Variable, kind reflect.Kind, start int, expr string, customFormatters bool, sfmt *prettyprint.SimpleFormat, depth int) []*Variable {
 	r := make([]*Variable, 0, len(vs))
 
@@ -934,7 +903,7 @@ func showVariable(w *nucular.Window, depth int, flags showVariableFlags, exprMen
 		return
 	}
 
-	if depth > 0 && v.Addr == 0 {
+	if depth > 0 && v.Addr == 0 && v.Value == "" {
 		cblbl("nil")
 		return
 	}
@@ -988,7 +957,14 @@ func showVariable(w *nucular.Window, depth int, flags showVariableFlags, exprMen
 		}
 	case reflect.Struct:
 		if hdr() {
-			if int(v.Len) != len(v.Children) && len(v.Children) == 0 {
+			if v.synthetic != nil {
+				if v.Children == nil {
+					loadSyntheticChildren(v)
+					dynlbl("Loading...")
+				} else {
+					showStructContents(w, depth, flags, v)
+				}
+			} else if int(v.Len) != len(v.Children) && len(v.Children) == 0 {
 				loadMoreStruct(v)
 				dynlbl("Loading...")
 			} else {
@@ -1133,6 +1109,10 @@ func showInterfaceContents(w *nucular.Window, depth int, flags showVariableFlags
 		data = data.Children[0]
 	}
 
+	if v.Type == "error" {
+		showErrorChain(w, depth, flags, v)
+	}
+
 	switch data.Kind {
 	case reflect.Struct:
 		showStructContents(w, depth, flags, data)
@@ -1143,6 +1123,79 @@ func showInterfaceContents(w *nucular.Window, depth int, flags showVariableFlags
 	}
 }
 
+// unwrapErrors returns the errors wrapped by the error interface v, i.e.
+// the non-nil fields of its concrete value that have type error or []error.
+// This mirrors what the Unwrap methods of the standard library do.
+func unwrapErrors(v *Variable) []*Variable {
+	if v.Kind != reflect.Interface || len(v.Children) == 0 {
+		return nil
+	}
+	data := v.Children[0]
+	if data.OnlyAddr {
+		return nil
+	}
+	if data.Kind == reflect.Ptr {
+		if len(data.Children) == 0 || data.Children[0].OnlyAddr {
+			return nil
+		}
+		data = data.Children[0]
+	}
+	if data.Kind != reflect.Struct {
+		return nil
+	}
+	isErr := func(v *Variable) bool {
+		return v.Kind == reflect.Interface && len(v.Children) > 0 && v.Children[0].Kind != reflect.Invalid
+	}
+	var r []*Variable
+	for _, field := range data.Children {
+		switch field.Type {
+		case "error":
+			if isErr(field) {
+				r = append(r, field)
+			}
+		case "[]error":
+			for _, e := range field.Children {
+				if isErr(e) {
+					r = append(r, e)
+				}
+			}
+		}
+	}
+	return r
+}
+
+// showErrorChain shows the errors wrapped by v, each one as a node with its
+// concrete type and message.
+func showErrorChain(w *nucular.Window, depth int, flags showVariableFlags, v *Variable) {
+	wrapped := unwrapErrors(v)
+	if len(wrapped) == 0 || depth >= 10 {
+		return
+	}
+	w.Row(varRowHeight).Dynamic(1)
+	if !w.TreePush(nucular.TreeNode, "Wraps", true) {
+		return
+	}
+	for i, e := range wrapped {
+		title := e.Children[0].Type
+		msg, ok := prettyprint.ErrorMessage(e.Variable)
+		if ok {
+			title = fmt.Sprintf("%s: %s", title, strings.Replace(msg, "\n", "; ", -1))
+		}
+		w.Row(varRowHeight).Dynamic(1)
+		if w.TreePushNamed(nucular.TreeNode, fmt.Sprintf("err%d", i), title, false) {
+			if !ok && e.Expression != "" && client != nil && !client.Running() {
+				w.Row(varRowHeight).Static(150)
+				if w.ButtonText("Call Error()") {
+					doCommand(fmt.Sprintf("call %s.Error()", e.Expression))
+				}
+			}
+			showInterfaceContents(w, depth+1, flags, -1, e)
+			w.TreePop()
+		}
+	}
+	w.TreePop()
+}
+
 var additionalLoadMu sync.Mutex
 var additionalLoadRunning bool
 
@@ -1213,6 +1266,36 @@ func loadMoreStruct(v *Variable) {
 	}
 }
 
+// loadSyntheticChildren evaluates the expressions of the synthetic children
+// of v.
+func loadSyntheticChildren(v *Variable) {
+	if !additionalLoadRunning {
+		additionalLoadRunning = true
+		go func() {
+			children := make([]*Variable, 0, len(v.synthetic))
+			for _, c := range v.synthetic {
+				var lv *api.Variable
+				if c.Expr == "" {
+					lv = &api.Variable{Name: c.Name, Unreadable: "could not compute expression"}
+				} else {
+					var err error
+					lv, err = client.EvalVariable(currentEvalScope(), c.Expr, getVariableLoadConfig())
+					if err != nil {
+						lv = &api.Variable{Name: c.Name, Unreadable: err.Error()}
+					}
+				}
+				lv.Name = c.Name
+				children = append(children, wrapApiVariable("", lv, c.Name, c.Expr, true, nil, 1))
+			}
+			v.Children = children
+			wnd.Changed()
+			additionalLoadMu.Lock()
+			additionalLoadRunning = false
+			additionalLoadMu.Unlock()
+		}()
+	}
+}
+
 func configureLoadParameters(exprMenuIdx int) func(w *nucular.Window) {
 	expr := &localsPanel.expressions[exprMenuIdx]
 	maxArrayValues := expr.maxArrayValues
@@ -1292,8 +1375,16 @@ func markChangedVariable(newvar *Variable, oldvar *Variable) {
 	}
 }
 
+// changedVariableBaseColor is the color used to highlight changed
+// variables, faded according to changedVariableOpacity.
+var changedVariableBaseColor = color.RGBA{0xff, 0x00, 0x00, 0xff}
+
 func changedVariableColor() color.RGBA {
-	return color.RGBA{changedVariableOpacity, 0, 0, changedVariableOpacity}
+	fade := func(x uint8) uint8 {
+		return uint8(uint16(x) * uint16(changedVariableOpacity) / 0xff)
+	}
+	c := changedVariableBaseColor
+	return color.RGBA{fade(c.R), fade(c.G), fade(c.B), fade(c.A)}
 }
 
 func goDocCommand(typ string) {
@@ -1377,6 +1468,10 @@ func handleKeyboardVar(w *nucular.Window, ed *richtext.RichText, exprMenu *int)
 var perFrameRichTextGroup = &richtext.SelectionGroup{}
 var perFrameRichTextMap = map[*api.Variable]*perFrameRichText{}
 
+// perFrameRichTextSelected is the editor of the variables panel where the
+// user last selected something.
+var perFrameRichTextSelected *richtext.RichText
+
 type perFrameRichText struct {
 	used  bool
 	ed    *richtext.RichText
@@ -1394,6 +1489,9 @@ func richTextLookup(v *api.Variable, wrap bool, flags showVariableFlags) (*richt
 		pfrt.ed.Group = perFrameRichTextGroup
 		perFrameRichTextMap[v] = pfrt
 	}
+	if pfrt.ed.Events&richtext.Active != 0 && pfrt.ed.Sel.S != pfrt.ed.Sel.E {
+		perFrameRichTextSelected = pfrt.ed
+	}
 	changed := pfrt.flags != flags
 	pfrt.flags = flags
 	pfrt.used = true
@@ -1403,6 +1501,9 @@ func richTextLookup(v *api.Variable, wrap bool, flags showVariableFlags) (*richt
 func richTextCleanup() {
 	for k, pfrt := range perFrameRichTextMap {
 		if !pfrt.used {
+			if pfrt.ed == perFrameRichTextSelected {
+				perFrameRichTextSelected = nil
+			}
 			delete(perFrameRichTextMap, k)
 		}
 	}
@@ -1440,9 +1541,14 @@ func exprEditReplace(exprMenuIdx int, exprSel, sel richtext.Sel, str *string) bo
 		} else {
 			completeAddVariables(&cm)
 		}
-		cm.finish(func(s string) {
-			*str = s
-			expr = expr[:sel.S] + s + expr[sel.E:]
+		cm.finish(func(n int, s string) {
+			// the expression is replaced below, richtext only uses the
+			// length of *str to move the cursor
+			*str = ""
+			if n < len(s) {
+				*str = s[n:]
+			}
+			expr = expr[:int(sel.S)-n] + s + expr[sel.E:]
 		}, nil)
 		if *str == "\t" {
 			return false
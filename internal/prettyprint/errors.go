@@ -0,0 +1,164 @@
+package prettyprint
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
+)
+
+func init() {
+	Register("error", formatError)
+}
+
+func formatError(v *api.Variable) string {
+	if v.Kind == reflect.Interface && len(v.Children) > 0 && v.Children[0].Kind == reflect.Invalid {
+		// nil error
+		return ""
+	}
+	msg, ok := ErrorMessage(v)
+	if !ok {
+		return ""
+	}
+	return strconv.Quote(msg)
+}
+
+// ErrorData returns the concrete value stored in the error interface v,
+// following the pointer if it's a pointer. Returns nil if the value wasn't
+// loaded.
+func ErrorData(v *api.Variable) *api.Variable {
+	if v.Kind != reflect.Interface || len(v.Children) == 0 {
+		return nil
+	}
+	data := &v.Children[0]
+	if data.OnlyAddr {
+		return nil
+	}
+	if data.Kind == reflect.Ptr {
+		if len(data.Children) == 0 || data.Children[0].OnlyAddr {
+			return nil
+		}
+		return &data.Children[0]
+	}
+	return data
+}
+
+// ErrorMessage returns the value that the Error method of the error
+// interface v would return, for the error types of the standard library
+// with a known layout.
+func ErrorMessage(v *api.Variable) (string, bool) {
+	return errorMessage(v, 0)
+}
+
+func errorMessage(v *api.Variable, depth int) (string, bool) {
+	const maxDepth = 20
+	if depth > maxDepth {
+		return "", false
+	}
+	if v.Kind == reflect.Interface && len(v.Children) > 0 && v.Children[0].Kind == reflect.Invalid {
+		return "<nil>", true
+	}
+	data := ErrorData(v)
+	if data == nil {
+		return "", false
+	}
+
+	str := func(name string) (string, bool) {
+		f := field(data, name)
+		if f == nil || f.Kind != reflect.String {
+			return "", false
+		}
+		if int64(len(f.Value)) < f.Len {
+			return f.Value + "...", true
+		}
+		return f.Value, true
+	}
+	strs := func(names ...string) ([]string, bool) {
+		r := make([]string, len(names))
+		for i, name := range names {
+			var ok bool
+			r[i], ok = str(name)
+			if !ok {
+				return nil, false
+			}
+		}
+		return r, true
+	}
+	wrapped := func(s []string, ok bool) (string, bool) {
+		if !ok {
+			return "", false
+		}
+		err := field(data, "Err")
+		if err == nil {
+			return "", false
+		}
+		msg, ok := errorMessage(err, depth+1)
+		if !ok {
+			return "", false
+		}
+		return strings.Join(append(s, msg), ""), true
+	}
+
+	switch v.Children[0].Type {
+	case "*errors.errorString":
+		return str("s")
+	case "*fmt.wrapError", "*fmt.wrapErrors":
+		return str("msg")
+	case "*errors.joinError":
+		errs := field(data, "errs")
+		if errs == nil || int64(len(errs.Children)) != errs.Len {
+			return "", false
+		}
+		msgs := make([]string, len(errs.Children))
+		for i := range errs.Children {
+			var ok bool
+			msgs[i], ok = errorMessage(&errs.Children[i], depth+1)
+			if !ok {
+				return "", false
+			}
+		}
+		return strings.Join(msgs, "\n"), true
+	case "*io/fs.PathError":
+		s, ok := strs("Op", "Path")
+		if ok {
+			s = []string{s[0], " ", s[1], ": "}
+		}
+		return wrapped(s, ok)
+	case "*os.SyscallError":
+		s, ok := strs("Syscall")
+		if ok {
+			s = append(s, ": ")
+		}
+		return wrapped(s, ok)
+	case "*os.LinkError":
+		s, ok := strs("Op", "Old", "New")
+		if ok {
+			s = []string{s[0], " ", s[1], " ", s[2], ": "}
+		}
+		return wrapped(s, ok)
+	case "*net/url.Error":
+		s, ok := strs("Op", "URL")
+		if ok {
+			s = []string{fmt.Sprintf("%s %q: ", s[0], s[1])}
+		}
+		return wrapped(s, ok)
+	case "*strconv.NumError":
+		s, ok := strs("Func", "Num")
+		if ok {
+			s = []string{fmt.Sprintf("strconv.%s: parsing %q: ", s[0], s[1])}
+		}
+		return wrapped(s, ok)
+	case "syscall.Errno":
+		n, err := strconv.ParseUint(data.Value, 10, 64)
+		if err != nil {
+			return "", false
+		}
+		return syscall.Errno(n).Error(), true
+	case "context.deadlineExceededError":
+		return "context deadline exceeded", true
+	}
+	return "", false
+}
@@ -100,6 +100,11 @@ func writeTo(v *api.Variable, ctx *context, flags ppFlags, indent string) {
 		return
 	}
 
+	if s, ok := Pretty(v); ok {
+		ctx.buf.Write([]byte(s))
+		return
+	}
+
 	if !flags.top() && v.Addr == 0 && v.Value == "" {
 		if flags.includeType() && v.Type != "void" {
 			fmt.Fprintf(ctx.buf, "%s nil", getDisplayType(v, flags.fullTypes()))
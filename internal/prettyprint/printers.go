@@ -0,0 +1,112 @@
+package prettyprint
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
+)
+
+// Printer returns a human readable representation of v, or the empty string
+// if v can not be formatted (for example because it wasn't loaded
+// completely).
+type Printer func(v *api.Variable) string
+
+var printers = map[string]Printer{}
+var printersMu sync.Mutex
+
+// Register registers p as the pretty-printer for variables of type typ,
+// replacing any printer previously registered for typ. Registering a nil
+// printer removes it.
+func Register(typ string, p Printer) {
+	printersMu.Lock()
+	defer printersMu.Unlock()
+	if p == nil {
+		delete(printers, typ)
+		return
+	}
+	printers[typ] = p
+}
+
+// Pretty returns the representation of v produced by the type formatter
+// or the pretty-printer registered for its type.
+func Pretty(v *api.Variable) (string, bool) {
+	if v.Unreadable != "" {
+		return "", false
+	}
+	if tf := LookupTypeFormatter(v.Type); tf != nil {
+		if s, ok := tf.Format(v); ok {
+			return s, true
+		}
+	}
+	printersMu.Lock()
+	p := printers[v.Type]
+	printersMu.Unlock()
+	if p == nil {
+		return "", false
+	}
+	s := p(v)
+	return s, s != ""
+}
+
+// field returns the field of v reached by following path, embedded structs
+// are searched automatically. Returns nil if the field doesn't exist or is
+// unreadable.
+func field(v *api.Variable, path ...string) *api.Variable {
+	for _, name := range path {
+		v = findField(v, name)
+		if v == nil || v.Unreadable != "" {
+			return nil
+		}
+	}
+	return v
+}
+
+func findField(v *api.Variable, name string) *api.Variable {
+	for i := range v.Children {
+		if v.Children[i].Name == name {
+			return &v.Children[i]
+		}
+	}
+	for i := range v.Children {
+		child := &v.Children[i]
+		if child.Kind == reflect.Struct && child.Name == typeBaseName(child.Type) {
+			// embedded field
+			if r := findField(child, name); r != nil {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+// typeBaseName returns the name of typ without its package path.
+func typeBaseName(typ string) string {
+	if i := strings.LastIndex(typ, "."); i >= 0 {
+		return typ[i+1:]
+	}
+	return typ
+}
+
+// intField returns the value of the integer field of v reached by following path.
+func intField(v *api.Variable, path ...string) (int64, bool) {
+	f := field(v, path...)
+	if f == nil {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(f.Value, 10, 64)
+	return n, err == nil
+}
+
+// uintField returns the value of the unsigned integer field of v reached by
+// following path.
+func uintField(v *api.Variable, path ...string) (uint64, bool) {
+	f := field(v, path...)
+	if f == nil {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(f.Value, 10, 64)
+	return n, err == nil
+}
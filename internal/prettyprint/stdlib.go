@@ -0,0 +1,530 @@
+package prettyprint
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
+)
+
+func init() {
+	Register("time.Time", formatTime)
+	Register("time.Duration", formatDuration)
+	Register("math/big.Int", formatBigInt)
+	Register("math/big.Float", formatBigFloat)
+	Register("math/big.Rat", formatBigRat)
+	Register("net.IP", formatIP)
+	Register("net/netip.Addr", formatNetipAddr)
+	Register("net/netip.Prefix", formatNetipPrefix)
+	Register("net/url.URL", formatURL)
+	Register("sync.Mutex", formatMutex)
+	Register("sync.RWMutex", formatRWMutex)
+	Register("sync.WaitGroup", formatWaitGroup)
+	for _, typ := range []string{"Int32", "Int64", "Uint32", "Uint64", "Uintptr"} {
+		Register("sync/atomic."+typ, formatAtomicInt)
+	}
+	Register("sync/atomic.Bool", formatAtomicBool)
+	Register("strings.Builder", formatStringsBuilder)
+	Register("bytes.Buffer", formatBytesBuffer)
+	Register("context.Context", formatContext)
+}
+
+func formatTime(v *api.Variable) string {
+	const (
+		timeTimeWallHasMonotonicBit uint64        = (1 << 63)                                                  // hasMonotonic bit of time.Time.wall
+		maxAddSeconds               time.Duration = (time.Duration(^uint64(0)>>1) / time.Second) * time.Second // maximum number of seconds that can be added with (time.Time).Add, measured in nanoseconds
+		wallNsecShift                             = 30                                                         // size of the nanoseconds field of time.Time.wall
+		unixTimestampOfWallEpoch                  = -2682288000                                                // number of seconds between the unix epoch and the epoch for time.Time.wall (1 jan 1885)
+	)
+
+	wall, ok1 := uintField(v, "wall")
+	ext, ok2 := intField(v, "ext")
+	if !ok1 || !ok2 {
+		return ""
+	}
+	hasMonotonic := (wall & timeTimeWallHasMonotonicBit) != 0
+	if hasMonotonic {
+		// the 33-bit field of wall holds a 33-bit unsigned wall
+		// seconds since Jan 1 year 1885, and ext holds a signed 64-bit monotonic
+		// clock reading, nanoseconds since process start
+		sec := int64(wall << 1 >> (wallNsecShift + 1)) // seconds since 1 Jan 1885
+		t := time.Unix(sec+unixTimestampOfWallEpoch, 0).UTC()
+		return fmt.Sprintf("time.Time(%s, %+d)", t.Format(time.RFC3339), ext)
+	} else {
+		// the full signed 64-bit wall seconds since Jan 1 year 1 is stored in ext
+		var t time.Time
+		for ext > int64(maxAddSeconds/time.Second) {
+			t = t.Add(maxAddSeconds)
+			ext -= int64(maxAddSeconds / time.Second)
+		}
+		t = t.Add(time.Duration(ext) * time.Second)
+		return t.Format(time.RFC3339)
+	}
+}
+
+func formatDuration(v *api.Variable) string {
+	n, err := strconv.ParseInt(v.Value, 10, 64)
+	if err != nil {
+		return ""
+	}
+	return time.Duration(n).String()
+}
+
+// bytesOf returns the contents of v, which must be a slice or array of
+// bytes. Returns false if v wasn't loaded completely.
+func bytesOf(v *api.Variable) ([]byte, bool) {
+	if v == nil || (v.Kind != reflect.Slice && v.Kind != reflect.Array) || int64(len(v.Children)) != v.Len {
+		return nil, false
+	}
+	r := make([]byte, len(v.Children))
+	for i := range v.Children {
+		n, err := strconv.ParseUint(v.Children[i].Value, 10, 8)
+		if err != nil {
+			return nil, false
+		}
+		r[i] = byte(n)
+	}
+	return r, true
+}
+
+// natOf converts v, a math/big.nat, into a big.Int.
+func natOf(v *api.Variable) (*big.Int, bool) {
+	if v == nil || int64(len(v.Children)) != v.Len {
+		return nil, false
+	}
+	bits := wordBits(v)
+	r := new(big.Int)
+	for i := len(v.Children) - 1; i >= 0; i-- {
+		w, err := strconv.ParseUint(v.Children[i].Value, 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		r.Lsh(r, bits)
+		r.Or(r, new(big.Int).SetUint64(w))
+	}
+	return r, true
+}
+
+// wordBits returns the size in bits of a math/big.Word in the target,
+// given v, a math/big.nat. The size is the distance between the first two
+// words, if v has only one word it is 64 if its value does not fit in 32
+// bits (which is always the case for the normalized mantissa of a big.Float
+// on 64bit targets) and 32 otherwise (which does not matter for big.Int).
+func wordBits(v *api.Variable) uint {
+	if len(v.Children) >= 2 {
+		if d := v.Children[1].Addr - v.Children[0].Addr; d == 4 || d == 8 {
+			return uint(d * 8)
+		}
+	}
+	for i := range v.Children {
+		if w, err := strconv.ParseUint(v.Children[i].Value, 10, 64); err == nil && w > math.MaxUint32 {
+			return 64
+		}
+	}
+	return 32
+}
+
+func bigInt(v *api.Variable) (*big.Int, bool) {
+	abs, ok := natOf(field(v, "abs"))
+	if !ok {
+		return nil, false
+	}
+	if neg := field(v, "neg"); neg != nil && neg.Value == "true" {
+		abs.Neg(abs)
+	}
+	return abs, true
+}
+
+func formatBigInt(v *api.Variable) string {
+	n, ok := bigInt(v)
+	if !ok {
+		return ""
+	}
+	return n.String()
+}
+
+func formatBigFloat(v *api.Variable) string {
+	const (
+		formZero = iota
+		formFinite
+		formInf
+	)
+	form, ok1 := uintField(v, "form")
+	prec, ok2 := uintField(v, "prec")
+	exp, ok3 := intField(v, "exp")
+	neg := field(v, "neg")
+	if !ok1 || !ok2 || !ok3 || neg == nil {
+		return ""
+	}
+	f := new(big.Float)
+	switch form {
+	case formZero:
+		// nothing to do
+	case formInf:
+		f.SetInf(false)
+	case formFinite:
+		mantv := field(v, "mant")
+		mant, ok := natOf(mantv)
+		if !ok {
+			return ""
+		}
+		f.SetPrec(uint(prec))
+		f.SetInt(mant)
+		f.SetMantExp(f, int(exp)-int(wordBits(mantv))*len(mantv.Children))
+	default:
+		return ""
+	}
+	if neg.Value == "true" {
+		f.Neg(f)
+	}
+	return f.Text('g', -1)
+}
+
+func formatBigRat(v *api.Variable) string {
+	a, ok1 := bigInt(field(v, "a"))
+	b, ok2 := bigInt(field(v, "b"))
+	if !ok1 || !ok2 {
+		return ""
+	}
+	if b.Sign() == 0 {
+		b.SetInt64(1)
+	}
+	return new(big.Rat).SetFrac(a, b).RatString()
+}
+
+func formatIP(v *api.Variable) string {
+	b, ok := bytesOf(v)
+	if !ok {
+		return ""
+	}
+	if len(b) == 0 {
+		return "<nil>"
+	}
+	return net.IP(b).String()
+}
+
+func netipAddr(v *api.Variable) (netip.Addr, bool) {
+	hi, ok1 := uintField(v, "addr", "hi")
+	lo, ok2 := uintField(v, "addr", "lo")
+	z := field(v, "z")
+	if !ok1 || !ok2 || z == nil {
+		return netip.Addr{}, false
+	}
+	if z.Kind == reflect.Struct {
+		// since Go 1.23 z is an unique.Handle[addrDetail]
+		z = field(z, "value")
+		if z == nil {
+			return netip.Addr{}, false
+		}
+	}
+	if len(z.Children) == 0 || z.Children[0].Addr == 0 {
+		// the zero Addr
+		return netip.Addr{}, true
+	}
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], hi)
+	binary.BigEndian.PutUint64(b[8:], lo)
+	addr := netip.AddrFrom16(b)
+
+	detail := &z.Children[0]
+	isV6 := field(detail, "isV6")
+	if isV6 == nil {
+		// detail wasn't loaded, guess
+		return addr.Unmap(), true
+	}
+	if isV6.Value != "true" {
+		return addr.Unmap(), true
+	}
+	if zone := field(detail, "zoneV6"); zone != nil && zone.Value != "" {
+		addr = addr.WithZone(zone.Value)
+	}
+	return addr, true
+}
+
+func formatNetipAddr(v *api.Variable) string {
+	addr, ok := netipAddr(v)
+	if !ok {
+		return ""
+	}
+	return addr.String()
+}
+
+func formatNetipPrefix(v *api.Variable) string {
+	ipv := field(v, "ip")
+	if ipv == nil {
+		return ""
+	}
+	addr, ok := netipAddr(ipv)
+	if !ok {
+		return ""
+	}
+	if bits, ok := uintField(v, "bitsPlusOne"); ok {
+		if bits == 0 {
+			return "invalid Prefix"
+		}
+		return fmt.Sprintf("%s/%d", addr, bits-1)
+	}
+	if bits, ok := intField(v, "bits"); ok {
+		// before Go 1.22
+		if bits < 0 {
+			return "invalid Prefix"
+		}
+		return fmt.Sprintf("%s/%d", addr, bits)
+	}
+	return ""
+}
+
+func formatURL(v *api.Variable) string {
+	str := func(name string) string {
+		if f := field(v, name); f != nil {
+			return f.Value
+		}
+		return ""
+	}
+	boolean := func(name string) bool {
+		f := field(v, name)
+		return f != nil && f.Value == "true"
+	}
+	u := &url.URL{
+		Scheme:      str("Scheme"),
+		Opaque:      str("Opaque"),
+		Host:        str("Host"),
+		Path:        str("Path"),
+		RawPath:     str("RawPath"),
+		OmitHost:    boolean("OmitHost"),
+		ForceQuery:  boolean("ForceQuery"),
+		RawQuery:    str("RawQuery"),
+		Fragment:    str("Fragment"),
+		RawFragment: str("RawFragment"),
+	}
+	if user := field(v, "User"); user != nil && len(user.Children) > 0 && user.Children[0].Addr != 0 {
+		username := field(&user.Children[0], "username")
+		if username == nil {
+			return ""
+		}
+		if set := field(&user.Children[0], "passwordSet"); set != nil && set.Value == "true" {
+			u.User = url.UserPassword(username.Value, "xxxxx")
+		} else {
+			u.User = url.User(username.Value)
+		}
+	}
+	return u.String()
+}
+
+const (
+	mutexLocked      = 1 << iota // mutex is locked
+	mutexWoken                   // a goroutine was woken
+	mutexStarving                // mutex is in starvation mode
+	mutexWaiterShift = iota      // number of bits used for flags in state
+)
+
+// mutexState returns the state field of the sync.Mutex v.
+func mutexState(v *api.Variable) (int64, bool) {
+	if state, ok := intField(v, "mu", "state"); ok {
+		// since Go 1.24 sync.Mutex wraps internal/sync.Mutex
+		return state, true
+	}
+	return intField(v, "state")
+}
+
+func waiters(n int64, what string) string {
+	if n == 1 {
+		return "1 " + what
+	}
+	return fmt.Sprintf("%d %ss", n, what)
+}
+
+func formatMutex(v *api.Variable) string {
+	state, ok := mutexState(v)
+	if !ok {
+		return ""
+	}
+	var r []string
+	if state&mutexLocked != 0 {
+		r = append(r, "locked")
+	} else {
+		r = append(r, "unlocked")
+	}
+	if state&mutexStarving != 0 {
+		r = append(r, "starving")
+	}
+	if n := state >> mutexWaiterShift; n > 0 {
+		r = append(r, waiters(n, "waiter"))
+	}
+	return strings.Join(r, ", ")
+}
+
+func formatRWMutex(v *api.Variable) string {
+	const rwmutexMaxReaders = 1 << 30
+	w := field(v, "w")
+	if w == nil {
+		return ""
+	}
+	state, ok1 := mutexState(w)
+	readers, ok2 := intField(v, "readerCount", "v")
+	if !ok2 {
+		// before Go 1.20 readerCount was an int32
+		readers, ok2 = intField(v, "readerCount")
+	}
+	if !ok1 || !ok2 {
+		return ""
+	}
+	writer := false
+	if readers < 0 {
+		// a writer is waiting for readers to finish or holds the lock
+		writer = true
+		readers += rwmutexMaxReaders
+	}
+	var r []string
+	switch {
+	case writer && readers == 0:
+		r = append(r, "write locked")
+	case writer:
+		r = append(r, fmt.Sprintf("read locked by %s, writer waiting", waiters(readers, "reader")))
+	case readers > 0:
+		r = append(r, fmt.Sprintf("read locked by %s", waiters(readers, "reader")))
+	default:
+		r = append(r, "unlocked")
+	}
+	if n := state >> mutexWaiterShift; n > 0 {
+		r = append(r, waiters(n, "waiting writer"))
+	}
+	return strings.Join(r, ", ")
+}
+
+func formatWaitGroup(v *api.Variable) string {
+	state, ok := uintField(v, "state", "v")
+	if !ok {
+		return ""
+	}
+	counter := int32(state >> 32)
+	// since Go 1.25 the most significant bit of the waiters count is used by
+	// testing/synctest, it is never set in earlier versions.
+	waitCount := uint32(state) & 0x7fffffff
+	return fmt.Sprintf("counter %d, %s", counter, waiters(int64(waitCount), "waiter"))
+}
+
+func formatAtomicInt(v *api.Variable) string {
+	f := field(v, "v")
+	if f == nil {
+		return ""
+	}
+	return f.Value
+}
+
+func formatAtomicBool(v *api.Variable) string {
+	n, ok := uintField(v, "v")
+	if !ok {
+		return ""
+	}
+	return strconv.FormatBool(n != 0)
+}
+
+func formatStringsBuilder(v *api.Variable) string {
+	buf := field(v, "buf")
+	if buf == nil {
+		return ""
+	}
+	return quoteBytes(buf, 0)
+}
+
+func formatBytesBuffer(v *api.Variable) string {
+	buf := field(v, "buf")
+	off, ok := intField(v, "off")
+	if buf == nil || !ok {
+		return ""
+	}
+	return quoteBytes(buf, int(off))
+}
+
+// quoteBytes returns the contents of the byte slice v, starting at off, as a
+// quoted string.
+func quoteBytes(v *api.Variable, off int) string {
+	b := make([]byte, 0, len(v.Children))
+	for i := off; i < len(v.Children); i++ {
+		n, err := strconv.ParseUint(v.Children[i].Value, 10, 8)
+		if err != nil {
+			return ""
+		}
+		b = append(b, byte(n))
+	}
+	s := strconv.Quote(string(b))
+	if more := v.Len - int64(len(v.Children)); more > 0 {
+		s += fmt.Sprintf("...+%d more", more)
+	}
+	return s
+}
+
+// formatContext describes the chain of contexts ending in v.
+func formatContext(v *api.Variable) string {
+	const maxChain = 10
+	var r []string
+	for len(r) < maxChain {
+		if v == nil || v.Kind != reflect.Interface {
+			r = append(r, "...")
+			break
+		}
+		if len(v.Children) == 0 || v.Children[0].Kind == reflect.Invalid {
+			r = append(r, "nil")
+			break
+		}
+		ctx := &v.Children[0]
+		if ctx.Kind == reflect.Ptr {
+			if len(ctx.Children) == 0 || ctx.Children[0].OnlyAddr {
+				r = append(r, "...")
+				break
+			}
+			ctx = &ctx.Children[0]
+		}
+
+		v = nil
+		terminal := false
+		switch typeBaseName(ctx.Type) {
+		case "backgroundCtx", "emptyCtx": // emptyCtx was used before Go 1.21
+			r = append(r, "Background")
+			terminal = true
+		case "todoCtx":
+			r = append(r, "TODO")
+			terminal = true
+		case "cancelCtx":
+			r = append(r, "WithCancel")
+			v = field(ctx, "Context")
+		case "timerCtx":
+			deadline := ""
+			if d := field(ctx, "deadline"); d != nil {
+				deadline = formatTime(d)
+			}
+			r = append(r, fmt.Sprintf("WithDeadline(%s)", deadline))
+			v = field(ctx, "cancelCtx", "Context")
+		case "valueCtx":
+			key := ""
+			if k := field(ctx, "key"); k != nil {
+				key = Singleline(k, false, false)
+			}
+			r = append(r, fmt.Sprintf("WithValue(%s)", key))
+			v = field(ctx, "Context")
+		case "withoutCancelCtx":
+			r = append(r, "WithoutCancel")
+			v = field(ctx, "c")
+		case "afterFuncCtx":
+			r = append(r, "AfterFunc")
+			v = field(ctx, "cancelCtx", "Context")
+		default:
+			r = append(r, ShortenType(ctx.Type))
+			terminal = true
+		}
+		if terminal {
+			break
+		}
+	}
+	return strings.Join(r, " <- ")
+}
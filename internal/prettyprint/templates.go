@@ -0,0 +1,267 @@
+package prettyprint
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
+)
+
+// TypeFormatter formats all variables whose type matches Type or
+// TypeRegexp using text/template templates. Templates are executed with the
+// value of the variable as their data: structs and maps become maps indexed
+// by field name (or key), pointers and interfaces are followed, slices and
+// arrays become slices and everything else becomes the corresponding Go
+// value.
+type TypeFormatter struct {
+	Type       string // exact type name, matches all instantiations of generic types
+	TypeRegexp string // regular expression matching the whole type name
+	Summary    string // template for the value of the variable
+	Children   []SyntheticChild
+
+	re       *regexp.Regexp
+	summary  *template.Template
+	children []*template.Template
+}
+
+// SyntheticChild is a child shown in place of the fields of a variable
+// formatted by a TypeFormatter. Expr is a template producing an expression
+// to evaluate, the template function 'expr' returns an expression for the
+// variable being formatted.
+type SyntheticChild struct {
+	Name string
+	Expr string
+}
+
+var typeFormatters []*TypeFormatter
+var typeFormattersMu sync.Mutex
+
+// SetTypeFormatters replaces the list of type formatters, formatters that
+// can not be compiled are skipped and reported in the returned error.
+func SetTypeFormatters(tfs []*TypeFormatter) error {
+	var r []*TypeFormatter
+	var errs []string
+	for _, tf := range tfs {
+		if err := tf.compile(); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		r = append(r, tf)
+	}
+	typeFormattersMu.Lock()
+	typeFormatters = r
+	typeFormattersMu.Unlock()
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+func (tf *TypeFormatter) compile() error {
+	name := tf.Type
+	switch {
+	case tf.Type != "" && tf.TypeRegexp != "":
+		return fmt.Errorf("formatter %s: only one of Type and TypeRegexp can be specified", tf.Type)
+	case tf.TypeRegexp != "":
+		name = tf.TypeRegexp
+		var err error
+		tf.re, err = regexp.Compile("^(?:" + tf.TypeRegexp + ")$")
+		if err != nil {
+			return fmt.Errorf("formatter %s: %v", name, err)
+		}
+	case tf.Type == "":
+		return fmt.Errorf("formatter without type")
+	}
+
+	funcs := template.FuncMap{"expr": func() (string, error) { return "", nil }}
+	parse := func(what, text string) (*template.Template, error) {
+		t, err := template.New(what).Funcs(funcs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("formatter %s: %v", name, err)
+		}
+		return t, nil
+	}
+
+	var err error
+	tf.summary = nil
+	if tf.Summary != "" {
+		tf.summary, err = parse("Summary", tf.Summary)
+		if err != nil {
+			return err
+		}
+	}
+	tf.children = tf.children[:0]
+	for _, child := range tf.Children {
+		t, err := parse(child.Name, child.Expr)
+		if err != nil {
+			return err
+		}
+		tf.children = append(tf.children, t)
+	}
+	return nil
+}
+
+func (tf *TypeFormatter) match(typ string) bool {
+	if tf.re != nil {
+		return tf.re.MatchString(typ)
+	}
+	if typ == tf.Type {
+		return true
+	}
+	if strings.Contains(tf.Type, "[") {
+		return false
+	}
+	// instantiation of a generic type
+	return strings.HasPrefix(typ, tf.Type+"[") && strings.HasSuffix(typ, "]")
+}
+
+// LookupTypeFormatter returns the type formatter for typ.
+func LookupTypeFormatter(typ string) *TypeFormatter {
+	if typ == "" {
+		return nil
+	}
+	typeFormattersMu.Lock()
+	defer typeFormattersMu.Unlock()
+	for _, tf := range typeFormatters {
+		if tf.match(typ) {
+			return tf
+		}
+	}
+	return nil
+}
+
+// Format returns the summary of v. Returns false if tf doesn't have a
+// summary or if the summary can not be computed because v wasn't loaded
+// completely.
+func (tf *TypeFormatter) Format(v *api.Variable) (string, bool) {
+	if tf.summary == nil {
+		return "", false
+	}
+	var buf bytes.Buffer
+	if err := tf.summary.Execute(&buf, templateData(v, 0)); err != nil {
+		if !loaded(v, 0) {
+			return "", false
+		}
+		return fmt.Sprintf("formatter error: %v", err), true
+	}
+	return buf.String(), true
+}
+
+// ChildExprs returns the expressions for the synthetic children of v, expr
+// is an expression evaluating to v. Children whose expression template
+// fails are returned with an empty expression and the error in their name.
+// Returns nil if the expressions can not be computed because v wasn't
+// loaded completely.
+func (tf *TypeFormatter) ChildExprs(v *api.Variable, expr string) []SyntheticChild {
+	if len(tf.children) == 0 {
+		return nil
+	}
+	exprFn := func() (string, error) {
+		if expr == "" {
+			return "", fmt.Errorf("no expression for the variable")
+		}
+		return expr, nil
+	}
+	data := templateData(v, 0)
+	r := make([]SyntheticChild, len(tf.children))
+	for i, t := range tf.children {
+		var buf bytes.Buffer
+		t, _ := t.Clone()
+		t.Funcs(template.FuncMap{"expr": exprFn})
+		if err := t.Execute(&buf, data); err != nil {
+			if !loaded(v, 0) {
+				return nil
+			}
+			r[i] = SyntheticChild{Name: fmt.Sprintf("%s (%v)", tf.Children[i].Name, err)}
+			continue
+		}
+		r[i] = SyntheticChild{Name: tf.Children[i].Name, Expr: buf.String()}
+	}
+	return r
+}
+
+// loaded returns true if the structs reachable from v (within the depth
+// converted by templateData) were loaded completely.
+func loaded(v *api.Variable, depth int) bool {
+	const maxDepth = 10
+	if depth > maxDepth {
+		return false
+	}
+	switch v.Kind {
+	case reflect.Struct:
+		if int64(len(v.Children)) != v.Len {
+			return false
+		}
+	case reflect.Ptr, reflect.Interface:
+		if len(v.Children) > 0 && v.Children[0].OnlyAddr && v.Children[0].Addr != 0 {
+			return false
+		}
+	}
+	for i := range v.Children {
+		if !loaded(&v.Children[i], depth+1) {
+			return false
+		}
+	}
+	return true
+}
+
+// templateData converts v into the value passed to the templates of a
+// TypeFormatter.
+func templateData(v *api.Variable, depth int) interface{} {
+	const maxDepth = 10
+	if v.Unreadable != "" || depth > maxDepth {
+		return nil
+	}
+	switch v.Kind {
+	case reflect.Struct:
+		m := make(map[string]interface{}, len(v.Children))
+		for i := range v.Children {
+			m[v.Children[i].Name] = templateData(&v.Children[i], depth+1)
+		}
+		return m
+	case reflect.Map:
+		m := make(map[string]interface{}, len(v.Children)/2)
+		for i := 0; i+1 < len(v.Children); i += 2 {
+			key := &v.Children[i]
+			k := key.Value
+			if key.Kind != reflect.String {
+				k = Singleline(key, false, false)
+			}
+			m[k] = templateData(&v.Children[i+1], depth+1)
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		s := make([]interface{}, len(v.Children))
+		for i := range v.Children {
+			s[i] = templateData(&v.Children[i], depth+1)
+		}
+		return s
+	case reflect.Ptr, reflect.Interface:
+		if len(v.Children) == 0 || v.Children[0].OnlyAddr || v.Children[0].Kind == reflect.Invalid {
+			return nil
+		}
+		if v.Kind == reflect.Ptr && v.Children[0].Addr == 0 {
+			return nil
+		}
+		return templateData(&v.Children[0], depth+1)
+	case reflect.Bool:
+		return v.Value == "true"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, _ := strconv.ParseInt(v.Value, 10, 64)
+		return n
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, _ := strconv.ParseUint(v.Value, 10, 64)
+		return n
+	case reflect.Float32, reflect.Float64:
+		f, _ := strconv.ParseFloat(v.Value, 64)
+		return f
+	default:
+		return v.Value
+	}
+}
@@ -0,0 +1,127 @@
+package starbind
+
+import (
+	"go.starlark.net/starlark"
+)
+
+const (
+	selectGoroutineBuiltinName  = "select_goroutine"
+	selectFrameBuiltinName      = "select_frame"
+	listingPositionBuiltinName  = "listing_position"
+	showLocationBuiltinName     = "show_location"
+	selectionBuiltinName        = "selection"
+	openWindowBuiltinName       = "open_window"
+	closeWindowBuiltinName      = "close_window"
+	loadLayoutBuiltinName       = "load_layout"
+	expressionsBuiltinName      = "expressions"
+	addExpressionBuiltinName    = "add_expression"
+	removeExpressionBuiltinName = "remove_expression"
+)
+
+// GUIContext lets scripts read and change the state of the user interface.
+type GUIContext interface {
+	SelectGoroutine(gid int64) error
+	SelectFrame(frame int) error
+	ListingPosition() (file string, line int)
+	ShowLocation(file string, line int)
+	Selection() (listing, variables string)
+	OpenWindow(name string) error
+	CloseWindow(name string) error
+	LoadLayout(name string) error
+	Expressions() []string
+	AddExpression(expr string)
+	RemoveExpression(expr string) error
+}
+
+func (env *Env) guiBuiltins(builtindoc func(name, args, descr string)) {
+	builtin := func(name, args, descr string, fn func(thread *starlark.Thread, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error)) {
+		env.env[name] = starlark.NewBuiltin(name, func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if err := isCancelled(thread); err != nil {
+				return starlark.None, decorateError(thread, err)
+			}
+			v, err := fn(thread, args, kwargs)
+			return v, decorateError(thread, err)
+		})
+		builtindoc(name, args, descr)
+	}
+
+	stringArg := func(name, argname string, fn func(string) error) func(*starlark.Thread, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+		return func(_ *starlark.Thread, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var s string
+			if err := starlark.UnpackArgs(name, args, kwargs, argname, &s); err != nil {
+				return starlark.None, err
+			}
+			return starlark.None, fn(s)
+		}
+	}
+
+	builtin(selectGoroutineBuiltinName, "(GoroutineID)", "selects the specified goroutine in the user interface.", func(_ *starlark.Thread, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var gid int
+		if err := starlark.UnpackArgs(selectGoroutineBuiltinName, args, kwargs, "GoroutineID", &gid); err != nil {
+			return starlark.None, err
+		}
+		return starlark.None, env.ctx.SelectGoroutine(int64(gid))
+	})
+
+	builtin(selectFrameBuiltinName, "(Frame)", "selects the specified frame of the current goroutine in the user interface.", func(_ *starlark.Thread, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var frame int
+		if err := starlark.UnpackArgs(selectFrameBuiltinName, args, kwargs, "Frame", &frame); err != nil {
+			return starlark.None, err
+		}
+		return starlark.None, env.ctx.SelectFrame(frame)
+	})
+
+	builtin(listingPositionBuiltinName, "()", "returns the file and line displayed by the listing panel.", func(_ *starlark.Thread, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := starlark.UnpackArgs(listingPositionBuiltinName, args, kwargs); err != nil {
+			return starlark.None, err
+		}
+		file, line := env.ctx.ListingPosition()
+		r := starlark.NewDict(2)
+		r.SetKey(starlark.String("File"), starlark.String(file))
+		r.SetKey(starlark.String("Line"), starlark.MakeInt(line))
+		return r, nil
+	})
+
+	builtin(showLocationBuiltinName, "(File, Line)", "shows File:Line in the listing panel.", func(_ *starlark.Thread, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var file string
+		var line int
+		if err := starlark.UnpackArgs(showLocationBuiltinName, args, kwargs, "File", &file, "Line", &line); err != nil {
+			return starlark.None, err
+		}
+		env.ctx.ShowLocation(file, line)
+		return starlark.None, nil
+	})
+
+	builtin(selectionBuiltinName, "()", "returns the text selected in the listing and variables panels.", func(_ *starlark.Thread, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := starlark.UnpackArgs(selectionBuiltinName, args, kwargs); err != nil {
+			return starlark.None, err
+		}
+		listing, variables := env.ctx.Selection()
+		r := starlark.NewDict(2)
+		r.SetKey(starlark.String("Listing"), starlark.String(listing))
+		r.SetKey(starlark.String("Variables"), starlark.String(variables))
+		return r, nil
+	})
+
+	builtin(openWindowBuiltinName, "(Name)", "opens the panel called Name in a new window.", stringArg(openWindowBuiltinName, "Name", env.ctx.OpenWindow))
+	builtin(closeWindowBuiltinName, "(Name)", "closes the window containing the panel called Name.", stringArg(closeWindowBuiltinName, "Name", env.ctx.CloseWindow))
+	builtin(loadLayoutBuiltinName, "(Name)", "loads the layout called Name.", stringArg(loadLayoutBuiltinName, "Name", env.ctx.LoadLayout))
+
+	builtin(expressionsBuiltinName, "()", "returns the list of expressions in the variables panel.", func(_ *starlark.Thread, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := starlark.UnpackArgs(expressionsBuiltinName, args, kwargs); err != nil {
+			return starlark.None, err
+		}
+		exprs := env.ctx.Expressions()
+		r := make([]starlark.Value, len(exprs))
+		for i := range exprs {
+			r[i] = starlark.String(exprs[i])
+		}
+		return starlark.NewList(r), nil
+	})
+
+	builtin(addExpressionBuiltinName, "(Expr)", "adds an expression to the variables panel.", stringArg(addExpressionBuiltinName, "Expr", func(expr string) error {
+		env.ctx.AddExpression(expr)
+		return nil
+	}))
+	builtin(removeExpressionBuiltinName, "(Expr)", "removes an expression from the variables panel.", stringArg(removeExpressionBuiltinName, "Expr", env.ctx.RemoveExpression))
+}
@@ -0,0 +1,103 @@
+package starbind
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"go.starlark.net/starlark"
+)
+
+const (
+	printTableBuiltinName = "print_table"
+	printLinkBuiltinName  = "print_link"
+	printVarBuiltinName   = "print_var"
+)
+
+// OutputContext lets scripts write rich text to the scrollback.
+type OutputContext interface {
+	PrintLink(text, file string, line int)
+	PrintVar(v starlark.Value)
+}
+
+func (env *Env) outputBuiltins(builtindoc func(name, args, descr string)) {
+	env.env[printTableBuiltinName] = starlark.NewBuiltin(printTableBuiltinName, env.printTable)
+	builtindoc(printTableBuiltinName, "(Rows, Headers)", "prints Rows as a table with aligned columns, Headers is optional.")
+
+	env.env[printLinkBuiltinName] = starlark.NewBuiltin(printLinkBuiltinName, func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var text, file string
+		var line int
+		if err := starlark.UnpackArgs(printLinkBuiltinName, args, kwargs, "Text", &text, "File", &file, "Line", &line); err != nil {
+			return starlark.None, decorateError(thread, err)
+		}
+		env.ctx.PrintLink(text, file, line)
+		return starlark.None, nil
+	})
+	builtindoc(printLinkBuiltinName, "(Text, File, Line)", "prints a link to File:Line.")
+
+	env.env[printVarBuiltinName] = starlark.NewBuiltin(printVarBuiltinName, func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var v starlark.Value
+		if err := starlark.UnpackArgs(printVarBuiltinName, args, kwargs, "V", &v); err != nil {
+			return starlark.None, decorateError(thread, err)
+		}
+		env.ctx.PrintVar(v)
+		return starlark.None, nil
+	})
+	builtindoc(printVarBuiltinName, "(V)", "prints V, which can be expanded by clicking on it.")
+}
+
+// printTable implements the print_table builtin.
+func (env *Env) printTable(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var rowsv, headersv starlark.Indexable
+	if err := starlark.UnpackArgs(printTableBuiltinName, args, kwargs, "Rows", &rowsv, "Headers?", &headersv); err != nil {
+		return starlark.None, decorateError(thread, err)
+	}
+
+	var buf strings.Builder
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	writeRow := func(row starlark.Value) {
+		cells, ok := row.(starlark.Indexable)
+		if _, isstr := row.(starlark.String); isstr || !ok {
+			fmt.Fprintf(w, "%s\n", starlarkToText(row))
+			return
+		}
+		for i := 0; i < cells.Len(); i++ {
+			if i > 0 {
+				w.Write([]byte{'\t'})
+			}
+			w.Write([]byte(starlarkToText(cells.Index(i))))
+		}
+		w.Write([]byte{'\n'})
+	}
+
+	if headersv != nil {
+		writeRow(headersv)
+		for i := 0; i < headersv.Len(); i++ {
+			if i > 0 {
+				w.Write([]byte{'\t'})
+			}
+			w.Write([]byte(strings.Repeat("-", len(starlarkToText(headersv.Index(i))))))
+		}
+		w.Write([]byte{'\n'})
+	}
+	for i := 0; i < rowsv.Len(); i++ {
+		writeRow(rowsv.Index(i))
+	}
+	w.Flush()
+
+	out := strings.TrimSuffix(buf.String(), "\n")
+	if thread.Print != nil {
+		thread.Print(thread, out)
+	} else {
+		fmt.Fprintln(env.output(), out)
+	}
+	return starlark.None, nil
+}
+
+// starlarkToText converts v to the text displayed for it in a table cell.
+func starlarkToText(v starlark.Value) string {
+	if s, ok := v.(starlark.String); ok {
+		return strings.Replace(string(s), "\t", " ", -1)
+	}
+	return v.String()
+}
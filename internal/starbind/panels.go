@@ -0,0 +1,135 @@
+package starbind
+
+import (
+	"fmt"
+
+	"go.starlark.net/starlark"
+)
+
+const registerPanelBuiltinName = "register_panel"
+
+// PanelCellKind is the kind of a cell of a custom panel.
+type PanelCellKind uint8
+
+const (
+	PanelLabel  PanelCellKind = iota // plain text
+	PanelLink                        // text linking to File:Line
+	PanelButton                      // button executing Command
+)
+
+// PanelCell is a cell in a row of a custom panel.
+type PanelCell struct {
+	Kind    PanelCellKind
+	Text    string
+	File    string
+	Line    int
+	Command string
+}
+
+// registerPanel implements the register_panel builtin.
+func (env *Env) registerPanel(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var loadfn *starlark.Function
+	if err := starlark.UnpackArgs(registerPanelBuiltinName, args, kwargs, "Name", &name, "Load", &loadfn); err != nil {
+		return starlark.None, decorateError(thread, err)
+	}
+	if loadfn.NumParams() != 0 {
+		return starlark.None, decorateError(thread, fmt.Errorf("load function of panel %q must not have parameters", name))
+	}
+	err := env.ctx.RegisterPanel(name, loadfn.Doc(), func() ([][]PanelCell, error) {
+		// the load function runs on its own thread, like hooks, so that
+		// refreshing the panel doesn't interfere with a running script
+		thread := env.newHookThread(env.output())
+		thread.Name = "panel " + name
+		defer env.releaseHookThread(thread)
+		v, err := starlark.Call(thread, loadfn, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		return starlarkToPanelRows(v)
+	})
+	return starlark.None, decorateError(thread, err)
+}
+
+// starlarkToPanelRows converts the return value of a panel's load function
+// to a list of rows. The return value must be a list of rows, each row is
+// either a single cell or a list of cells.
+func starlarkToPanelRows(v starlark.Value) ([][]PanelCell, error) {
+	if v == starlark.None {
+		return nil, nil
+	}
+	rowsv, ok := v.(starlark.Indexable)
+	if !ok {
+		return nil, fmt.Errorf("load function returned %s instead of a list", v.Type())
+	}
+	rows := make([][]PanelCell, rowsv.Len())
+	for i := range rows {
+		rowv := rowsv.Index(i)
+		cellsv, ok := rowv.(starlark.Indexable)
+		if _, isstr := rowv.(starlark.String); isstr || !ok {
+			cell, err := starlarkToPanelCell(rowv)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %v", i, err)
+			}
+			rows[i] = []PanelCell{cell}
+			continue
+		}
+		rows[i] = make([]PanelCell, cellsv.Len())
+		for j := range rows[i] {
+			var err error
+			rows[i][j], err = starlarkToPanelCell(cellsv.Index(j))
+			if err != nil {
+				return nil, fmt.Errorf("row %d, cell %d: %v", i, j, err)
+			}
+		}
+	}
+	return rows, nil
+}
+
+// starlarkToPanelCell converts v to a panel cell. Strings are converted to
+// labels, dictionaries describe links and buttons:
+//
+//	{"link": text, "file": file, "line": line}
+//	{"button": text, "command": command}
+//
+// Any other value is converted to a label with its string representation.
+func starlarkToPanelCell(v starlark.Value) (PanelCell, error) {
+	switch v := v.(type) {
+	case starlark.String:
+		return PanelCell{Kind: PanelLabel, Text: string(v)}, nil
+	case *starlark.Dict:
+		str := func(key string) (string, bool) {
+			x, found, _ := v.Get(starlark.String(key))
+			if !found {
+				return "", false
+			}
+			if s, ok := x.(starlark.String); ok {
+				return string(s), true
+			}
+			return x.String(), true
+		}
+		if text, ok := str("link"); ok {
+			file, _ := str("file")
+			linev, _, _ := v.Get(starlark.String("line"))
+			line, ok := linev.(starlark.Int)
+			if !ok {
+				return PanelCell{}, fmt.Errorf("link %q has no line", text)
+			}
+			n, _ := line.Int64()
+			return PanelCell{Kind: PanelLink, Text: text, File: file, Line: int(n)}, nil
+		}
+		if text, ok := str("button"); ok {
+			cmd, ok := str("command")
+			if !ok {
+				return PanelCell{}, fmt.Errorf("button %q has no command", text)
+			}
+			return PanelCell{Kind: PanelButton, Text: text, Command: cmd}, nil
+		}
+		if text, ok := str("label"); ok {
+			return PanelCell{Kind: PanelLabel, Text: text}, nil
+		}
+		return PanelCell{}, fmt.Errorf("unknown cell %s", v.String())
+	default:
+		return PanelCell{Kind: PanelLabel, Text: v.String()}, nil
+	}
+}
@@ -36,6 +36,8 @@ package starbind
 import (
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 
 	"go.starlark.net/starlark"
 	"go.starlark.net/syntax"
@@ -47,12 +49,20 @@ func (env *Env) REPL(out io.Writer, lineReader <-chan string, promptChan chan<-
 	defer func() {
 		close(promptChan)
 	}()
-	env.out = out
+	env.setOutput(out)
 	thread := env.newThread()
 	globals := starlark.StringDict{}
 	for k, v := range env.env {
 		globals[k] = v
 	}
+	env.replMu.Lock()
+	env.replGlobals = globals
+	env.replMu.Unlock()
+	defer func() {
+		env.replMu.Lock()
+		env.replGlobals = nil
+		env.replMu.Unlock()
+	}()
 
 	for {
 		if err := isCancelled(thread); err != nil {
@@ -66,7 +76,7 @@ func (env *Env) REPL(out io.Writer, lineReader <-chan string, promptChan chan<-
 		}
 	}
 	fmt.Fprintln(out)
-	return env.saveGlobals(globals)
+	return env.saveGlobals("<repl>", globals)
 }
 
 const (
@@ -100,7 +110,7 @@ func (env *Env) rep(lineReader <-chan string, prompt chan<- string, thread *star
 		if eof {
 			return io.EOF
 		}
-		printError(env.out, err)
+		printError(env.output(), err)
 		return nil
 	}
 
@@ -109,34 +119,36 @@ func (env *Env) rep(lineReader <-chan string, prompt chan<- string, thread *star
 		// eval
 		v, err := starlark.EvalExpr(thread, expr, globals)
 		if err != nil {
-			printError(env.out, err)
+			printError(env.output(), err)
 			return nil
 		}
 
 		// print
 		if v != starlark.None {
-			fmt.Fprintln(env.out, v)
+			fmt.Fprintln(env.output(), v)
 		}
 	} else {
 		// compile
 		prog, err := starlark.FileProgram(f, globals.Has)
 		if err != nil {
-			printError(env.out, err)
+			printError(env.output(), err)
 			return nil
 		}
 
 		// execute (but do not freeze)
 		res, err := prog.Init(thread, globals)
 		if err != nil {
-			printError(env.out, err)
+			printError(env.output(), err)
 		}
 
 		// The global names from the previous call become
 		// the predeclared names of this call.
 		// If execution failed, some globals may be undefined.
+		env.replMu.Lock()
 		for k, v := range res {
 			globals[k] = v
 		}
+		env.replMu.Unlock()
 	}
 
 	return nil
@@ -161,6 +173,174 @@ func printError(out io.Writer, err error) {
 	}
 }
 
+// Complete returns the word at the end of line and the list of possible
+// completions for it. Global names, builtins, attributes of values and
+// keys of dictionaries are completed.
+// Completion never calls functions, the expression before the word is
+// resolved by following identifiers, attributes and constant indexes.
+func (env *Env) Complete(line string) (word string, compls []string) {
+	env.replMu.Lock()
+	globals := env.replGlobals
+	if globals == nil {
+		globals = env.env
+	}
+	dicts := []starlark.StringDict{globals, env.env, starlark.Universe}
+	env.replMu.Unlock()
+
+	lookup := func(name string) starlark.Value {
+		env.replMu.Lock()
+		defer env.replMu.Unlock()
+		for _, dict := range dicts {
+			if v, ok := dict[name]; ok {
+				return v
+			}
+		}
+		return nil
+	}
+
+	eval := func(expr string) starlark.Value {
+		if expr == "" {
+			return nil
+		}
+		x, err := syntax.ParseExpr("<complete>", expr, 0)
+		if err != nil {
+			return nil
+		}
+		return resolveExpr(x, lookup)
+	}
+
+	if idx := strings.LastIndexAny(line, "\"'"); idx > 0 && strings.HasSuffix(strings.TrimRight(line[:idx], " "), "[") && !strings.ContainsAny(line[idx+1:], "\"']") {
+		// dictionary key
+		word = line[idx+1:]
+		open := strings.LastIndex(line[:idx], "[")
+		v := eval(trailingPrimaryExpr(line[:open]))
+		switch v := v.(type) {
+		case starlark.IterableMapping:
+			for _, item := range v.Items() {
+				if key, ok := item[0].(starlark.String); ok {
+					compls = append(compls, string(key))
+				}
+			}
+		case starlark.HasAttrs:
+			if _, ok := v.(starlark.Mapping); ok {
+				compls = append(compls, v.AttrNames()...)
+			}
+		}
+		return word, compls
+	}
+
+	start := len(line)
+	for start > 0 && isIdentChar(line[start-1]) {
+		start--
+	}
+	word = line[start:]
+
+	if start > 0 && line[start-1] == '.' {
+		// attribute
+		if v, ok := eval(trailingPrimaryExpr(line[:start-1])).(starlark.HasAttrs); ok {
+			compls = v.AttrNames()
+		}
+		return word, compls
+	}
+
+	env.replMu.Lock()
+	for _, dict := range dicts {
+		for name := range dict {
+			compls = append(compls, name)
+		}
+	}
+	env.replMu.Unlock()
+	sort.Strings(compls)
+	return word, compls
+}
+
+// resolveExpr returns the value of expr, if it is an identifier, an attribute
+// access or an index expression with a constant index, without calling any
+// function. Returns nil for any other expression.
+func resolveExpr(expr syntax.Expr, lookup func(name string) starlark.Value) starlark.Value {
+	switch expr := expr.(type) {
+	case *syntax.Ident:
+		return lookup(expr.Name)
+
+	case *syntax.DotExpr:
+		x, ok := resolveExpr(expr.X, lookup).(starlark.HasAttrs)
+		if !ok {
+			return nil
+		}
+		v, err := x.Attr(expr.Name.Name)
+		if err != nil {
+			return nil
+		}
+		return v
+
+	case *syntax.IndexExpr:
+		lit, ok := expr.Y.(*syntax.Literal)
+		if !ok {
+			return nil
+		}
+		var key starlark.Value
+		switch val := lit.Value.(type) {
+		case string:
+			key = starlark.String(val)
+		case int64:
+			key = starlark.MakeInt64(val)
+		default:
+			return nil
+		}
+		switch x := resolveExpr(expr.X, lookup).(type) {
+		case starlark.Mapping:
+			v, found, err := x.Get(key)
+			if err != nil || !found {
+				return nil
+			}
+			return v
+		case starlark.Indexable:
+			i, err := starlark.AsInt32(key)
+			if err != nil || i < 0 || i >= x.Len() {
+				return nil
+			}
+			return x.Index(i)
+		}
+	}
+	return nil
+}
+
+// trailingPrimaryExpr returns the longest suffix of line that is a primary
+// expression without function calls, for example "a.b[1].c".
+func trailingPrimaryExpr(line string) string {
+	start := len(line)
+	for start > 0 {
+		switch ch := line[start-1]; {
+		case isIdentChar(ch) || ch == '.':
+			start--
+		case ch == ']':
+			depth := 0
+			i := start - 1
+			for ; i >= 0; i-- {
+				if line[i] == ']' {
+					depth++
+				} else if line[i] == '[' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			if i <= 0 {
+				return ""
+			}
+			start = i
+		default:
+			return line[start:]
+		}
+	}
+	return line[start:]
+}
+
+func isIdentChar(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
+
 // MakeLoad returns a simple sequential implementation of module loading
 // suitable for use in the REPL.
 // Each function returned by MakeLoad accesses a distinct private cache.
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"runtime"
 	"sort"
 	"strings"
@@ -18,8 +20,7 @@ import (
 	"github.com/aarzilli/gdlv/internal/dlvclient/service/rpc2"
 )
 
-//go:generate go run ../../scripts/gen-starlark-bindings.go go ./starlark_mapping.go
-//go:generate go run ../../scripts/gen-starlark-bindings.go doc ../../doc/starlark.md
+//go:generate go run ../../_scripts/gen-starlark-bindings.go
 
 const (
 	dlvCommandBuiltinName        = "dlv_command"
@@ -27,12 +28,33 @@ const (
 	writeFileBuiltinName         = "write_file"
 	commandPrefix                = "command_"
 	dlvContextName               = "dlv_context"
+	loadCacheName                = "load_cache"
+	scopeName                    = "dlv_scope"
 	curScopeBuiltinName          = "cur_scope"
 	defaultLoadConfigBuiltinName = "default_load_config"
 	targetObjectName             = "tgt"
 	helpBuiltinName              = "help"
+
+	apiDocURL = "https://pkg.go.dev/github.com/go-delve/delve/service/rpc2#RPCServer."
+)
+
+// Names of the hook functions that scripts can define, they are called by
+// the debugger when the corresponding event happens.
+const (
+	OnStopHook       = "on_stop"
+	OnBreakpointHook = "on_breakpoint"
+	OnRestartHook    = "on_restart"
+	OnExitHook       = "on_exit"
 )
 
+func isHookName(name string) bool {
+	switch name {
+	case OnStopHook, OnBreakpointHook, OnRestartHook, OnExitHook:
+		return true
+	}
+	return false
+}
+
 func init() {
 	resolve.AllowNestedDef = true
 	resolve.AllowLambda = true
@@ -51,14 +73,32 @@ type Context interface {
 	CallCommand(cmdstr string) error
 	Scope() api.EvalScope
 	LoadConfig() api.LoadConfig
+	RegisterPanel(name, helpMsg string, load func() ([][]PanelCell, error)) error
+	TaskChanged(task *Task)
+	GUIContext
+	OutputContext
 }
 
 // Env is the environment used to evaluate starlark scripts.
 type Env struct {
-	env       starlark.StringDict
-	contextMu sync.Mutex
-	cancelfn  context.CancelFunc
-	thread    *starlark.Thread
+	env         starlark.StringDict
+	contextMu   sync.Mutex
+	cancelfn    context.CancelFunc
+	thread      *starlark.Thread
+	hookCancels map[*starlark.Thread]context.CancelFunc
+
+	hooksMu sync.Mutex
+	hooks   map[string]hook
+
+	replMu      sync.Mutex
+	replGlobals starlark.StringDict
+
+	tasksMu   sync.Mutex
+	tasks     []*Task
+	taskCount int
+
+	loadMu     sync.Mutex
+	scriptPath []string
 
 	ctx Context
 	out io.Writer
@@ -69,6 +109,8 @@ func New(ctx Context) *Env {
 	env := &Env{}
 
 	env.ctx = ctx
+	env.hooks = make(map[string]hook)
+	env.hookCancels = make(map[*starlark.Thread]context.CancelFunc)
 
 	var doc map[string]string
 	env.env, doc = env.starlarkPredeclare()
@@ -126,8 +168,8 @@ func New(ctx Context) *Env {
 	})
 	builtindoc(writeFileBuiltinName, "(Path, Text)", "writes text to the specified file.")
 
-	env.env[curScopeBuiltinName] = starlark.NewBuiltin(curScopeBuiltinName, func(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
-		return env.interfaceToStarlarkValue(env.ctx.Scope()), nil
+	env.env[curScopeBuiltinName] = starlark.NewBuiltin(curScopeBuiltinName, func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		return env.interfaceToStarlarkValue(env.scope(thread)), nil
 	})
 	builtindoc(curScopeBuiltinName, "()", "returns the current scope.")
 
@@ -136,12 +178,24 @@ func New(ctx Context) *Env {
 	})
 	builtindoc(defaultLoadConfigBuiltinName, "()", "returns the default load configuration.")
 
-	env.env[targetObjectName] = targetObject{env}
+	env.env[registerPanelBuiltinName] = starlark.NewBuiltin(registerPanelBuiltinName, env.registerPanel)
+	builtindoc(registerPanelBuiltinName, "(Name, Load)", "registers a new panel called Name, the Load function is called every time the target stops and returns the list of rows to display.")
+
+	env.env[spawnBuiltinName] = starlark.NewBuiltin(spawnBuiltinName, env.spawn)
+	builtindoc(spawnBuiltinName, "(Fn, Args...)", "calls Fn with the specified arguments in background, returns the ID of the new task.")
+
+	env.env[setStatusBuiltinName] = starlark.NewBuiltin(setStatusBuiltinName, env.setStatus)
+	builtindoc(setStatusBuiltinName, "(Status)", "sets the status message of the current task.")
+
+	env.guiBuiltins(builtindoc)
+	env.outputBuiltins(builtindoc)
+
+	env.env[targetObjectName] = targetObject{env: env}
 
 	env.env[helpBuiltinName] = starlark.NewBuiltin(helpBuiltinName, func(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 		switch len(args) {
 		case 0:
-			fmt.Fprintln(env.out, "Available builtins:")
+			fmt.Fprintln(env.output(), "Available builtins:")
 			bins := make([]string, 0, len(env.env))
 			for name, value := range env.env {
 				switch value.(type) {
@@ -151,27 +205,34 @@ func New(ctx Context) *Env {
 			}
 			sort.Strings(bins)
 			for _, bin := range bins {
-				fmt.Fprintf(env.out, "\t%s\n", bin)
+				fmt.Fprintf(env.output(), "\t%s\n", bin)
 			}
-			fmt.Fprintf(env.out, "\n\nUse tgt.varname to access the varname variable in the target process (it is equivalent to 'eval(None, \"varname\").Variable').\n")
+			fmt.Fprintf(env.output(), "\n\nUse tgt.varname to access the varname variable in the target process (it is equivalent to 'eval(None, \"varname\").Variable').\n")
 		case 1:
 			switch x := args[0].(type) {
 			case *starlark.Builtin:
 				if doc[x.Name()] != "" {
-					fmt.Fprintf(env.out, "%s\n", doc[x.Name()])
+					fmt.Fprintf(env.output(), "%s\n", doc[x.Name()])
 				} else {
-					fmt.Fprintf(env.out, "no help for builtin %s\n", x.Name())
+					fmt.Fprintf(env.output(), "no help for builtin %s\n", x.Name())
+				}
+				if apiName := apiNames[x.Name()]; apiName != "" {
+					fmt.Fprintf(env.output(), "\nSee %s%s\n", apiDocURL, apiName)
 				}
 			case *starlark.Function:
-				fmt.Fprintf(env.out, "user defined function %s\n", x.Name())
+				params := make([]string, x.NumParams())
+				for i := range params {
+					params[i], _ = x.Param(i)
+				}
+				fmt.Fprintf(env.output(), "user defined function %s(%s)\n", x.Name(), strings.Join(params, ", "))
 				if doc := x.Doc(); doc != "" {
-					fmt.Fprintln(env.out, doc)
+					fmt.Fprintln(env.output(), doc)
 				}
 			default:
-				fmt.Fprintf(env.out, "no help for object of type %T\n", args[0])
+				fmt.Fprintf(env.output(), "no help for object of type %T\n", args[0])
 			}
 		default:
-			fmt.Fprintln(env.out, "wrong number of arguments ", len(args))
+			fmt.Fprintln(env.output(), "wrong number of arguments ", len(args))
 		}
 		return starlark.None, nil
 	})
@@ -206,9 +267,13 @@ func (env *Env) Execute(out io.Writer, path string, source interface{}, mainFnNa
 		}
 	}()
 
-	env.out = out
+	env.setOutput(out)
 	thread := env.newThread()
 
+	if mainFnName != "<expr>" {
+		env.clearHooks(path)
+	}
+
 	envenv := env.env
 	if v != nil {
 		envenv = starlark.StringDict{}
@@ -227,7 +292,7 @@ func (env *Env) Execute(out io.Writer, path string, source interface{}, mainFnNa
 		return starlark.None, err
 	}
 
-	err = env.saveGlobals(globals)
+	err = env.saveGlobals(path, globals)
 	if err != nil {
 		return starlark.None, err
 	}
@@ -235,7 +300,13 @@ func (env *Env) Execute(out io.Writer, path string, source interface{}, mainFnNa
 	return env.callMain(thread, globals, mainFnName, args)
 }
 
-func (env *Env) saveGlobals(globals starlark.StringDict) error {
+// hook is a hook function and the path of the script that defined it.
+type hook struct {
+	fn   *starlark.Function
+	path string
+}
+
+func (env *Env) saveGlobals(path string, globals starlark.StringDict) error {
 	for name, val := range globals {
 		switch {
 		case strings.HasPrefix(name, commandPrefix):
@@ -243,6 +314,12 @@ func (env *Env) saveGlobals(globals starlark.StringDict) error {
 			if err != nil {
 				return err
 			}
+		case isHookName(name):
+			if fnval, ok := val.(*starlark.Function); ok {
+				env.hooksMu.Lock()
+				env.hooks[name] = hook{fnval, path}
+				env.hooksMu.Unlock()
+			}
 		case name[0] >= 'A' && name[0] <= 'Z':
 			env.env[name] = val
 		}
@@ -250,6 +327,64 @@ func (env *Env) saveGlobals(globals starlark.StringDict) error {
 	return nil
 }
 
+// HasHook returns true if a script defined the hook function name.
+func (env *Env) HasHook(name string) bool {
+	env.hooksMu.Lock()
+	defer env.hooksMu.Unlock()
+	return env.hooks[name].fn != nil
+}
+
+// clearHooks removes the hooks defined by the script at path, so that
+// executing it again does not leave behind hooks it no longer defines.
+func (env *Env) clearHooks(path string) {
+	env.hooksMu.Lock()
+	defer env.hooksMu.Unlock()
+	for name, h := range env.hooks {
+		if h.path == path {
+			delete(env.hooks, name)
+		}
+	}
+}
+
+// CallHook calls the hook function name, passing args to it. If no script
+// defined the hook starlark.None is returned.
+// Hooks run on their own thread, printing to out, and can be called while
+// a script is running without interfering with it.
+func (env *Env) CallHook(out io.Writer, name string, args ...interface{}) (starlark.Value, error) {
+	env.hooksMu.Lock()
+	fnval := env.hooks[name].fn
+	env.hooksMu.Unlock()
+	if fnval == nil {
+		return starlark.None, nil
+	}
+	if fnval.NumParams() != len(args) {
+		return starlark.None, fmt.Errorf("wrong number of arguments for %s", name)
+	}
+	argtuple := make(starlark.Tuple, len(args))
+	for i := range args {
+		argtuple[i] = env.interfaceToStarlarkValue(args[i])
+	}
+	thread := env.newHookThread(out)
+	defer env.releaseHookThread(thread)
+	return starlark.Call(thread, fnval, argtuple, nil)
+}
+
+// EvalCondition evaluates the expression expr using scope as the default
+// scope, printing to out. Like hooks conditions run on their own thread and
+// can be evaluated while a script is running without interfering with it.
+func (env *Env) EvalCondition(out io.Writer, expr string, scope api.EvalScope) (starlark.Value, error) {
+	thread := env.newHookThread(out)
+	thread.Name = "condition"
+	thread.SetLocal(scopeName, scope)
+	defer env.releaseHookThread(thread)
+	envenv := starlark.StringDict{}
+	for k, v := range env.env {
+		envenv[k] = v
+	}
+	envenv[targetObjectName] = targetObject{env: env, scope: &scope}
+	return starlark.Eval(thread, "<expr>", expr, envenv)
+}
+
 // Cancel cancels the execution of a currently running script or function.
 func (env *Env) Cancel() {
 	if env == nil {
@@ -263,6 +398,23 @@ func (env *Env) Cancel() {
 	if env.thread != nil {
 		env.thread.Cancel("user interrupt")
 	}
+	for thread, cancelfn := range env.hookCancels {
+		cancelfn()
+		thread.Cancel("user interrupt")
+	}
+	env.contextMu.Unlock()
+}
+
+// output returns the writer used by the last script or REPL started.
+func (env *Env) output() io.Writer {
+	env.contextMu.Lock()
+	defer env.contextMu.Unlock()
+	return env.out
+}
+
+func (env *Env) setOutput(out io.Writer) {
+	env.contextMu.Lock()
+	env.out = out
 	env.contextMu.Unlock()
 }
 
@@ -272,7 +424,7 @@ func (env *Env) newThread() *starlark.Thread {
 			if err := isCancelled(thread); err != nil {
 				panic("cancelled")
 			}
-			fmt.Fprintln(env.out, msg)
+			fmt.Fprintln(env.output(), msg)
 		},
 	}
 	env.contextMu.Lock()
@@ -281,9 +433,122 @@ func (env *Env) newThread() *starlark.Thread {
 	ctx, env.cancelfn = context.WithCancel(context.Background())
 	env.contextMu.Unlock()
 	thread.SetLocal(dlvContextName, ctx)
+	thread.Load = env.load
 	return thread
 }
 
+// newHookThread returns a thread for running a hook that prints to out,
+// it is cancelled by Cancel but does not replace the thread of the running
+// script.
+func (env *Env) newHookThread(out io.Writer) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: "hook",
+		Print: func(thread *starlark.Thread, msg string) {
+			if err := isCancelled(thread); err != nil {
+				panic("cancelled")
+			}
+			fmt.Fprintln(out, msg)
+		},
+	}
+	ctx, cancelfn := context.WithCancel(context.Background())
+	env.contextMu.Lock()
+	env.hookCancels[thread] = cancelfn
+	env.contextMu.Unlock()
+	thread.SetLocal(dlvContextName, ctx)
+	thread.Load = env.load
+	return thread
+}
+
+// releaseHookThread removes a thread created by newHookThread.
+func (env *Env) releaseHookThread(thread *starlark.Thread) {
+	env.contextMu.Lock()
+	cancelfn := env.hookCancels[thread]
+	delete(env.hookCancels, thread)
+	env.contextMu.Unlock()
+	cancelfn()
+}
+
+// scope returns the default scope for thread, which is the scope set on the
+// thread, if any, or the current scope of the user interface.
+func (env *Env) scope(thread *starlark.Thread) api.EvalScope {
+	if scope, ok := thread.Local(scopeName).(api.EvalScope); ok {
+		return scope
+	}
+	return env.ctx.Scope()
+}
+
+type loadEntry struct {
+	globals starlark.StringDict
+	err     error
+}
+
+// SetScriptPath sets the list of directories searched by load statements
+// for modules that can not be found relative to the loading script.
+func (env *Env) SetScriptPath(path []string) {
+	env.loadMu.Lock()
+	env.scriptPath = path
+	env.loadMu.Unlock()
+}
+
+// threadLoadCache returns the modules loaded by thread and the threads
+// that started it, executions that run concurrently have distinct caches.
+func threadLoadCache(thread *starlark.Thread) map[string]*loadEntry {
+	cache, _ := thread.Local(loadCacheName).(map[string]*loadEntry)
+	if cache == nil {
+		cache = make(map[string]*loadEntry)
+		thread.SetLocal(loadCacheName, cache)
+	}
+	return cache
+}
+
+// load implements the load statement. Modules are searched relative to the
+// directory of the script executing the load statement and then in the
+// script path. Each module is only executed once per call to Execute.
+func (env *Env) load(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+	path, err := env.findModule(filepath.Dir(thread.CallFrame(0).Pos.Filename()), module)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := threadLoadCache(thread)
+	e, ok := cache[path]
+	if ok {
+		if e == nil {
+			return nil, fmt.Errorf("cycle in load graph loading %s", module)
+		}
+		return e.globals, e.err
+	}
+	cache[path] = nil // load in progress
+
+	loadThread := &starlark.Thread{Name: "load " + module, Print: thread.Print, Load: env.load}
+	loadThread.SetLocal(dlvContextName, thread.Local(dlvContextName))
+	loadThread.SetLocal(loadCacheName, cache)
+	loadThread.SetLocal(scopeName, thread.Local(scopeName))
+	globals, err := starlark.ExecFile(loadThread, path, nil, env.env)
+	e = &loadEntry{globals, err}
+	cache[path] = e
+	return e.globals, e.err
+}
+
+func (env *Env) findModule(dir, module string) (string, error) {
+	if filepath.IsAbs(module) {
+		return module, nil
+	}
+	env.loadMu.Lock()
+	dirs := append([]string{dir}, env.scriptPath...)
+	env.loadMu.Unlock()
+	for _, dir := range dirs {
+		path, err := filepath.Abs(filepath.Join(dir, module))
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("could not find module %s", module)
+}
+
 func (env *Env) createCallback(name string, val starlark.Value) error {
 	fnval, ok := val.(*starlark.Function)
 	if !ok {
@@ -382,7 +647,8 @@ func decorateError(thread *starlark.Thread, err error) error {
 var _ starlark.HasAttrs = targetObject{}
 
 type targetObject struct {
-	env *Env
+	env   *Env
+	scope *api.EvalScope // if nil the current scope is used
 }
 
 func (targetObject) Freeze() {
@@ -410,7 +676,11 @@ func (tgt targetObject) AttrNames() []string {
 
 func (tgt targetObject) Attr(name string) (starlark.Value, error) {
 	env := tgt.env
-	v, err := env.ctx.Client().EvalVariable(env.ctx.Scope(), name, env.ctx.LoadConfig())
+	scope := env.ctx.Scope()
+	if tgt.scope != nil {
+		scope = *tgt.scope
+	}
+	v, err := env.ctx.Client().EvalVariable(scope, name, env.ctx.LoadConfig())
 	if err != nil {
 		return starlark.None, fmt.Errorf("could not find variable %q: %v", name, err)
 	}
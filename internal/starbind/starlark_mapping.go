@@ -116,6 +116,19 @@ func (env *Env) starlarkPredeclare() (starlark.StringDict, map[string]string) {
 		return env.interfaceToStarlarkValue(&rpcRet), nil
 	})
 	doc["build_id"] = "builtin build_id()"
+	r["cancel_downloads"] = starlark.NewBuiltin("cancel_downloads", func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := isCancelled(thread); err != nil {
+			return starlark.None, decorateError(thread, err)
+		}
+		var rpcArgs rpc2.CancelDownloadsIn
+		var rpcRet rpc2.CancelDownloadsOut
+		err := env.ctx.Client().CallAPI("CancelDownloads", &rpcArgs, &rpcRet)
+		if err != nil {
+			return starlark.None, err
+		}
+		return env.interfaceToStarlarkValue(&rpcRet), nil
+	})
+	doc["cancel_downloads"] = "builtin cancel_downloads()\n\ncancel_downloads cancels all running downloads of debug information."
 	r["cancel_next"] = starlark.NewBuiltin("cancel_next", func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 		if err := isCancelled(thread); err != nil {
 			return starlark.None, decorateError(thread, err)
@@ -269,12 +282,6 @@ func (env *Env) starlarkPredeclare() (starlark.StringDict, map[string]string) {
 				return starlark.None, decorateError(thread, err)
 			}
 		}
-		if len(args) > 5 && args[5] != starlark.None {
-			err := unmarshalStarlarkValue(args[5], &rpcArgs.WithEvents, "WithEvents")
-			if err != nil {
-				return starlark.None, decorateError(thread, err)
-			}
-		}
 		if len(args) > 6 && args[6] != starlark.None {
 			err := unmarshalStarlarkValue(args[6], &rpcArgs.UnsafeCall, "UnsafeCall")
 			if err != nil {
@@ -294,8 +301,7 @@ func (env *Env) starlarkPredeclare() (starlark.StringDict, map[string]string) {
 				err = unmarshalStarlarkValue(kv[1], &rpcArgs.ReturnInfoLoadConfig, "ReturnInfoLoadConfig")
 			case "Expr":
 				err = unmarshalStarlarkValue(kv[1], &rpcArgs.Expr, "Expr")
-			case "WithEvents":
-				err = unmarshalStarlarkValue(kv[1], &rpcArgs.WithEvents, "WithEvents")
+			case "WithEvents": // ignored, used internally to drain events
 			case "UnsafeCall":
 				err = unmarshalStarlarkValue(kv[1], &rpcArgs.UnsafeCall, "UnsafeCall")
 			default:
@@ -410,7 +416,7 @@ func (env *Env) starlarkPredeclare() (starlark.StringDict, map[string]string) {
 				return starlark.None, decorateError(thread, err)
 			}
 		} else {
-			rpcArgs.Scope = env.ctx.Scope()
+			rpcArgs.Scope = env.scope(thread)
 		}
 		if len(args) > 1 && args[1] != starlark.None {
 			err := unmarshalStarlarkValue(args[1], &rpcArgs.Expr, "Expr")
@@ -529,7 +535,7 @@ func (env *Env) starlarkPredeclare() (starlark.StringDict, map[string]string) {
 				return starlark.None, decorateError(thread, err)
 			}
 		} else {
-			rpcArgs.Scope = env.ctx.Scope()
+			rpcArgs.Scope = env.scope(thread)
 		}
 		if len(args) > 1 && args[1] != starlark.None {
 			err := unmarshalStarlarkValue(args[1], &rpcArgs.StartPC, "StartPC")
@@ -574,6 +580,37 @@ func (env *Env) starlarkPredeclare() (starlark.StringDict, map[string]string) {
 		return env.interfaceToStarlarkValue(&rpcRet), nil
 	})
 	doc["disassemble"] = "builtin disassemble(Scope, StartPC, EndPC, Flavour)\n\ndisassemble code.\n\nIf both StartPC and EndPC are non-zero the specified range will be disassembled, otherwise the function containing StartPC will be disassembled.\n\nScope is used to mark the instruction the specified goroutine is stopped at.\n\nDisassemble will also try to calculate the destination address of an absolute indirect CALL if it happens to be the instruction the selected goroutine is stopped at."
+	r["download_library_debug_info"] = starlark.NewBuiltin("download_library_debug_info", func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := isCancelled(thread); err != nil {
+			return starlark.None, decorateError(thread, err)
+		}
+		var rpcArgs rpc2.DownloadLibraryDebugInfoIn
+		var rpcRet rpc2.DownloadLibraryDebugInfoOut
+		if len(args) > 0 && args[0] != starlark.None {
+			err := unmarshalStarlarkValue(args[0], &rpcArgs.N, "N")
+			if err != nil {
+				return starlark.None, decorateError(thread, err)
+			}
+		}
+		for _, kv := range kwargs {
+			var err error
+			switch kv[0].(starlark.String) {
+			case "N":
+				err = unmarshalStarlarkValue(kv[1], &rpcArgs.N, "N")
+			default:
+				err = fmt.Errorf("unknown argument %q", kv[0])
+			}
+			if err != nil {
+				return starlark.None, decorateError(thread, err)
+			}
+		}
+		err := env.ctx.Client().CallAPI("DownloadLibraryDebugInfo", &rpcArgs, &rpcRet)
+		if err != nil {
+			return starlark.None, err
+		}
+		return env.interfaceToStarlarkValue(&rpcRet), nil
+	})
+	doc["download_library_debug_info"] = "builtin download_library_debug_info(N)\n\ndownload_library_debug_info downloads the debug information of the N-th dynamic library."
 	r["dump_cancel"] = starlark.NewBuiltin("dump_cancel", func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 		if err := isCancelled(thread); err != nil {
 			return starlark.None, decorateError(thread, err)
@@ -661,7 +698,7 @@ func (env *Env) starlarkPredeclare() (starlark.StringDict, map[string]string) {
 				return starlark.None, decorateError(thread, err)
 			}
 		} else {
-			rpcArgs.Scope = env.ctx.Scope()
+			rpcArgs.Scope = env.scope(thread)
 		}
 		if len(args) > 1 && args[1] != starlark.None {
 			err := unmarshalStarlarkValue(args[1], &rpcArgs.Expr, "Expr")
@@ -752,7 +789,7 @@ func (env *Env) starlarkPredeclare() (starlark.StringDict, map[string]string) {
 				return starlark.None, decorateError(thread, err)
 			}
 		} else {
-			rpcArgs.Scope = env.ctx.Scope()
+			rpcArgs.Scope = env.scope(thread)
 		}
 		if len(args) > 1 && args[1] != starlark.None {
 			err := unmarshalStarlarkValue(args[1], &rpcArgs.Loc, "Loc")
@@ -1089,7 +1126,7 @@ func (env *Env) starlarkPredeclare() (starlark.StringDict, map[string]string) {
 				return starlark.None, decorateError(thread, err)
 			}
 		} else {
-			rpcArgs.Scope = env.ctx.Scope()
+			rpcArgs.Scope = env.scope(thread)
 		}
 		if len(args) > 1 && args[1] != starlark.None {
 			err := unmarshalStarlarkValue(args[1], &rpcArgs.Cfg, "Cfg")
@@ -1195,7 +1232,7 @@ func (env *Env) starlarkPredeclare() (starlark.StringDict, map[string]string) {
 				return starlark.None, decorateError(thread, err)
 			}
 		} else {
-			scope := env.ctx.Scope()
+			scope := env.scope(thread)
 			rpcArgs.EvalScope = &scope
 		}
 		for _, kv := range kwargs {
@@ -1237,7 +1274,7 @@ func (env *Env) starlarkPredeclare() (starlark.StringDict, map[string]string) {
 				return starlark.None, decorateError(thread, err)
 			}
 		} else {
-			rpcArgs.Scope = env.ctx.Scope()
+			rpcArgs.Scope = env.scope(thread)
 		}
 		if len(args) > 1 && args[1] != starlark.None {
 			err := unmarshalStarlarkValue(args[1], &rpcArgs.Cfg, "Cfg")
@@ -1372,7 +1409,7 @@ func (env *Env) starlarkPredeclare() (starlark.StringDict, map[string]string) {
 				return starlark.None, decorateError(thread, err)
 			}
 		} else {
-			scope := env.ctx.Scope()
+			scope := env.scope(thread)
 			rpcArgs.Scope = &scope
 		}
 		for _, kv := range kwargs {
@@ -1595,7 +1632,7 @@ func (env *Env) starlarkPredeclare() (starlark.StringDict, map[string]string) {
 				return starlark.None, decorateError(thread, err)
 			}
 		} else {
-			rpcArgs.Scope = env.ctx.Scope()
+			rpcArgs.Scope = env.scope(thread)
 		}
 		if len(args) > 1 && args[1] != starlark.None {
 			err := unmarshalStarlarkValue(args[1], &rpcArgs.Symbol, "Symbol")
@@ -1734,6 +1771,19 @@ func (env *Env) starlarkPredeclare() (starlark.StringDict, map[string]string) {
 		return env.interfaceToStarlarkValue(&rpcRet), nil
 	})
 	doc["state"] = "builtin state(NonBlocking)\n\nstate returns the current debugger state."
+	r["stop_recording"] = starlark.NewBuiltin("stop_recording", func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := isCancelled(thread); err != nil {
+			return starlark.None, decorateError(thread, err)
+		}
+		var rpcArgs rpc2.StopRecordingIn
+		var rpcRet rpc2.StopRecordingOut
+		err := env.ctx.Client().CallAPI("StopRecording", &rpcArgs, &rpcRet)
+		if err != nil {
+			return starlark.None, err
+		}
+		return env.interfaceToStarlarkValue(&rpcRet), nil
+	})
+	doc["stop_recording"] = "builtin stop_recording()\n\nstop_recording stops a recording in progress."
 	r["toggle_breakpoint"] = starlark.NewBuiltin("toggle_breakpoint", func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 		if err := isCancelled(thread); err != nil {
 			return starlark.None, decorateError(thread, err)
@@ -1775,3 +1825,62 @@ func (env *Env) starlarkPredeclare() (starlark.StringDict, map[string]string) {
 	doc["toggle_breakpoint"] = "builtin toggle_breakpoint(Id, Name)\n\ntoggle_breakpoint toggles on or off a breakpoint by Name (if Name is not an\nempty string) or by ID."
 	return r, doc
 }
+
+// apiNames maps builtins defined in starlark_mapping.go to the name of the
+// corresponding RPCServer method.
+var apiNames = map[string]string{
+	"amend_breakpoint":             "AmendBreakpoint",
+	"ancestors":                    "Ancestors",
+	"attached_to_existing_process": "AttachedToExistingProcess",
+	"build_id":                     "BuildID",
+	"cancel_downloads":             "CancelDownloads",
+	"cancel_next":                  "CancelNext",
+	"checkpoint":                   "Checkpoint",
+	"clear_breakpoint":             "ClearBreakpoint",
+	"clear_checkpoint":             "ClearCheckpoint",
+	"raw_command":                  "Command",
+	"create_breakpoint":            "CreateBreakpoint",
+	"create_ebpf_tracepoint":       "CreateEBPFTracepoint",
+	"create_watchpoint":            "CreateWatchpoint",
+	"debug_info_directories":       "DebugInfoDirectories",
+	"detach":                       "Detach",
+	"disassemble":                  "Disassemble",
+	"download_library_debug_info":  "DownloadLibraryDebugInfo",
+	"dump_cancel":                  "DumpCancel",
+	"dump_start":                   "DumpStart",
+	"dump_wait":                    "DumpWait",
+	"eval":                         "Eval",
+	"examine_memory":               "ExamineMemory",
+	"find_location":                "FindLocation",
+	"follow_exec":                  "FollowExec",
+	"follow_exec_enabled":          "FollowExecEnabled",
+	"function_return_locations":    "FunctionReturnLocations",
+	"get_breakpoint":               "GetBreakpoint",
+	"get_buffered_tracepoints":     "GetBufferedTracepoints",
+	"get_thread":                   "GetThread",
+	"guess_substitute_path":        "GuessSubstitutePath",
+	"is_multiclient":               "IsMulticlient",
+	"last_modified":                "LastModified",
+	"breakpoints":                  "ListBreakpoints",
+	"checkpoints":                  "ListCheckpoints",
+	"dynamic_libraries":            "ListDynamicLibraries",
+	"function_args":                "ListFunctionArgs",
+	"functions":                    "ListFunctions",
+	"goroutines":                   "ListGoroutines",
+	"local_vars":                   "ListLocalVars",
+	"package_vars":                 "ListPackageVars",
+	"packages_build_info":          "ListPackagesBuildInfo",
+	"registers":                    "ListRegisters",
+	"sources":                      "ListSources",
+	"targets":                      "ListTargets",
+	"threads":                      "ListThreads",
+	"types":                        "ListTypes",
+	"process_pid":                  "ProcessPid",
+	"recorded":                     "Recorded",
+	"restart":                      "Restart",
+	"set_expr":                     "Set",
+	"stacktrace":                   "Stacktrace",
+	"state":                        "State",
+	"stop_recording":               "StopRecording",
+	"toggle_breakpoint":            "ToggleBreakpoint",
+}
@@ -0,0 +1,155 @@
+package starbind
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+const (
+	spawnBuiltinName     = "spawn"
+	setStatusBuiltinName = "set_status"
+	taskLocalName        = "dlv_task"
+)
+
+// Task is a starlark function running in background, started by the spawn
+// builtin.
+type Task struct {
+	ID      int
+	Name    string
+	Started time.Time
+
+	mu       sync.Mutex
+	status   string
+	done     bool
+	err      error
+	ended    time.Time
+	cancelfn context.CancelFunc
+	thread   *starlark.Thread
+}
+
+// Status returns the last status set by the task with set_status, whether
+// the task has finished and the error it returned.
+func (task *Task) Status() (status string, done bool, err error) {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+	return task.status, task.done, task.err
+}
+
+// Elapsed returns the running time of the task.
+func (task *Task) Elapsed() time.Duration {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+	if task.done {
+		return task.ended.Sub(task.Started)
+	}
+	return time.Since(task.Started)
+}
+
+// Cancel cancels the execution of the task.
+func (task *Task) Cancel() {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+	if task.done {
+		return
+	}
+	task.cancelfn()
+	task.thread.Cancel("task cancelled")
+}
+
+// Tasks returns the list of tasks, running or finished.
+func (env *Env) Tasks() []*Task {
+	env.tasksMu.Lock()
+	defer env.tasksMu.Unlock()
+	return append([]*Task(nil), env.tasks...)
+}
+
+// ClearFinishedTasks removes all finished tasks from the list of tasks.
+func (env *Env) ClearFinishedTasks() {
+	env.tasksMu.Lock()
+	defer env.tasksMu.Unlock()
+	tasks := env.tasks[:0]
+	for _, task := range env.tasks {
+		if _, done, _ := task.Status(); !done {
+			tasks = append(tasks, task)
+		}
+	}
+	env.tasks = tasks
+}
+
+// spawn implements the spawn builtin.
+func (env *Env) spawn(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(args) < 1 {
+		return starlark.None, decorateError(thread, fmt.Errorf("wrong number of arguments"))
+	}
+	fn, ok := args[0].(starlark.Callable)
+	if !ok {
+		return starlark.None, decorateError(thread, fmt.Errorf("first argument of spawn is not a function"))
+	}
+
+	out := env.output()
+	var ctx context.Context
+	task := &Task{Name: fn.Name(), Started: time.Now()}
+	ctx, task.cancelfn = context.WithCancel(context.Background())
+	task.thread = &starlark.Thread{
+		Name: "task " + fn.Name(),
+		Print: func(thread *starlark.Thread, msg string) {
+			fmt.Fprintln(out, msg)
+		},
+		Load: env.load,
+	}
+	task.thread.SetLocal(dlvContextName, ctx)
+	task.thread.SetLocal(taskLocalName, task)
+
+	env.tasksMu.Lock()
+	env.taskCount++
+	task.ID = env.taskCount
+	env.tasks = append(env.tasks, task)
+	env.tasksMu.Unlock()
+
+	go env.runTask(task, out, fn, args[1:], kwargs)
+
+	return starlark.MakeInt(task.ID), nil
+}
+
+func (env *Env) runTask(task *Task, out io.Writer, fn starlark.Callable, args starlark.Tuple, kwargs []starlark.Tuple) {
+	env.ctx.TaskChanged(task)
+	_, err := starlark.Call(task.thread, fn, args, kwargs)
+	task.mu.Lock()
+	task.done = true
+	task.err = err
+	task.ended = time.Now()
+	task.cancelfn()
+	task.mu.Unlock()
+	if err != nil {
+		fmt.Fprintf(out, "Task %d (%s) failed: ", task.ID, task.Name)
+		printError(out, err)
+	} else {
+		fmt.Fprintf(out, "Task %d (%s) done\n", task.ID, task.Name)
+	}
+	env.ctx.TaskChanged(task)
+}
+
+// setStatus implements the set_status builtin.
+func (env *Env) setStatus(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := isCancelled(thread); err != nil {
+		return starlark.None, decorateError(thread, err)
+	}
+	var status string
+	if err := starlark.UnpackArgs(setStatusBuiltinName, args, kwargs, "Status", &status); err != nil {
+		return starlark.None, decorateError(thread, err)
+	}
+	task, _ := thread.Local(taskLocalName).(*Task)
+	if task == nil {
+		return starlark.None, decorateError(thread, fmt.Errorf("set_status called outside of a task"))
+	}
+	task.mu.Lock()
+	task.status = status
+	task.mu.Unlock()
+	env.ctx.TaskChanged(task)
+	return starlark.None, nil
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/mobile/event/key"
+)
+
+// keyChord is a key combination that can be bound to a command.
+type keyChord struct {
+	mods key.Modifiers
+	code key.Code // matched against the physical key, if not zero
+	r    rune     // matched against the character produced, if not zero
+}
+
+// keyName describes a key that can be used in a key chord, bare keys can
+// be bound without a modifier because they do not insert text in editors.
+type keyName struct {
+	name string
+	code key.Code
+	r    rune
+	bare bool
+}
+
+var keyNames = func() []keyName {
+	v := []keyName{
+		{"Enter", key.CodeReturnEnter, 0, false},
+		{"Escape", key.CodeEscape, 0, false},
+		{"Backspace", key.CodeDeleteBackspace, 0, false},
+		{"Tab", key.CodeTab, 0, false},
+		{"Space", key.CodeSpacebar, ' ', false},
+		{"Delete", key.CodeDeleteForward, 0, false},
+		{"Insert", key.CodeInsert, 0, false},
+		{"Home", key.CodeHome, 0, false},
+		{"End", key.CodeEnd, 0, false},
+		{"PageUp", key.CodePageUp, 0, false},
+		{"PageDown", key.CodePageDown, 0, false},
+		{"Up", key.CodeUpArrow, 0, false},
+		{"Down", key.CodeDownArrow, 0, false},
+		{"Left", key.CodeLeftArrow, 0, false},
+		{"Right", key.CodeRightArrow, 0, false},
+		{"Pause", key.CodePause, 0, true},
+		{"-", key.CodeHyphenMinus, '-', false},
+		{"=", key.CodeEqualSign, '=', false},
+		{"[", key.CodeLeftSquareBracket, '[', false},
+		{"]", key.CodeRightSquareBracket, ']', false},
+		{"\\", key.CodeBackslash, '\\', false},
+		{";", key.CodeSemicolon, ';', false},
+		{"'", key.CodeApostrophe, '\'', false},
+		{"`", key.CodeGraveAccent, '`', false},
+		{",", key.CodeComma, ',', false},
+		{".", key.CodeFullStop, '.', false},
+		{"/", key.CodeSlash, '/', false},
+		{"+", 0, '+', false},
+	}
+	for i := 0; i < 26; i++ {
+		v = append(v, keyName{string(rune('A' + i)), key.CodeA + key.Code(i), 0, false})
+	}
+	v = append(v, keyName{"0", key.Code0, '0', false})
+	for i := 0; i < 9; i++ {
+		v = append(v, keyName{string(rune('1' + i)), key.Code1 + key.Code(i), '1' + rune(i), false})
+	}
+	for i := 0; i < 12; i++ {
+		v = append(v, keyName{fmt.Sprintf("F%d", i+1), key.CodeF1 + key.Code(i), 0, true})
+	}
+	return v
+}()
+
+// metaKeyName is the name used for key.ModMeta.
+var metaKeyName = func() string {
+	if runtime.GOOS == "darwin" {
+		return "Cmd"
+	}
+	return "Meta"
+}()
+
+var modNames = []struct {
+	name string
+	mod  key.Modifiers
+}{
+	{"Ctrl", key.ModControl},
+	{"Alt", key.ModAlt},
+	{"Shift", key.ModShift},
+	{metaKeyName, key.ModMeta},
+}
+
+// parseKeyChord parses a key chord like "Ctrl+Shift+F5" or "Alt++".
+func parseKeyChord(s string) (keyChord, error) {
+	s = strings.TrimSpace(s)
+	var mods []string
+	var name string
+	switch {
+	case s == "":
+		return keyChord{}, fmt.Errorf("empty key chord")
+	case strings.HasSuffix(s, "+"):
+		name = "+"
+		if rest := strings.TrimSuffix(s[:len(s)-1], "+"); rest != "" {
+			mods = strings.Split(rest, "+")
+		}
+	default:
+		mods = strings.Split(s, "+")
+		name = mods[len(mods)-1]
+		mods = mods[:len(mods)-1]
+	}
+
+	var kc keyChord
+	for _, mod := range mods {
+		found := false
+		for _, mn := range modNames {
+			if strings.EqualFold(mod, mn.name) {
+				kc.mods |= mn.mod
+				found = true
+				break
+			}
+		}
+		switch {
+		case found:
+		case strings.EqualFold(mod, "Control"):
+			kc.mods |= key.ModControl
+		case strings.EqualFold(mod, "Meta"), strings.EqualFold(mod, "Cmd"), strings.EqualFold(mod, "Super"):
+			kc.mods |= key.ModMeta
+		default:
+			return keyChord{}, fmt.Errorf("unknown modifier %q in %q", mod, s)
+		}
+	}
+
+	kn := findKeyName(name)
+	if kn == nil {
+		return keyChord{}, fmt.Errorf("unknown key %q in %q", name, s)
+	}
+	if kc.mods&^key.ModShift == 0 && !kn.bare {
+		return keyChord{}, fmt.Errorf("key %q needs a Ctrl, Alt or %s modifier", s, metaKeyName)
+	}
+	kc.code, kc.r = kn.code, kn.r
+	return kc, nil
+}
+
+func findKeyName(name string) *keyName {
+	switch {
+	case strings.EqualFold(name, "Esc"):
+		name = "Escape"
+	case strings.EqualFold(name, "Return"):
+		name = "Enter"
+	case strings.EqualFold(name, "Del"):
+		name = "Delete"
+	case strings.EqualFold(name, "Plus"):
+		name = "+"
+	case strings.EqualFold(name, "Minus"):
+		name = "-"
+	}
+	for i := range keyNames {
+		if strings.EqualFold(keyNames[i].name, name) {
+			return &keyNames[i]
+		}
+	}
+	return nil
+}
+
+func (kc keyChord) String() string {
+	var b strings.Builder
+	for _, mn := range modNames {
+		if kc.mods&mn.mod != 0 {
+			b.WriteString(mn.name)
+			b.WriteString("+")
+		}
+	}
+	for _, kn := range keyNames {
+		if kn.code == kc.code && kn.r == kc.r {
+			b.WriteString(kn.name)
+			break
+		}
+	}
+	return b.String()
+}
+
+// match returns true if e is the key chord. Chords matching a character
+// ignore the shift key, since it can be needed to type the character.
+func (kc keyChord) match(e key.Event) bool {
+	if kc.code != 0 && e.Code == kc.code && e.Modifiers == kc.mods {
+		return true
+	}
+	return kc.r != 0 && e.Rune == kc.r && e.Modifiers&^key.ModShift == kc.mods&^key.ModShift
+}
+
+type keybinding struct {
+	chord keyChord
+	cmd   string
+}
+
+// keybindings is the parsed version of conf.Keybindings.
+var keybindings []keybinding
+
+// setupKeybindings parses the key bindings in the configuration.
+func setupKeybindings() {
+	keybindings = keybindings[:0]
+	for chord, cmd := range conf.Keybindings {
+		kc, err := parseKeyChord(chord)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading key binding: %v\n", err)
+			continue
+		}
+		keybindings = append(keybindings, keybinding{kc, cmd})
+	}
+	sort.Slice(keybindings, func(i, j int) bool {
+		return keybindings[i].chord.String() < keybindings[j].chord.String()
+	})
+}
+
+// findKeybinding returns the command bound to e.
+func findKeybinding(e key.Event) (string, bool) {
+	for _, kb := range keybindings {
+		if kb.chord.match(e) {
+			return kb.cmd, true
+		}
+	}
+	return "", false
+}
+
+// runKeybinding executes the command cmd bound to a key. Commands that
+// resume the target are ignored while it is running, except interrupt.
+// Must be called on the UI goroutine with the window locked.
+func runKeybinding(cmd string) {
+	name, args := parseCommand(cmd)
+	if cmdFn := uiKeybinding(name, args); cmdFn != nil {
+		// only changes the user interface, execute it immediately without
+		// echoing it in the scrollback
+		out := editorWriter{false}
+		if err := cmdFn(&out, args); err != nil {
+			fmt.Fprintf(&out, "Command failed: %s\n", err)
+		}
+		return
+	}
+	if c := cmds.findCommand(name); c != nil && (c.group == runCmds || c.group == revCmds) {
+		if client == nil {
+			return
+		}
+		if client.Running() && c.aliases[0] != "interrupt" {
+			return
+		}
+	}
+	doCommand(cmd)
+}
+
+// uiKeybinding returns the function implementing the command name, if it
+// only changes the user interface (opening windows and zooming).
+func uiKeybinding(name, args string) func(io.Writer, string) error {
+	c := cmds.findCommand(name)
+	if c == nil {
+		return nil
+	}
+	switch {
+	case c.aliases[0] == "window":
+		return windowCommand
+	case c.aliases[0] == "config" && strings.HasPrefix(args, "zoom "):
+		return configCommand
+	}
+	return nil
+}
+
+var steppingKeybindings = map[string][]string{
+	"default": {
+		"F5", "continue",
+		"Alt+Enter", "continue",
+		"F10", "next",
+		"Alt+Right", "next",
+		"F11", "step",
+		"Alt+Down", "step",
+		"Shift+F11", "stepout",
+		"Alt+Up", "stepout",
+		"Shift+F5", "interrupt",
+		"Ctrl+Delete", "interrupt",
+	},
+	"vs": {
+		"F5", "continue",
+		"F10", "next",
+		"F11", "step",
+		"Shift+F11", "stepout",
+		"Ctrl+Alt+Pause", "interrupt",
+	},
+	"goland": {
+		"F9", "continue",
+		"F8", "next",
+		"F7", "step",
+		"Shift+F8", "stepout",
+	},
+	"gdb": {
+		"F9", "continue",
+		"F6", "next",
+		"Shift+F6", "next-instruction",
+		"F5", "step",
+		"Shift+F5", "step-instruction",
+		"F8", "stepout",
+		"Ctrl+Pause", "interrupt",
+	},
+}
+
+// defaultKeybindings returns the key bindings used when the configuration
+// does not specify any.
+func defaultKeybindings() map[string]string {
+	r := map[string]string{
+		zoomMetaKeyStr + "++": "config zoom in",
+		zoomMetaKeyStr + "+=": "config zoom in",
+		// mitigation for shiny bug on macOS (see https://github.com/aarzilli/gdlv/issues/39)
+		zoomMetaKeyStr + "+Shift+=": "config zoom in",
+		zoomMetaKeyStr + "+-":       "config zoom out",
+		zoomMetaKeyStr + "+0":       "config zoom reset",
+	}
+	for i, w := range []string{infoListing, infoLocals, infoGlobal, infoRegisters, infoBps, infoStacktrace, infoDisassembly, infoGoroutines, infoThreads} {
+		r[fmt.Sprintf("Alt+%d", i+1)] = "window " + strings.ToLower(w)
+	}
+	applyKeybindingPreset(r, "default")
+	return r
+}
+
+// applyKeybindingPreset replaces the bindings of the commands that resume
+// or stop the target with the ones of the named preset.
+func applyKeybindingPreset(bindings map[string]string, name string) error {
+	preset, ok := steppingKeybindings[name]
+	if !ok {
+		return fmt.Errorf("unknown preset %q", name)
+	}
+	stepping := map[string]bool{}
+	for _, v := range steppingKeybindings {
+		for i := 1; i < len(v); i += 2 {
+			stepping[v[i]] = true
+		}
+	}
+	for chord, cmd := range bindings {
+		if stepping[cmd] {
+			delete(bindings, chord)
+		}
+	}
+	for i := 0; i < len(preset); i += 2 {
+		bindings[preset[i]] = preset[i+1]
+	}
+	return nil
+}
+
+// configureBind implements 'config bind'.
+func configureBind(out io.Writer, rest string) error {
+	if rest == "" {
+		return printKeybindings(out)
+	}
+	chord, cmd, _ := strings.Cut(rest, " ")
+	cmd = strings.TrimSpace(cmd)
+	if chord == "preset" {
+		if err := applyKeybindingPreset(conf.Keybindings, cmd); err != nil {
+			return err
+		}
+	} else {
+		kc, err := parseKeyChord(chord)
+		if err != nil {
+			return err
+		}
+		for k := range conf.Keybindings {
+			if kc2, err := parseKeyChord(k); err == nil && kc2 == kc {
+				delete(conf.Keybindings, k)
+			}
+		}
+		if cmd != "" {
+			name, _ := parseCommand(cmd)
+			if cmds.findCommand(name) == nil {
+				return fmt.Errorf("could not find command %q", name)
+			}
+			conf.Keybindings[kc.String()] = cmd
+		}
+	}
+	setupKeybindings()
+	saveConfiguration()
+	return nil
+}
+
+func printKeybindings(out io.Writer) error {
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 0, ' ', 0)
+	for _, kb := range keybindings {
+		fmt.Fprintf(w, "    %s \t %s\n", kb.chord, kb.cmd)
+	}
+	return w.Flush()
+}
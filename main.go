@@ -14,6 +14,7 @@ import (
 	"runtime/pprof"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aarzilli/gdlv/internal/assets"
@@ -23,7 +24,6 @@ import (
 	"github.com/aarzilli/nucular/font"
 	"github.com/aarzilli/nucular/rect"
 	"github.com/aarzilli/nucular/richtext"
-	nstyle "github.com/aarzilli/nucular/style"
 
 	"golang.org/x/mobile/event/key"
 )
@@ -48,12 +48,16 @@ var downloadsMu sync.Mutex
 var downloadsInProgress = false
 
 var (
-	linkColor      = color.RGBA{0x00, 0x88, 0xdd, 0xff}
-	linkHoverColor = color.RGBA{0x00, 0xaa, 0xff, 0xff}
+	linkColor               = color.RGBA{0x00, 0x88, 0xdd, 0xff}
+	linkHoverColor          = color.RGBA{0x00, 0xaa, 0xff, 0xff}
+	breakpointColor         = color.RGBA{0xff, 0x00, 0x00, 0xff}
+	disabledBreakpointColor = color.RGBA{0x80, 0x00, 0x00, 0x80}
+	currentLineColor        = color.RGBA{0xff, 0xff, 0x00, 0xff}
 )
 
 const (
 	arrowIconChar      = "\uf061"
+	runTestIconChar    = "\uf04b"
 	breakpointIconChar = "\uf28d"
 
 	interruptIconChar = "\uEAD1"
@@ -65,20 +69,7 @@ const (
 )
 
 func setupStyle() {
-	switch conf.Theme {
-	default:
-		fallthrough
-	case darkTheme:
-		wnd.SetStyle(nstyle.FromTheme(nstyle.DarkTheme, conf.Scaling))
-	case whiteTheme:
-		wnd.SetStyle(nstyle.FromTheme(nstyle.WhiteTheme, conf.Scaling))
-	case redTheme:
-		wnd.SetStyle(nstyle.FromTheme(nstyle.RedTheme, conf.Scaling))
-	case boringTheme:
-		style := makeBoringStyle()
-		style.Scale(conf.Scaling)
-		wnd.SetStyle(style)
-	}
+	wnd.SetStyle(themeStyle(conf.Theme, conf.Scaling))
 
 	fontInit.Do(func() {
 		iconFontData, _ = assets.Asset("fontawesome-webfont.ttf")
@@ -184,6 +175,10 @@ var listingPanel struct {
 	stepIntoInfo   stepIntoInfo
 	stepIntoFilled bool
 
+	sel listingSelection
+
+	tests map[int]listingTest // tests and subtests defined in file, by line
+
 	disassHoverIdx      int
 	disassHoverClickIdx int
 	centerOnDisassHover bool
@@ -234,99 +229,29 @@ func guiUpdate(w *nucular.Window) {
 
 	mw := w.Master()
 
+	// updateTerminal sets focusing when the terminal panel has keyboard
+	// focus, focused is the value it had during the previous frame
+	terminalPanel.focused, terminalPanel.focusing = terminalPanel.focusing, false
+
 	for _, e := range wnd.Input().Keyboard.Keys {
 		switch {
-		case (e.Modifiers&zoomMetaKey != 0) && e.Code == key.CodeEqualSign:
-			// mitigation for shiny bug on macOS (see https://github.com/aarzilli/gdlv/issues/39)
-			fallthrough
-		case (e.Modifiers&zoomMetaKey != 0) && e.Rune == '+':
-			conf.Scaling += 0.1
-			setupStyle()
-
-		case (e.Modifiers&zoomMetaKey != 0) && e.Code == key.CodeHyphenMinus:
-			// mitigation for shiny bug on macOS (see https://github.com/aarzilli/gdlv/issues/39)
-			fallthrough
-		case (e.Modifiers&zoomMetaKey != 0) && e.Rune == '-':
-			conf.Scaling -= 0.1
-			setupStyle()
-
-		case (e.Modifiers&zoomMetaKey != 0) && e.Rune == '0':
-			conf.Scaling = 1.0
-			setupStyle()
-
-		case (e.Modifiers == key.ModControl) && (e.Code == key.CodeF):
+		case (e.Modifiers == key.ModControl|key.ModShift) && (e.Code == key.CodeF):
+			// Ctrl+F searches the scrollback, see updateScrollbackSearch
 			mw.SetPerf(!mw.GetPerf())
 
-		case (e.Modifiers == 0) && (e.Code == key.CodeEscape):
+		case (e.Modifiers == 0) && (e.Code == key.CodeEscape) && !terminalPanel.focused:
 			mw.ActivateEditor(findWindow(infoCommand), &commandLineEditor)
 			mw.Changed()
 
-		case (e.Modifiers == key.ModAlt) && (e.Code == key.CodeReturnEnter):
-			fallthrough
-		case (e.Modifiers == 0) && (e.Code == key.CodeF5):
-			if !client.Running() && client != nil {
-				doCommand("continue")
-			}
-
-		case (e.Modifiers == 0) && (e.Code == key.CodeF10):
-			fallthrough
-		case (e.Modifiers == key.ModAlt) && (e.Code == key.CodeRightArrow):
-			if !client.Running() && client != nil {
-				doCommand("next")
-			}
-
-		case (e.Modifiers == 0) && (e.Code == key.CodeF11):
-			fallthrough
-		case (e.Modifiers == key.ModAlt) && (e.Code == key.CodeDownArrow):
-			if !client.Running() && client != nil {
-				doCommand("step")
-			}
-
-		case (e.Modifiers == key.ModShift) && (e.Code == key.CodeF11):
-			fallthrough
-		case (e.Modifiers == key.ModAlt) && (e.Code == key.CodeUpArrow):
-			if !client.Running() && client != nil {
-				doCommand("stepout")
-			}
-
-		case (e.Modifiers == key.ModShift) && (e.Code == key.CodeF5):
-			fallthrough
-		case (e.Modifiers == key.ModControl) && (e.Code == key.CodeDeleteForward):
-			if client != nil {
-				doCommand("interrupt")
-			}
-
 		case (e.Modifiers == key.ModShift) && (e.Code == key.CodeReturnEnter):
 			if findWindow(infoLocals) != nil {
 				go addExpression("", true)
 			}
 
-		case (e.Modifiers == key.ModAlt) && (e.Code == key.Code1):
-			openWindow(infoListing)
-
-		case (e.Modifiers == key.ModAlt) && (e.Code == key.Code2):
-			openWindow(infoLocals)
-
-		case (e.Modifiers == key.ModAlt) && (e.Code == key.Code3):
-			openWindow(infoGlobal)
-
-		case (e.Modifiers == key.ModAlt) && (e.Code == key.Code4):
-			openWindow(infoRegisters)
-
-		case (e.Modifiers == key.ModAlt) && (e.Code == key.Code5):
-			openWindow(infoBps)
-
-		case (e.Modifiers == key.ModAlt) && (e.Code == key.Code6):
-			openWindow(infoStacktrace)
-
-		case (e.Modifiers == key.ModAlt) && (e.Code == key.Code7):
-			openWindow(infoDisassembly)
-
-		case (e.Modifiers == key.ModAlt) && (e.Code == key.Code8):
-			openWindow(infoGoroutines)
-
-		case (e.Modifiers == key.ModAlt) && (e.Code == key.Code9):
-			openWindow(infoThreads)
+		default:
+			if cmd, ok := findKeybinding(e); ok {
+				runKeybinding(cmd)
+			}
 		}
 	}
 
@@ -397,16 +322,16 @@ func updateCommandPanel(w *nucular.Window) {
 	w.LayoutReserveRow(commandLineHeight, 1)
 	commandToolbar(w)
 
+	updateScrollbackSearch(w)
+
 	w.Row(0).Dynamic(1)
 	if c := scrollbackEditor.Widget(w, scrollbackClear); c != nil {
 		c.SetStyle(richtext.TextStyle{Cursor: font.TextCursor})
 		scrollbackClear = false
 		c.Align(richtext.AlignLeftDumb)
-		if len(scrollbackPreInitWrite) > 0 {
-			c.Text(string(scrollbackPreInitWrite))
-		}
+		n := renderScrollback(c, style)
 		c.End()
-		scrollbackEditor.Sel.S = int32(len(scrollbackPreInitWrite))
+		scrollbackEditor.Sel.S = int32(n)
 		scrollbackEditor.Sel.E = scrollbackEditor.Sel.S
 		scrollbackEditor.FollowCursor()
 		scrollbackMu.Lock()
@@ -428,7 +353,7 @@ func updateCommandPanel(w *nucular.Window) {
 
 	if client.Running() {
 		//commandLineEditor.Flags |= nucular.EditReadOnly
-		if !commandLineEditor.Active {
+		if !commandLineEditor.Active && !terminalPanel.focused {
 			w.Master().ActivateEditor(w, &commandLineEditor)
 		}
 	} else {
@@ -461,7 +386,9 @@ func updateCommandPanel(w *nucular.Window) {
 				historyShown = -1
 				showHistory = true
 			case k.Modifiers == 0 && k.Code == key.CodeDeleteBackspace && historySearch:
-				historyNeedle = historyNeedle[:len(historyNeedle)]
+				if len(historyNeedle) > 0 {
+					historyNeedle = historyNeedle[:len(historyNeedle)-1]
+				}
 			}
 		}
 		if historySearch && kbd.Text != "" && kbd.Text != "\n" {
@@ -495,7 +422,7 @@ func updateCommandPanel(w *nucular.Window) {
 		if scriptRunning {
 			fmt.Fprintf(&scrollbackOut, "a script is running\n")
 		} else if starlarkMode != nil {
-			cmdhistory = append(cmdhistory, cmd)
+			addHistory(cmd)
 			historyShown = len(cmdhistory)
 			fmt.Fprintf(&scrollbackOut, "%s %s\n", p, cmd)
 			starlarkMode <- cmd
@@ -508,7 +435,7 @@ func updateCommandPanel(w *nucular.Window) {
 					cmd = "help"
 				}
 			} else {
-				cmdhistory = append(cmdhistory, cmd)
+				addHistory(cmd)
 				fmt.Fprintf(&scrollbackOut, "%s %s\n", p, cmd)
 			}
 			historyShown = len(cmdhistory)
@@ -642,6 +569,9 @@ func refreshState(toframe refreshToFrame, clearKind clearKind, state *api.Debugg
 	defer wnd.Changed()
 
 	if clearKind == clearStop {
+		defer func() {
+			callStopHooks(state)
+		}()
 		oldGid = curGid
 		oldThread = curThread
 		oldFrameOffset = curFrameOffset
@@ -672,15 +602,23 @@ func refreshState(toframe refreshToFrame, clearKind clearKind, state *api.Debugg
 			}
 
 			wnd.Unlock()
+			state = nil
+			callExitHook(err)
 			return
 		}
 	} else if state != nil && state.Err != nil {
 		state2, err := client.GetState()
 		if err == nil && state2.Err == nil {
 			state = state2
+		} else {
+			callExitHook(state.Err)
 		}
 	}
 
+	if state.Err == nil && !state.Exited {
+		atomic.StoreInt32(&exitHookDone, 0)
+	}
+
 	wnd.Lock()
 	defer wnd.Unlock()
 
@@ -735,6 +673,9 @@ func refreshState(toframe refreshToFrame, clearKind clearKind, state *api.Debugg
 		breakpointsPanel.asyncLoad.clear()
 		checkpointsPanel.asyncLoad.clear()
 		listingPanel.pinnedLoc = nil
+		for _, p := range scriptPanels {
+			p.asyncLoad.clear()
+		}
 		silenced = false
 
 		bpcount := 0
@@ -899,6 +840,9 @@ func loadDisassembly(p *asyncLoad) {
 }
 
 func loadListing(loc *api.Location, failstate func(string, error)) {
+	if loc == nil || loc.File != listingPanel.file {
+		listingPanel.sel = listingSelection{}
+	}
 	listingPanel.listing = listingPanel.listing[:0]
 	listingPanel.recenterListing = true
 
@@ -915,6 +859,7 @@ func loadListing(loc *api.Location, failstate func(string, error)) {
 
 	listingPanel.file = loc.File
 	listingPanel.abbrevFile = abbrevFileName(loc.File)
+	listingPanel.tests = nil
 
 	if loc.File == "<autogenerated>" {
 		return
@@ -963,6 +908,10 @@ func loadListing(loc *api.Location, failstate func(string, error)) {
 	for i := range listingPanel.listing {
 		listingPanel.listing[i].idx = fmt.Sprintf("%*d", d, i+1)
 	}
+
+	if strings.HasSuffix(loc.File, "_test.go") && BackendServer.isTest() {
+		listingPanel.tests = findListingTests(conf.substitutePath(loc.File))
+	}
 }
 
 func applyBreakpoints(failstate func(string, error)) {
@@ -1034,7 +983,14 @@ Options must appear before the command and include:
 
 	-d <dir>			builds inside the specified directory instead of the current directory (for debug and test)
 	-tags <taglist>			list of tags to pass to 'go build'
+	-buildflags <flags>		additional flags to pass to 'go build', for example -buildflags '-race -mod=vendor'
+	-profile <name>			uses the build profile <name> from the configuration file
 	-r [stdin|stdout|stderr:]path	redirects a standard file descriptor to a file, if none is specified stdin is implied
+	-env <name>=<value>		adds a variable to the environment of the target program, can be repeated
+	-env-file <path>		reads environment variables for the target program from a file, one name=value per line
+	-wd <dir>			working directory of the target program
+	-launch <name>			uses the launch configuration <name> from .gdlv/config.json, can not be used with a command
+	-tty				runs the target in a pseudo-terminal, shown in the Terminal panel (Linux only)
 `)
 	os.Exit(1)
 }
@@ -1082,11 +1038,73 @@ optionsLoop:
 				usage(fmt.Sprintf("redirect error: %s redirected twice", names[idx]))
 			}
 			opts.redirects[idx] = redirect
+		case "-buildflags":
+			i++
+			if i >= len(args) {
+				usage("wrong number of arguments after -buildflags")
+			}
+			opts.buildFlags = args[i]
+			i++
+		case "-profile":
+			i++
+			if i >= len(args) {
+				usage("wrong number of arguments after -profile")
+			}
+			opts.profile = args[i]
+			i++
+		case "-env":
+			i++
+			if i >= len(args) {
+				usage("wrong number of arguments after -env")
+			}
+			if !strings.Contains(args[i], "=") {
+				usage(fmt.Sprintf("wrong argument to -env %q, expected name=value", args[i]))
+			}
+			opts.env = append(opts.env, args[i])
+			i++
+		case "-env-file":
+			i++
+			if i >= len(args) {
+				usage("wrong number of arguments after -env-file")
+			}
+			env, err := readEnvFile(args[i])
+			if err != nil {
+				usage(fmt.Sprintf("could not read environment file: %v", err))
+			}
+			opts.env = append(opts.env, env...)
+			i++
+		case "-wd":
+			i++
+			if i >= len(args) {
+				usage("wrong number of arguments after -wd")
+			}
+			opts.wd = args[i]
+			i++
+		case "-launch":
+			i++
+			if i >= len(args) {
+				usage("wrong number of arguments after -launch")
+			}
+			opts.launch = args[i]
+			i++
+		case "-tty":
+			i++
+			opts.tty = true
 		default:
 			break optionsLoop
 		}
 	}
 
+	if opts.launch != "" {
+		if opts.buildDir != "" || opts.tags != "" || opts.buildFlags != "" || opts.profile != "" || opts.redirects != [3]string{} {
+			usage("only -env, -env-file, -wd and -tty can be used with -launch")
+		}
+		if i < len(args) {
+			usage("can not specify a command with -launch")
+		}
+		return opts
+	}
+
 	if i >= len(args) {
 		usage("wrong number of arguments, expected a command")
 	}
@@ -1115,7 +1133,13 @@ type commandLineOptions struct {
 	defaultBackend bool
 	buildDir       string
 	tags           string
+	buildFlags     string
+	profile        string
 	redirects      [3]string
+	env            []string
+	wd             string
+	launch         string
+	tty            bool
 }
 
 func main() {
@@ -1125,6 +1149,8 @@ func main() {
 	}
 
 	loadConfiguration()
+	loadProjectConfiguration()
+	loadHistory()
 
 	if profileEnabled {
 		if f, err := os.Create("cpu.pprof"); err == nil {
@@ -1177,9 +1203,12 @@ To change font size use Ctrl-plus/Ctrl-minus or the 'config zoom' command.
 	executeInit()
 
 	go BackendServer.Start()
+	go watchSources()
 
 	wnd.OnClose(func() {
 		BackendServer.Close()
+		closeScrollbackSpool()
+		closeOutputSpool()
 		os.Exit(0)
 	})
 
@@ -1,10 +1,28 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
 	"github.com/aarzilli/gdlv/internal/prettyprint"
+	"github.com/aarzilli/gdlv/internal/starbind"
+	"github.com/aarzilli/nucular"
+
+	"go.starlark.net/starlark"
+	"golang.org/x/mobile/event/key"
 )
 
 func TestShortenType(t *testing.T) {
@@ -69,3 +87,1143 @@ func TestWrapInstruction(t *testing.T) {
 	c("rex.w blah", "rex.w blah", "")
 	c("rex.w blah arg1", "rex.w blah", "arg1")
 }
+
+func TestParsePanelCode(t *testing.T) {
+	c := func(src, tgtm, tgtrest string) {
+		t.Helper()
+		m, rest := parsePanelCode(src)
+		if m != tgtm || rest != tgtrest {
+			t.Errorf("for %q expected %q %q got %q %q", src, tgtm, tgtrest, m, rest)
+		}
+	}
+
+	c("LC", infoListing, "C")
+	c("*queue*C", "queue", "C")
+	c("*queue*", "queue", "")
+	c("*", "", "")
+
+	if code := panelCode("queue"); code != "*queue*" {
+		t.Errorf("wrong code for script panel %q", code)
+	}
+	if code := panelCode(infoLocals); code != "l" {
+		t.Errorf("wrong code for locals panel %q", code)
+	}
+}
+
+func TestStarlarkMappingUpToDate(t *testing.T) {
+	out, err := exec.Command("go", "run", "_scripts/gen-starlark-bindings.go", "-check").CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+}
+
+func TestLaunchConfig(t *testing.T) {
+	lc := &LaunchConfig{Command: "rr:exec", Args: []string{"./prog", "arg1"}, Stdin: "in.txt", WorkingDir: "/tmp"}
+	opts := lc.commandLineOptions()
+	if opts.cmd != "exec" || opts.backend != "--backend=rr" || opts.defaultBackend {
+		t.Fatalf("wrong options %#v", opts)
+	}
+	descr, err := newServerDescr(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tgt := "-r stdin:in.txt --wd /tmp --backend=rr --headless exec ./prog -- arg1"
+	if out := strings.Join(descr.dlvargs, " "); out != tgt {
+		t.Errorf("expected %q got %q", tgt, out)
+	}
+
+	descr.setenv("A=1")
+	descr.setenv("B=2")
+	descr.setenv("A")
+	if out := strings.Join(descr.env, " "); out != "B=2" || !descr.envChanged {
+		t.Errorf("wrong environment %q", out)
+	}
+	os.Setenv("GDLV_TEST_INHERITED", "1")
+	defer os.Unsetenv("GDLV_TEST_INHERITED")
+	descr.setenv("GDLV_TEST_INHERITED")
+	for _, kv := range descr.environ() {
+		if strings.HasPrefix(kv, "GDLV_TEST_INHERITED=") || strings.HasPrefix(kv, "A=") {
+			t.Errorf("variable %q not removed", kv)
+		}
+	}
+	descr.setenv("GDLV_TEST_INHERITED=2")
+	if len(descr.unsetenv) != 1 || descr.unsetenv[0] != "A" {
+		t.Errorf("wrong removed variables %q", descr.unsetenv)
+	}
+	descr.setenv("GDLV_TEST_INHERITED")
+	descr2, err := descr.relaunchDescr(true, []string{"arg2", ">out.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tgt = "-r stdout:out.txt --wd /tmp --backend=rr --headless exec ./prog -- arg2"
+	if out := strings.Join(descr2.dlvargs, " "); out != tgt {
+		t.Errorf("expected %q got %q", tgt, out)
+	}
+
+	lc = &LaunchConfig{Command: "core", Args: []string{"exe", "core"}, Tags: "foo"}
+	opts = lc.commandLineOptions()
+	if _, err := newServerDescr(&opts); err == nil {
+		t.Errorf("expected error for -tags with core")
+	}
+	opts = commandLineOptions{cmd: "exec", cmdArgs: []string{"./prog"}, redirects: [3]string{"in.txt"}, tty: true}
+	if _, err := newServerDescr(&opts); err == nil {
+		t.Errorf("expected error for -tty with -r")
+	}
+
+	// validating a launch configuration must not have side effects
+	opts = commandLineOptions{cmd: "debug", backend: "--backend=default", defaultBackend: true, tty: true}
+	descr, err = newServerDescr(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(descr.exe); err == nil {
+		t.Errorf("executable file %s created", descr.exe)
+	}
+	if terminalPanel.path != "" || !descr.tty || descr.keepExecutable {
+		t.Errorf("wrong terminal state %q %v %v", terminalPanel.path, descr.tty, descr.keepExecutable)
+	}
+}
+
+func TestBuildProfile(t *testing.T) {
+	conf.BuildProfiles = map[string]BuildProfile{"opt": {Flags: "-race -ldflags '-s -w'", Optimized: true}}
+	defer func() { conf.BuildProfiles = nil }()
+	descr := &ServerDescr{exe: "exe"}
+	opts := &commandLineOptions{cmd: "test", tags: "foo", buildFlags: "-trimpath", profile: "opt"}
+	if err := descr.setBuildCommand(opts); err != nil {
+		t.Fatal(err)
+	}
+	tgt := "test -tags foo -race -ldflags -s -w -trimpath -c -o exe"
+	if out := strings.Join(descr.buildcmd, " "); out != tgt {
+		t.Errorf("expected %q got %q", tgt, out)
+	}
+	if !descr.isTest() || (&ServerDescr{buildcmd: []string{"build", "-o", "exe"}}).isTest() {
+		t.Errorf("wrong test executable detection")
+	}
+	opts.profile = "unknown"
+	if err := descr.setBuildCommand(opts); err == nil {
+		t.Errorf("expected error for unknown profile")
+	}
+}
+
+func TestParseBuildErrors(t *testing.T) {
+	out := `# example.com/foo
+./main.go:10:2: undefined: x
+./main.go:12:6: cannot use y (variable of type int) as string value in assignment
+	have (int)
+	want (string)
+/abs/path/other.go:3: syntax error
+C:\src\foo\win.go:12:3: undefined: z
+`
+	errs := parseBuildErrors(out, "/src/foo")
+	tgt := []buildError{
+		{"/src/foo/main.go", 10, 2, "undefined: x"},
+		{"/src/foo/main.go", 12, 6, "cannot use y (variable of type int) as string value in assignment\nhave (int)\nwant (string)"},
+		{"/abs/path/other.go", 3, 0, "syntax error"},
+		{`C:\src\foo\win.go`, 12, 3, "undefined: z"},
+	}
+	if len(errs) != len(tgt) {
+		t.Fatalf("wrong number of errors %#v", errs)
+	}
+	for i := range tgt {
+		if errs[i] != tgt[i] {
+			t.Errorf("expected %#v got %#v", tgt[i], errs[i])
+		}
+	}
+}
+
+func TestFindTestFuncs(t *testing.T) {
+	funcs := []string{
+		"main.main",
+		"testing.tRunner",
+		"testing.TestMain",
+		"example.com/foo.TestFoo",
+		"example.com/foo.TestFoo.func1",
+		"example.com/foo.Testify",
+		"example.com/foo.BenchmarkBar",
+		"example.com/foo.FuzzParse",
+		"example.com/foo.Example",
+		"example.com/foo.ExampleFoo_Bar",
+		"example.com/foo.(*T).TestMethod",
+		"example.com/foo.T.TestMethod",
+		"example.com/foo.t.TestMethod",
+		"example.com/foo.Test_under",
+		"example.com/foo.TestMain",
+		"example.com/foo.TestFoo.func1.TestInner",
+		"example.com/foo.TestFoo-range1",
+		"gopkg.in/yaml.v3.TestYAML",
+		"example.com.TestRoot",
+	}
+	tgt := []testFunc{
+		{"Benchmark", "BenchmarkBar"},
+		{"Example", "ExampleFoo_Bar"},
+		{"Fuzz", "FuzzParse"},
+		{"Test", "TestFoo"},
+		{"Test", "TestRoot"},
+		{"Test", "TestYAML"},
+		{"Test", "Test_under"},
+	}
+	out := findTestFuncs(funcs)
+	if len(out) != len(tgt) {
+		t.Fatalf("expected %v got %v", tgt, out)
+	}
+	for i := range tgt {
+		if out[i] != tgt[i] {
+			t.Errorf("expected %v got %v", tgt, out)
+			break
+		}
+	}
+
+	args := strings.Join(testArgs(out, map[string]bool{"TestFoo": true, "BenchmarkBar": true, "FuzzParse": true}), " ")
+	if args != "-run ^(FuzzParse|TestFoo)$ -bench ^(BenchmarkBar)$" {
+		t.Errorf("wrong arguments %q", args)
+	}
+}
+
+func TestFindListingTests(t *testing.T) {
+	const src = `package foo
+
+import "testing"
+
+func TestFoo(t *testing.T) {
+	x := 1
+	t.Run("sub test", func(t *testing.T) {
+		t.Run("a.b", func(t *testing.T) {
+			_ = x
+		})
+	})
+	t.Run("in/out\x01\u00a0", func(t *testing.T) {
+		_ = x
+	})
+}
+
+func TestMain(m *testing.M) {
+}
+`
+	path := filepath.Join(t.TempDir(), "foo_test.go")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tgt := map[int]listingTest{
+		5:  {`^TestFoo$`, 6},
+		7:  {`^TestFoo$/^sub_test$`, 8},
+		8:  {`^TestFoo$/^sub_test$/^a\.b$`, 9},
+		12: {`^TestFoo$/^in$/^out\\x01_$`, 13},
+	}
+	out := findListingTests(path)
+	if len(out) != len(tgt) {
+		t.Fatalf("expected %v got %v", tgt, out)
+	}
+	for k := range tgt {
+		if out[k] != tgt[k] {
+			t.Errorf("line %d: expected %v got %v", k, tgt[k], out[k])
+		}
+	}
+	if p := subtestPattern(""); p != "^#00$" {
+		t.Errorf("wrong pattern for empty subtest name %q", p)
+	}
+}
+
+func TestPrettyPrinters(t *testing.T) {
+	num := func(name, typ string, n uint64) api.Variable {
+		return api.Variable{Name: name, Type: typ, Kind: reflect.Uint64, Value: strconv.FormatUint(n, 10)}
+	}
+	bytesVar := func(name string, b []byte, n int64) api.Variable {
+		v := api.Variable{Name: name, Type: "[]uint8", Kind: reflect.Slice, Len: n}
+		for _, c := range b {
+			v.Children = append(v.Children, num("", "uint8", uint64(c)))
+		}
+		return v
+	}
+	c := func(v api.Variable, tgt string) {
+		t.Helper()
+		out, _ := prettyprint.Pretty(&v)
+		if out != tgt {
+			t.Errorf("for %s expected %q got %q", v.Type, tgt, out)
+		}
+	}
+
+	c(api.Variable{Type: "time.Duration", Kind: reflect.Int64, Value: "1500000000"}, "1.5s")
+	bigInt := func(wordSize uint64) api.Variable {
+		w0, w1 := num("", "math/big.Word", 0), num("", "math/big.Word", 1)
+		w0.Addr, w1.Addr = 0x1000, 0x1000+wordSize
+		return api.Variable{Type: "math/big.Int", Kind: reflect.Struct, Children: []api.Variable{
+			{Name: "neg", Kind: reflect.Bool, Value: "true"},
+			{Name: "abs", Kind: reflect.Slice, Len: 2, Children: []api.Variable{w0, w1}},
+		}}
+	}
+	c(bigInt(8), "-18446744073709551616")
+	c(bigInt(4), "-4294967296")
+	c(api.Variable{Type: "sync.Mutex", Kind: reflect.Struct, Children: []api.Variable{
+		{Name: "mu", Type: "internal/sync.Mutex", Kind: reflect.Struct, Children: []api.Variable{{Name: "state", Kind: reflect.Int32, Value: "17"}}},
+	}}, "locked, 2 waiters")
+	c(api.Variable{Type: "sync.WaitGroup", Kind: reflect.Struct, Children: []api.Variable{
+		{Name: "state", Type: "sync/atomic.Uint64", Kind: reflect.Struct, Children: []api.Variable{num("v", "uint64", 3<<32|1)}},
+	}}, "counter 3, 1 waiter")
+	ip := bytesVar("", []byte{10, 0, 0, 1}, 4)
+	ip.Type = "net.IP"
+	c(ip, "10.0.0.1")
+	c(api.Variable{Type: "bytes.Buffer", Kind: reflect.Struct, Children: []api.Variable{
+		bytesVar("buf", []byte("hello"), 5),
+		{Name: "off", Kind: reflect.Int, Value: "2"},
+	}}, `"llo"`)
+	c(api.Variable{Type: "error", Kind: reflect.Interface, Addr: 0x1000, Children: []api.Variable{{Kind: reflect.Invalid}}}, "")
+
+	// pretty-printers are also used when printing the fields of a variable
+	s := api.Variable{Type: "main.T", Kind: reflect.Struct, Len: 1, Children: []api.Variable{
+		{Name: "d", Type: "time.Duration", Kind: reflect.Int64, Value: "1500000000"},
+	}}
+	if out := prettyprint.Singleline(&s, false, false); out != "{d: 1.5s}" {
+		t.Errorf("wrong single line output %q", out)
+	}
+}
+
+func TestErrorChain(t *testing.T) {
+	errVar := func(typ string, fields ...api.Variable) api.Variable {
+		return api.Variable{Type: "error", Kind: reflect.Interface, Children: []api.Variable{
+			{Name: "data", Type: typ, Kind: reflect.Ptr, Children: []api.Variable{
+				{Type: typ[1:], Kind: reflect.Struct, Len: int64(len(fields)), Children: fields},
+			}},
+		}}
+	}
+	str := func(name, s string) api.Variable {
+		return api.Variable{Name: name, Type: "string", Kind: reflect.String, Value: s, Len: int64(len(s))}
+	}
+	field := func(name string, v api.Variable) api.Variable {
+		v.Name = name
+		return v
+	}
+
+	notexist := errVar("*errors.errorString", str("s", "file does not exist"))
+	patherr := errVar("*io/fs.PathError", str("Op", "open"), str("Path", "/tmp/x"), field("Err", notexist))
+	custom := errVar("*main.myError", str("code", "12"))
+	joined := errVar("*errors.joinError", api.Variable{Name: "errs", Type: "[]error", Kind: reflect.Slice, Len: 2, Children: []api.Variable{patherr, custom}})
+	wrapped := errVar("*fmt.wrapError", str("msg", "loading: open /tmp/x: file does not exist"), field("err", patherr))
+
+	msg, ok := prettyprint.ErrorMessage(&patherr)
+	if !ok || msg != "open /tmp/x: file does not exist" {
+		t.Errorf("wrong message for PathError %q %v", msg, ok)
+	}
+	if _, ok := prettyprint.ErrorMessage(&joined); ok {
+		t.Errorf("message of joinError containing an unknown error should not be computed")
+	}
+	if out, _ := prettyprint.Pretty(&wrapped); out != `"loading: open /tmp/x: file does not exist"` {
+		t.Errorf("wrong pretty printing of wrapError %q", out)
+	}
+
+	chain := func(v api.Variable) []string {
+		var r []string
+		for _, e := range unwrapErrors(wrapApiVariable("", &v, "err", "err", false, nil, 0)) {
+			r = append(r, e.Children[0].Type)
+		}
+		return r
+	}
+	if tgt, out := []string{"*io/fs.PathError"}, chain(wrapped); !reflect.DeepEqual(tgt, out) {
+		t.Errorf("wrong unwrap of wrapError, expected %v got %v", tgt, out)
+	}
+	if tgt, out := []string{"*io/fs.PathError", "*main.myError"}, chain(joined); !reflect.DeepEqual(tgt, out) {
+		t.Errorf("wrong unwrap of joinError, expected %v got %v", tgt, out)
+	}
+	if out := chain(notexist); len(out) != 0 {
+		t.Errorf("errorString should not wrap anything, got %v", out)
+	}
+}
+
+func TestTypeFormatters(t *testing.T) {
+	err := prettyprint.SetTypeFormatters([]*prettyprint.TypeFormatter{
+		{Type: "main.Stack", Summary: "{{len .items}} items", Children: []prettyprint.SyntheticChild{{Name: "top", Expr: "{{expr}}.items[{{len .items}}-1]"}}},
+		{TypeRegexp: `main\.Pair\[.*\]`, Summary: "<{{.a}}, {{.b.name}}>"},
+		{Type: "main.Broken", Summary: "{{.missing}}"},
+		{Type: "main.Bad", Summary: "{{"},
+	})
+	defer prettyprint.SetTypeFormatters(nil)
+	if err == nil {
+		t.Errorf("expected error for main.Bad")
+	}
+
+	stack := api.Variable{Name: "s", Type: "main.Stack[int]", Kind: reflect.Struct, Len: 1, Children: []api.Variable{
+		{Name: "items", Type: "[]int", Kind: reflect.Slice, Len: 2, Children: []api.Variable{
+			{Type: "int", Kind: reflect.Int, Value: "1"},
+			{Type: "int", Kind: reflect.Int, Value: "2"},
+		}},
+	}}
+	pair := api.Variable{Name: "p", Type: "main.Pair[int,*main.T]", Kind: reflect.Struct, Children: []api.Variable{
+		{Name: "a", Type: "int", Kind: reflect.Int, Value: "3"},
+		{Name: "b", Type: "*main.T", Kind: reflect.Ptr, Children: []api.Variable{
+			{Type: "main.T", Kind: reflect.Struct, Addr: 0x1000, Children: []api.Variable{{Name: "name", Type: "string", Kind: reflect.String, Value: "x", Len: 1}}},
+		}},
+	}}
+
+	if out, _ := prettyprint.Pretty(&stack); out != "2 items" {
+		t.Errorf("wrong summary for main.Stack: %q", out)
+	}
+	if out := prettyprint.Singleline(&pair, true, false); out != "<3, x>" {
+		t.Errorf("wrong summary for main.Pair: %q", out)
+	}
+	if out, _ := prettyprint.Pretty(&api.Variable{Type: "main.Broken", Kind: reflect.Struct}); !strings.HasPrefix(out, "formatter error:") {
+		t.Errorf("expected formatter error for main.Broken, got %q", out)
+	}
+	if out, ok := prettyprint.Pretty(&api.Variable{Type: "main.Broken", Kind: reflect.Struct, Len: 2}); ok {
+		t.Errorf("expected no summary for an unloaded main.Broken, got %q", out)
+	}
+	if prettyprint.LookupTypeFormatter("main.Stacks") != nil || prettyprint.LookupTypeFormatter("main.Bad") != nil {
+		t.Errorf("unexpected formatter match")
+	}
+
+	v := wrapApiVariable("", &stack, "s", "s", true, nil, 0)
+	if v.Children != nil || !reflect.DeepEqual(v.synthetic, []prettyprint.SyntheticChild{{Name: "top", Expr: "s.items[2-1]"}}) {
+		t.Errorf("wrong synthetic children %#v", v.synthetic)
+	}
+	stack.Addr = 0xc000010000
+	v = wrapApiVariable("", &stack, "s", "s", true, nil, 0)
+	if tgt := `(*(*"main.Stack[int]")(0xc000010000)).items[2-1]`; len(v.synthetic) != 1 || v.synthetic[0].Expr != tgt {
+		t.Errorf("wrong synthetic children for addressable variable %#v", v.synthetic)
+	}
+	if c := prettyprint.LookupTypeFormatter("main.Stack").ChildExprs(&stack, ""); len(c) != 1 || c[0].Expr != "" {
+		t.Errorf("wrong synthetic children without an expression %#v", c)
+	}
+	if c := prettyprint.LookupTypeFormatter("main.Stack").ChildExprs(&api.Variable{Type: "main.Stack[int]", Kind: reflect.Struct, Len: 1}, "s"); c != nil {
+		t.Errorf("expected no synthetic children for unloaded variable %#v", c)
+	}
+}
+
+func TestScrollbackTranscript(t *testing.T) {
+	var spool bytes.Buffer
+	for _, e := range []scrollbackEntry{
+		{Src: scrollbackGdlv, Text: "> main.main() main.go:10 (PC 0x1)\n", Links: []scrollbackLink{{S: 14, E: 24, Href: "file:///src/main.go#L10"}}},
+		{Src: scrollbackStdout, Text: "a < b\n"},
+		{Src: scrollbackStderr, Text: "oops\n"},
+	} {
+		buf, _ := json.Marshal(&e)
+		spool.Write(append(buf, '\n'))
+	}
+
+	var out strings.Builder
+	if err := writeTranscript(&out, bytes.NewReader(spool.Bytes()), false); err != nil {
+		t.Fatal(err)
+	}
+	if tgt := "> main.main() main.go:10 (PC 0x1)\na < b\noops\n"; out.String() != tgt {
+		t.Errorf("wrong text transcript %q", out.String())
+	}
+
+	out.Reset()
+	if err := writeTranscript(&out, bytes.NewReader(spool.Bytes()), true); err != nil {
+		t.Fatal(err)
+	}
+	for _, tgt := range []string{
+		`&gt; main.main() <a href="file:///src/main.go#L10">main.go:10</a> (PC 0x1)`,
+		`<span class="stdout">a &lt; b` + "\n</span>",
+		`<span class="stderr">oops`,
+	} {
+		if !strings.Contains(out.String(), tgt) {
+			t.Errorf("HTML transcript does not contain %q:\n%s", tgt, out.String())
+		}
+	}
+
+	if m := findMatches("Error: error ERROR", "error"); !reflect.DeepEqual(m, [][2]int{{0, 5}, {7, 12}, {13, 18}}) {
+		t.Errorf("wrong case insensitive matches %v", m)
+	}
+	if m := findMatches("Error: error ERROR", "Error"); !reflect.DeepEqual(m, [][2]int{{0, 5}}) {
+		t.Errorf("wrong case sensitive matches %v", m)
+	}
+
+	defer func(entries []scrollbackEntry) {
+		closeScrollbackSpool()
+		scrollbackSpool.mu.Lock()
+		scrollbackSpool.err = nil
+		scrollbackSpool.mu.Unlock()
+		scrollbackMu.Lock()
+		scrollback.entries = entries
+		scrollbackMu.Unlock()
+	}(scrollback.entries)
+	for i := 0; i < 1000; i++ {
+		scrollbackAdd(scrollbackEntry{Src: scrollbackGdlv, Text: "line " + strconv.Itoa(i) + "\n"})
+	}
+	path := filepath.Join(t.TempDir(), "transcript.txt")
+	if err := saveScrollback(path); err != nil {
+		t.Fatal(err)
+	}
+	buf, _ := os.ReadFile(path)
+	if n := strings.Count(string(buf), "\n"); n != 1000 || !strings.HasSuffix(string(buf), "line 999\n") {
+		t.Errorf("wrong saved transcript (%d lines)", n)
+	}
+}
+
+func TestParseANSI(t *testing.T) {
+	var st ansiState
+	spans := parseANSI("plain \x1b[1;31mred\x1b[0m \x1b[38;5;196mx\x1b[2K\x1b[48;2;1;2;3my", &st)
+	var texts []string
+	for _, span := range spans {
+		texts = append(texts, span.text)
+	}
+	if tgt := []string{"plain ", "red", " ", "x", "y"}; !reflect.DeepEqual(texts, tgt) {
+		t.Fatalf("wrong spans %q", texts)
+	}
+	if spans[0].fg != nil || spans[0].bold {
+		t.Errorf("first span should not have attributes")
+	}
+	if !spans[1].bold || spans[1].fg == nil || *spans[1].fg != ansiColors[1] {
+		t.Errorf("second span should be bold and red")
+	}
+	if spans[2].fg != nil || spans[2].bold {
+		t.Errorf("attributes not reset")
+	}
+	if spans[3].fg == nil || *spans[3].fg != ansi256(196) || ansi256(196) != (color.RGBA{0xff, 0, 0, 0xff}) {
+		t.Errorf("wrong 256 color")
+	}
+	if spans[4].bg == nil || *spans[4].bg != (color.RGBA{1, 2, 3, 0xff}) || spans[4].fg == nil {
+		t.Errorf("wrong true color background")
+	}
+	if st.bg == nil {
+		t.Errorf("state not carried")
+	}
+}
+
+func TestOutputPanelHistory(t *testing.T) {
+	defer closeOutputSpool()
+	outputPanelWrite(scrollbackStdout, []byte("a\nb"))
+	outputPanelWrite(scrollbackStderr, []byte("err\n"))
+	outputPanelWrite(scrollbackStdout, []byte("c\r\n"))
+
+	lines := append([]outputLine(nil), outputPanel.lines...)
+	if len(lines) != 4 {
+		t.Fatalf("wrong number of lines %d", len(lines))
+	}
+	if lines[1].Text != "b" || lines[1].NL || lines[3].Text != "c" || !lines[3].Cont || !lines[3].NL || lines[2].Src != scrollbackStderr {
+		t.Errorf("wrong lines %#v", lines)
+	}
+
+	clearOutput()
+	if len(outputPanel.lines) != 0 || outputPanel.firstLine != 4 {
+		t.Errorf("clear failed")
+	}
+	if err := loadOlderOutput(3); err != nil {
+		t.Fatal(err)
+	}
+	for i := range outputPanel.lines {
+		outputPanel.lines[i].Time = lines[i+1].Time
+	}
+	if !reflect.DeepEqual(outputPanel.lines, lines[1:]) || outputPanel.firstLine != 1 {
+		t.Errorf("wrong lines loaded from history %#v", outputPanel.lines)
+	}
+}
+
+func TestTermScreen(t *testing.T) {
+	check := func(s *termScreen, tgt ...string) {
+		t.Helper()
+		if out := s.text(); !reflect.DeepEqual(out, tgt) {
+			t.Errorf("expected %q got %q", tgt, out)
+		}
+	}
+
+	s := newTermScreen(10, 3)
+	s.Write([]byte("hello\r\nworld\r\n"))
+	check(s, "hello", "world", "")
+	s.Write([]byte("a\x1b[31mb\x1b[0mc\x1b"))
+	s.Write([]byte("[3;4H!\xe2"))
+	s.Write([]byte("\x82\xac"))
+	check(s, "hello", "world", "abc!€")
+	if s.lines[2][1].fg == nil || *s.lines[2][1].fg != ansiColors[1] || s.lines[2][2].fg != nil {
+		t.Errorf("wrong colors %#v", s.lines[2][:3])
+	}
+
+	s.Write([]byte("\x1b[1;1H\x1b[Kbye\x1b[2;3H\x1b[1P"))
+	check(s, "bye", "wold", "abc!€")
+	s.Write([]byte("\x1b[3;1H0123456789xy\r\n"))
+	check(s, "0123456789", "xy", "")
+	if len(s.history) != 2 || termLineString(s.history[0]) != "bye" {
+		t.Errorf("wrong history %d", len(s.history))
+	}
+
+	s.Write([]byte("\x1b[?1049h\x1b[2Jfull\x1b[6n"))
+	check(s, "", "", "full")
+	if string(s.reply) != "\x1b[3;5R" {
+		t.Errorf("wrong reply %q", s.reply)
+	}
+	s.Write([]byte("\x1b]0;title\x07\x1b[?1049l"))
+	check(s, "0123456789", "xy", "")
+
+	s.resize(4, 3)
+	check(s, "0123", "xy", "")
+	s.resize(4, 2)
+	check(s, "xy", "")
+	if s.cx != 0 || s.cy != 1 || len(s.history) != 3 {
+		t.Errorf("wrong cursor %d %d or history %d", s.cx, s.cy, len(s.history))
+	}
+
+	// negative and malformed parameters are ignored
+	s = newTermScreen(4, 3)
+	s.Write([]byte("\x1b[-3;2r\n\x1b[S\x1b[99999999999999999999X\x1b[1;1Ha\x1b[-2Cb"))
+	if s.top != 0 || s.bot != 1 {
+		t.Errorf("wrong scroll region %d %d", s.top, s.bot)
+	}
+	check(s, "a b", "", "")
+
+	kbd := &nucular.KeyboardInput{Text: "ls\n", Keys: []key.Event{{Code: key.CodeC, Modifiers: key.ModControl}, {Code: key.CodeUpArrow}}}
+	if out := string(terminalKeys(kbd, true)); out != "\x03\x1bOAls\r" {
+		t.Errorf("wrong keys %q", out)
+	}
+}
+
+func TestFuzzyCompletion(t *testing.T) {
+	if _, ok := fuzzyMatch("gfr", "getFrame"); !ok {
+		t.Errorf("expected match")
+	}
+	if _, ok := fuzzyMatch("gFr", "getframe"); ok {
+		t.Errorf("unexpected match with upper case letters")
+	}
+	s1, _ := fuzzyMatch("bp", "breakpoints")
+	s2, _ := fuzzyMatch("bp", "b_points")
+	s3, _ := fuzzyMatch("bp", "breakPoints")
+	if !(s2 > s1 && s3 > s1) {
+		t.Errorf("wrong ranking %d %d %d", s1, s2, s3)
+	}
+
+	var buf bytes.Buffer
+	commandLineEditor.Buffer = []rune("p x.bpo")
+	commandLineEditor.Cursor = len(commandLineEditor.Buffer)
+	cm := completeMachine{word: "bpo"}
+	for _, compl := range []string{"breakpointsOn", "bpOff", "other"} {
+		cm.add(compl)
+	}
+	cm.finish(clereplace, &buf)
+	if out := buf.String(); out != "Completions: bpOff, breakpointsOn\n" || string(commandLineEditor.Buffer) != "p x.bpo" {
+		t.Errorf("wrong completions %q", out)
+	}
+
+	cm = completeMachine{word: "bpo"}
+	for _, compl := range []string{"breakpointsOn", "other"} {
+		cm.add(compl)
+	}
+	cm.finish(clereplace, nil)
+	if out := string(commandLineEditor.Buffer); out != "p x.breakpointsOn" || commandLineEditor.Cursor != len(out) {
+		t.Errorf("wrong completion %q %d", out, commandLineEditor.Cursor)
+	}
+
+	buf.Reset()
+	cm = completeMachine{word: "bk"}
+	for _, compl := range []string{"bulk", "backup", "bk_a", "bkk"} {
+		cm.add(compl)
+	}
+	cm.finish(func(n int, s string) {
+		if n != 0 || s != "" {
+			t.Errorf("unexpected replacement %d %q", n, s)
+		}
+	}, &buf)
+	if out := buf.String(); out != "Completions: bkk, bk_a\n" {
+		t.Errorf("wrong completions %q", out)
+	}
+	commandLineEditor.Buffer = nil
+	commandLineEditor.Cursor = 0
+
+	funcsPanel.slice = []string{"main.(*T).Ptr", "main.T.Val", "main.T.Val.func1", "main.TT.Other", "main.(*List[...]).Push"}
+	defer func() { funcsPanel.slice = nil }()
+	if out := methodsOf("*main.T"); !reflect.DeepEqual(out, []string{"Ptr", "Val"}) {
+		t.Errorf("wrong methods %q", out)
+	}
+	if out := methodsOf("main.List[int]"); !reflect.DeepEqual(out, []string{"Push"}) {
+		t.Errorf("wrong methods %q", out)
+	}
+}
+
+func TestCommandHistory(t *testing.T) {
+	defer func(path string, size int, history []string) {
+		historyPath, conf.HistorySize, cmdhistory = path, size, history
+	}(historyPath, conf.HistorySize, cmdhistory)
+
+	historyPath = filepath.Join(t.TempDir(), "history")
+	conf.HistorySize = 3
+	cmdhistory = []string{""}
+	for _, cmd := range []string{"a", "b", "a", "c", "d"} {
+		addHistory(cmd)
+	}
+	if !reflect.DeepEqual(cmdhistory, []string{"", "a", "c", "d"}) {
+		t.Errorf("wrong history %q", cmdhistory)
+	}
+	buf, err := os.ReadFile(historyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "a\nc\nd\n" {
+		t.Errorf("wrong history file %q", buf)
+	}
+}
+
+func TestKeyChord(t *testing.T) {
+	for _, tc := range []struct {
+		in, out string
+	}{
+		{"F5", "F5"},
+		{"shift+f11", "Shift+F11"},
+		{"Alt+Ctrl+1", "Ctrl+Alt+1"},
+		{"Ctrl++", "Ctrl++"},
+		{"Control+Plus", "Ctrl++"},
+		{"Alt+Return", "Alt+Enter"},
+		{"A", ""},
+		{"Shift+Up", ""},
+		{"Hyper+F5", ""},
+	} {
+		kc, err := parseKeyChord(tc.in)
+		if tc.out == "" {
+			if err == nil {
+				t.Errorf("%q: expected error, got %v", tc.in, kc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.in, err)
+			continue
+		}
+		if kc.String() != tc.out {
+			t.Errorf("%q: got %q expected %q", tc.in, kc, tc.out)
+		}
+	}
+
+	plus, _ := parseKeyChord("Ctrl++")
+	if !plus.match(key.Event{Rune: '+', Code: key.CodeEqualSign, Modifiers: key.ModControl | key.ModShift}) {
+		t.Errorf("Ctrl++ does not match Ctrl+Shift+=")
+	}
+	f11, _ := parseKeyChord("F11")
+	if f11.match(key.Event{Code: key.CodeF11, Modifiers: key.ModShift}) {
+		t.Errorf("F11 matches Shift+F11")
+	}
+
+	bindings := defaultKeybindings()
+	if err := applyKeybindingPreset(bindings, "goland"); err != nil {
+		t.Fatal(err)
+	}
+	if bindings["F5"] != "" || bindings["Alt+Right"] != "" || bindings["F8"] != "next" || bindings["Alt+1"] != "window listing" {
+		t.Errorf("wrong bindings after preset: %v", bindings)
+	}
+
+	defer func(saved *Commands) { cmds = saved }(cmds)
+	cmds = DebugCommands()
+	for _, cmd := range []string{"window listing", "win locals", "config zoom in"} {
+		if uiKeybinding(parseCommand(cmd)) == nil {
+			t.Errorf("%q not executed on the UI goroutine", cmd)
+		}
+	}
+	for _, cmd := range []string{"continue", "config bind", "config", "source foo.star"} {
+		if uiKeybinding(parseCommand(cmd)) != nil {
+			t.Errorf("%q executed on the UI goroutine", cmd)
+		}
+	}
+}
+
+func TestThemeFile(t *testing.T) {
+	defer func(theme string, themes map[string]*Theme) {
+		conf.Theme, conf.Themes = theme, themes
+		themeStyle(conf.Theme, 1.0)
+	}(conf.Theme, conf.Themes)
+
+	conf.Theme = whiteTheme
+	conf.Themes = nil
+	theme := currentTheme("test")
+	if theme.Base != whiteTheme || theme.Style["Text.Color"] == "" || theme.Style["NormalWindow.Background"] == "" || theme.Colors["ChangedVariable"] != "#ff0000ff" {
+		t.Fatalf("wrong exported theme %#v", theme)
+	}
+
+	theme.Style["Text.Color"] = "#123456"
+	theme.Colors["Link"] = "#01020304"
+	path := filepath.Join(t.TempDir(), "test.json")
+	buf, _ := json.Marshal(theme)
+	if err := os.WriteFile(path, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadTheme(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.Theme = loaded.Name
+	conf.Themes = map[string]*Theme{loaded.Name: loaded}
+	style := themeStyle(conf.Theme, 1.0)
+	if style.Text.Color != (color.RGBA{0x12, 0x34, 0x56, 0xff}) || linkColor != (color.RGBA{1, 2, 3, 4}) {
+		t.Errorf("theme not applied: %v %v", style.Text.Color, linkColor)
+	}
+
+	theme.Style["Text.Colour"] = "#000000"
+	buf, _ = json.Marshal(theme)
+	os.WriteFile(path, buf, 0644)
+	if _, err := loadTheme(path); err == nil {
+		t.Errorf("no error for unknown property")
+	}
+}
+
+func TestStarlarkConds(t *testing.T) {
+	defer func() { starlarkConds = map[int]string{} }()
+	starlarkConds = map[int]string{1: "cur_scope().GoroutineID == 7", 2: "False"}
+
+	bp1, bp2, bp3 := &api.Breakpoint{ID: 1}, &api.Breakpoint{ID: 2}, &api.Breakpoint{ID: 3}
+	mkstate := func(ths ...*api.Thread) *api.DebuggerState {
+		return &api.DebuggerState{CurrentThread: ths[0], Threads: ths}
+	}
+
+	for i, tc := range []struct {
+		state *api.DebuggerState
+		tgt   bool
+	}{
+		{mkstate(&api.Thread{GoroutineID: 7, Breakpoint: bp1}), true},
+		{mkstate(&api.Thread{GoroutineID: 8, Breakpoint: bp1}), false},
+		{mkstate(&api.Thread{GoroutineID: 8, Breakpoint: bp2}), false},
+		// another thread stopped at a breakpoint whose condition is true
+		{mkstate(&api.Thread{GoroutineID: 8, Breakpoint: bp2}, &api.Thread{GoroutineID: 7, Breakpoint: bp1}), true},
+		{mkstate(&api.Thread{GoroutineID: 8, Breakpoint: bp2}, &api.Thread{GoroutineID: 9, Breakpoint: bp3}), true},
+		{mkstate(&api.Thread{GoroutineID: 8}, &api.Thread{GoroutineID: 9, Breakpoint: bp2}), true},
+	} {
+		if out := evalStarlarkConds(tc.state); out != tc.tgt {
+			t.Errorf("%d: expected %v got %v", i, tc.tgt, out)
+		}
+		// evaluated only once for each state
+		starlarkConds[2] = "True"
+		if out := evalStarlarkConds(tc.state); out != tc.tgt {
+			t.Errorf("%d: result not remembered", i)
+		}
+		starlarkConds[2] = "False"
+	}
+
+	// conditions evaluated while a script is running must not replace its
+	// thread or change the scope seen by it
+	env := starbind.New(starlarkContext{})
+	started := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := env.Execute(&signalWriter{started}, "<test>", "def main():\n\tprint(cur_scope().GoroutineID)\n\tfor i in range(1000000000):\n\t\tpass\n", "main", nil, nil)
+		done <- err
+	}()
+	<-started
+	v, err := env.EvalCondition(io.Discard, "cur_scope().GoroutineID == 7", api.EvalScope{GoroutineID: 7})
+	if err != nil || v != starlark.True {
+		t.Errorf("wrong condition result %v %v", v, err)
+	}
+	env.Cancel()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("script not cancelled")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("script could not be cancelled after evaluating a condition")
+	}
+}
+
+// signalWriter closes ch on the first write.
+type signalWriter struct {
+	ch chan struct{}
+}
+
+func (w *signalWriter) Write(buf []byte) (int, error) {
+	if w.ch != nil {
+		close(w.ch)
+		w.ch = nil
+	}
+	return len(buf), nil
+}
+
+func TestStarlarkComplete(t *testing.T) {
+	env := starbind.New(starlarkContext{})
+	var out bytes.Buffer
+	const src = `
+D = {"key1": [1, 2], "key2": {"inner": 1}}
+def F():
+	return D
+`
+	if _, err := env.Execute(&out, "<test>", src, "", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		line, word string
+		tgt        []string // must be in the completions
+		none       bool     // no completions expected
+	}{
+		{line: "x = D", word: "D", tgt: []string{"D", "F", "len"}},
+		{line: `D["k`, word: "k", tgt: []string{"key1", "key2"}},
+		{line: `D["key2"]["`, word: "", tgt: []string{"inner"}},
+		{line: `D["key1"].ap`, word: "ap", tgt: []string{"append"}},
+		{line: "D.ke", word: "ke", tgt: []string{"keys"}},
+		{line: "F().ke", word: "ke", none: true},
+		{line: `D[F()].ke`, word: "ke", none: true},
+		{line: `D["key1"][F()].`, word: "", none: true},
+		{line: "Undefined.", word: "", none: true},
+	} {
+		word, compls := env.Complete(tc.line)
+		if word != tc.word {
+			t.Errorf("%q: expected word %q got %q", tc.line, tc.word, word)
+		}
+		if tc.none && len(compls) != 0 {
+			t.Errorf("%q: expected no completions got %v", tc.line, compls)
+		}
+		for _, s := range tc.tgt {
+			found := false
+			for _, c := range compls {
+				if c == s {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("%q: %q not in completions %v", tc.line, s, compls)
+			}
+		}
+	}
+}
+
+func TestStarlarkHooks(t *testing.T) {
+	env := starbind.New(starlarkContext{})
+	path := filepath.Join(t.TempDir(), "hooks.star")
+	os.WriteFile(path, []byte(`
+def on_stop(state):
+	print("stopped")
+def on_exit(status):
+	print("exited", status)
+`), 0644)
+	var out, hookOut bytes.Buffer
+	if _, err := env.Execute(&out, path, nil, "main", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !env.HasHook(starbind.OnStopHook) || !env.HasHook(starbind.OnExitHook) {
+		t.Fatalf("hooks not defined")
+	}
+
+	if _, err := env.CallHook(&hookOut, starbind.OnExitHook, 2); err != nil {
+		t.Fatal(err)
+	}
+	if hookOut.String() != "exited 2\n" || out.Len() != 0 {
+		t.Errorf("wrong hook output %q %q", hookOut.String(), out.String())
+	}
+
+	// sourcing the file again replaces its hooks
+	os.WriteFile(path, []byte(`
+def on_stop(state):
+	print("stopped")
+`), 0644)
+	if _, err := env.Execute(&out, path, nil, "main", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !env.HasHook(starbind.OnStopHook) || env.HasHook(starbind.OnExitHook) {
+		t.Errorf("hooks not replaced")
+	}
+}
+
+func TestStarlarkLoad(t *testing.T) {
+	env := starbind.New(starlarkContext{})
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "lib.star"), []byte("def f():\n\treturn 42\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "main.star"), []byte("load(\"lib.star\", \"f\")\nx = f()\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "a.star"), []byte("load(\"b.star\", \"b\")\na = 1\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.star"), []byte("load(\"a.star\", \"a\")\nb = 1\n"), 0644)
+
+	// concurrent executions must not see each other's loads in progress
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := env.Execute(io.Discard, filepath.Join(dir, "main.star"), nil, "main", nil, nil)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := env.Execute(io.Discard, filepath.Join(dir, "a.star"), nil, "main", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "cycle in load graph") {
+		t.Errorf("expected cycle error, got %v", err)
+	}
+}
+
+// testUIContext records the calls made by the user interface and output
+// builtins of starbind.
+type testUIContext struct {
+	starlarkContext
+	calls  []string
+	panels map[string]func() ([][]starbind.PanelCell, error)
+}
+
+func (ctx *testUIContext) RegisterPanel(name, helpMsg string, load func() ([][]starbind.PanelCell, error)) error {
+	if ctx.panels == nil {
+		ctx.panels = map[string]func() ([][]starbind.PanelCell, error){}
+	}
+	ctx.panels[name] = load
+	return nil
+}
+
+func (ctx *testUIContext) called(format string, args ...interface{}) error {
+	ctx.calls = append(ctx.calls, fmt.Sprintf(format, args...))
+	return nil
+}
+
+func (ctx *testUIContext) SelectGoroutine(gid int64) error {
+	return ctx.called("SelectGoroutine %d", gid)
+}
+func (ctx *testUIContext) SelectFrame(frame int) error    { return ctx.called("SelectFrame %d", frame) }
+func (ctx *testUIContext) ListingPosition() (string, int) { return "main.go", 10 }
+func (ctx *testUIContext) ShowLocation(file string, line int) {
+	ctx.called("ShowLocation %s:%d", file, line)
+}
+func (ctx *testUIContext) Selection() (string, string)  { return "ident", "selected" }
+func (ctx *testUIContext) OpenWindow(name string) error { return ctx.called("OpenWindow %s", name) }
+func (ctx *testUIContext) CloseWindow(name string) error {
+	return fmt.Errorf("window %q is not open", name)
+}
+func (ctx *testUIContext) LoadLayout(name string) error { return ctx.called("LoadLayout %s", name) }
+func (ctx *testUIContext) Expressions() []string        { return []string{"a", "b"} }
+func (ctx *testUIContext) AddExpression(expr string)    { ctx.called("AddExpression %s", expr) }
+func (ctx *testUIContext) RemoveExpression(expr string) error {
+	return ctx.called("RemoveExpression %s", expr)
+}
+func (ctx *testUIContext) PrintLink(text, file string, line int) {
+	ctx.called("PrintLink %s %s:%d", text, file, line)
+}
+func (ctx *testUIContext) PrintVar(v starlark.Value) { ctx.called("PrintVar %s", v) }
+
+func TestStarlarkUIBuiltins(t *testing.T) {
+	ctx := &testUIContext{}
+	env := starbind.New(ctx)
+	var out bytes.Buffer
+	const src = `
+select_goroutine(3)
+select_frame(1)
+p = listing_position()
+show_location(p["File"], p["Line"]+1)
+s = selection()
+print(s["Listing"], s["Variables"])
+open_window("Goroutines")
+load_layout("default")
+add_expression("x")
+print(expressions())
+remove_expression("x")
+print_table([[1, "a"], [22, "b\tc"], "row"], ["n", "s"])
+print_link("here", "main.go", 3)
+print_var({"k": 1})
+`
+	if _, err := env.Execute(&out, "<test>", src, "main", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	tgt := []string{
+		"SelectGoroutine 3",
+		"SelectFrame 1",
+		"ShowLocation main.go:11",
+		"OpenWindow Goroutines",
+		"LoadLayout default",
+		"AddExpression x",
+		"RemoveExpression x",
+		"PrintLink here main.go:3",
+		`PrintVar {"k": 1}`,
+	}
+	if !reflect.DeepEqual(ctx.calls, tgt) {
+		t.Errorf("wrong calls:\n%s", strings.Join(ctx.calls, "\n"))
+	}
+	tgtOut := "ident selected\n[\"a\", \"b\"]\nn   s\n-   -\n1   a\n22  b c\nrow\n"
+	if out.String() != tgtOut {
+		t.Errorf("wrong output %q", out.String())
+	}
+
+	_, err := env.Execute(&out, "<test>", `close_window("Goroutines")`, "main", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), `window "Goroutines" is not open`) {
+		t.Errorf("expected error from close_window, got %v", err)
+	}
+	_, err = env.Execute(&out, "<test>", `select_frame("a")`, "main", nil, nil)
+	if err == nil {
+		t.Errorf("expected error for wrong argument type")
+	}
+}
+
+func TestScrollbackExpandable(t *testing.T) {
+	defer func(entries []scrollbackEntry, lines int) {
+		scrollbackMu.Lock()
+		scrollback.entries, scrollback.lines = entries, lines
+		scrollbackMu.Unlock()
+	}(scrollback.entries, scrollback.lines)
+	scrollback.entries, scrollback.lines = nil, 0
+
+	c := scrollbackAppend()
+	c.Text("v = ")
+	c.Expandable("{...}", func() string { return "{\n\ta: 1,\n}" })
+	c.Text(" ")
+	c.Link("main.go:1", "", nil)
+	c.Text("\n")
+	c.End()
+
+	scrollback.entries[0].Links[0].fn()
+	e := scrollback.entries[0]
+	if e.Text != "v = {\n\ta: 1,\n} main.go:1\n" || scrollback.lines != 3 {
+		t.Errorf("wrong expanded entry %q (%d lines)", e.Text, scrollback.lines)
+	}
+	if len(e.Links) != 1 || e.Text[e.Links[0].S:e.Links[0].E] != "main.go:1" {
+		t.Errorf("wrong links after expansion %#v", e.Links)
+	}
+}
+
+func TestStarlarkPanelThread(t *testing.T) {
+	ctx := &testUIContext{}
+	env := starbind.New(ctx)
+	const src = `
+def panel_rows():
+	return [["a", "b"], "c"]
+register_panel("test", panel_rows)
+def main():
+	print("started")
+	for i in range(1000000000):
+		pass
+`
+	started := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := env.Execute(&signalWriter{started}, "<test>", src, "main", nil, nil)
+		done <- err
+	}()
+	select {
+	case <-started:
+	case err := <-done:
+		t.Fatalf("script terminated early: %v", err)
+	}
+
+	// loading the panel while the script runs must not replace its thread
+	rows, err := ctx.panels["test"]()
+	if err != nil || len(rows) != 2 || len(rows[0]) != 2 || rows[1][0].Text != "c" {
+		t.Errorf("wrong panel rows %v %v", rows, err)
+	}
+	env.Cancel()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("script not cancelled")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("script could not be cancelled after loading a panel")
+	}
+}
+
+func TestListingSelectedText(t *testing.T) {
+	defer func(listing []listline, sel listingSelection) {
+		listingPanel.listing, listingPanel.sel = listing, sel
+	}(listingPanel.listing, listingPanel.sel)
+
+	listingPanel.listing = []listline{
+		{lineno: 1, textWithTabs: "package main"},
+		{lineno: 2, textWithTabs: ""},
+		{lineno: 3, textWithTabs: "func main() {"},
+		{lineno: 4, textWithTabs: "\tprintln()"},
+		{lineno: 5, textWithTabs: "}"},
+	}
+
+	for _, tc := range []struct {
+		sel  listingSelection
+		text string
+	}{
+		{listingSelection{}, ""},
+		{listingSelection{start: 3, end: 3}, ""},
+		{listingSelection{start: 3, end: 4, moved: true}, "func main() {\n\tprintln()"},
+		{listingSelection{start: 5, end: 3, moved: true}, "func main() {\n\tprintln()\n}"},
+	} {
+		listingPanel.sel = tc.sel
+		if text := listingSelectedText(); text != tc.text {
+			t.Errorf("selection %#v: got %q expected %q", tc.sel, text, tc.text)
+		}
+	}
+}
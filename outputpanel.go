@@ -0,0 +1,484 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aarzilli/nucular"
+	"github.com/aarzilli/nucular/font"
+	"github.com/aarzilli/nucular/richtext"
+	"github.com/aarzilli/nucular/style"
+)
+
+// outputLine is a line, or part of a line, written by the target to its
+// standard output or standard error.
+type outputLine struct {
+	Src  scrollbackSource
+	Time time.Time
+	Text string
+	Cont bool `json:",omitempty"` // continues the previous line of the same stream
+	NL   bool `json:",omitempty"` // ends with a newline
+}
+
+const outputMaxLines = 10000
+
+var outputPanel = struct {
+	mu sync.Mutex
+
+	lines     []outputLine // lines kept in memory, the full history is in spool
+	firstLine int          // index of lines[0] in the full history
+	keep      int          // maximum number of lines kept in memory
+	offsets   []int64      // offset in spool of each line of the full history
+	lastNL    [3]bool      // last line written to each stream ended with a newline
+	id        int          // incremented every time lines is changed other than by appending
+
+	spool    *os.File
+	spoolErr error
+	spoolOff int64
+
+	// fields below are only accessed by the UI goroutine
+
+	ed         *richtext.RichText
+	shownID    int
+	shown      int // index in the full history of the first line not shown yet
+	ansi       [3]ansiState
+	paused     bool
+	follow     bool
+	timestamps bool
+	hide       [3]bool
+	input      nucular.TextEditor
+}{keep: outputMaxLines, lastNL: [3]bool{true, true, true}, follow: true, id: 1}
+
+var (
+	outputTimestampColor = color.RGBA{0x80, 0x80, 0x80, 0xff}
+	outputStderrColor    = color.RGBA{0xff, 0x60, 0x60, 0xff}
+)
+
+// outputPanelWrite adds b, written by the target to the stream src, to the
+// output panel.
+func outputPanelWrite(src scrollbackSource, b []byte) {
+	now := time.Now()
+	text := strings.Replace(string(b), "\r\n", "\n", -1)
+
+	outputPanel.mu.Lock()
+	defer outputPanel.mu.Unlock()
+	for len(text) > 0 {
+		line := outputLine{Src: src, Time: now, Cont: !outputPanel.lastNL[src]}
+		if nl := strings.Index(text, "\n"); nl >= 0 {
+			line.Text, line.NL = text[:nl], true
+			text = text[nl+1:]
+		} else {
+			line.Text = text
+			text = ""
+		}
+		outputPanel.lastNL[src] = line.NL
+		outputPanel.lines = append(outputPanel.lines, line)
+		spoolOutputLine(&line)
+	}
+	if len(outputPanel.lines) > outputPanel.keep {
+		n := len(outputPanel.lines) - outputPanel.keep
+		outputPanel.lines = append(outputPanel.lines[:0], outputPanel.lines[n:]...)
+		outputPanel.firstLine += n
+	}
+}
+
+// spoolOutputLine appends line to the spool file. Must be called with
+// outputPanel.mu locked.
+func spoolOutputLine(line *outputLine) {
+	if outputPanel.spoolErr == nil && outputPanel.spool == nil {
+		outputPanel.spool, outputPanel.spoolErr = os.CreateTemp("", "gdlv-output-*.jsonl")
+	}
+	if outputPanel.spoolErr != nil {
+		// history not available, pretend the line was spooled so that
+		// indexes stay consistent
+		outputPanel.offsets = append(outputPanel.offsets, -1)
+		return
+	}
+	buf, _ := json.Marshal(line)
+	buf = append(buf, '\n')
+	outputPanel.offsets = append(outputPanel.offsets, outputPanel.spoolOff)
+	n, err := outputPanel.spool.Write(buf)
+	outputPanel.spoolOff += int64(n)
+	if err != nil {
+		outputPanel.spoolErr = err
+	}
+}
+
+// loadOlderOutput loads up to n lines preceding the ones currently in
+// memory from the spool file.
+func loadOlderOutput(n int) error {
+	outputPanel.mu.Lock()
+	defer outputPanel.mu.Unlock()
+	if outputPanel.firstLine == 0 {
+		return nil
+	}
+	if outputPanel.spool == nil {
+		return outputPanel.spoolErr
+	}
+	start := outputPanel.firstLine - n
+	if start < 0 {
+		start = 0
+	}
+	for start < outputPanel.firstLine && outputPanel.offsets[start] < 0 {
+		start++
+	}
+	if start >= outputPanel.firstLine {
+		return outputPanel.spoolErr
+	}
+	off := outputPanel.offsets[start]
+	end := outputPanel.spoolOff
+	for i := outputPanel.firstLine; i < len(outputPanel.offsets); i++ {
+		if outputPanel.offsets[i] >= 0 {
+			end = outputPanel.offsets[i]
+			break
+		}
+	}
+	lines, err := readOutputLines(io.NewSectionReader(outputPanel.spool, off, end-off))
+	if err != nil {
+		return err
+	}
+	outputPanel.lines = append(lines, outputPanel.lines...)
+	outputPanel.firstLine -= len(lines)
+	outputPanel.keep = len(outputPanel.lines) + outputMaxLines
+	outputPanel.id++
+	return nil
+}
+
+func readOutputLines(in io.Reader) ([]outputLine, error) {
+	var r []outputLine
+	s := bufio.NewScanner(in)
+	s.Buffer(nil, 64*1024*1024)
+	for s.Scan() {
+		var line outputLine
+		if err := json.Unmarshal(s.Bytes(), &line); err != nil {
+			return nil, err
+		}
+		r = append(r, line)
+	}
+	return r, s.Err()
+}
+
+// clearOutput removes all lines from the output panel, the history on disk
+// is kept.
+func clearOutput() {
+	outputPanel.mu.Lock()
+	outputPanel.firstLine += len(outputPanel.lines)
+	outputPanel.lines = nil
+	outputPanel.keep = outputMaxLines
+	outputPanel.id++
+	outputPanel.mu.Unlock()
+}
+
+// closeOutputSpool deletes the spool file of the output panel.
+func closeOutputSpool() {
+	outputPanel.mu.Lock()
+	defer outputPanel.mu.Unlock()
+	if outputPanel.spool != nil {
+		outputPanel.spool.Close()
+		os.Remove(outputPanel.spool.Name())
+		outputPanel.spool = nil
+	}
+	outputPanel.spoolErr = io.ErrClosedPipe
+}
+
+func updateOutput(w *nucular.Window) {
+	if w.HelpClicked {
+		showHelp(w.Master(), "Output Panel Help", outputPanelHelp)
+	}
+
+	if outputPanel.ed == nil {
+		outputPanel.ed = richtext.New(richtext.Selectable | richtext.AutoWrap | richtext.Clipboard | richtext.Keyboard)
+	}
+	outputPanel.input.Flags = nucular.EditSelectable | nucular.EditSigEnter | nucular.EditClipboard
+
+	rerender := false
+
+	w.MenubarBegin()
+	w.Row(20).Static(80, 80, 100, 80, 80, 100, 80)
+	w.CheckboxText("Follow", &outputPanel.follow)
+	if w.CheckboxText("Pause", &outputPanel.paused) && !outputPanel.paused {
+		w.Master().Changed()
+	}
+	if w.CheckboxText("Timestamps", &outputPanel.timestamps) {
+		rerender = true
+	}
+	for _, src := range []scrollbackSource{scrollbackStdout, scrollbackStderr} {
+		show := !outputPanel.hide[src]
+		if w.CheckboxText(scrollbackSourceNames[src], &show) {
+			outputPanel.hide[src] = !show
+			rerender = true
+		}
+	}
+	if w.ButtonText("Load older") {
+		if err := loadOlderOutput(outputMaxLines); err != nil {
+			fmt.Fprintf(&editorWriter{false}, "Could not load output history: %v\n", err)
+		}
+	}
+	if w.ButtonText("Clear") {
+		clearOutput()
+	}
+	w.MenubarEnd()
+
+	w.LayoutReserveRow(commandLineHeight, 1)
+	w.Row(0).Dynamic(1)
+
+	outputPanel.mu.Lock()
+	if outputPanel.shownID != outputPanel.id {
+		rerender = true
+	}
+	var lines []outputLine
+	if rerender || !outputPanel.paused {
+		start := outputPanel.shown - outputPanel.firstLine
+		if rerender || start < 0 {
+			start = 0
+		}
+		if start < len(outputPanel.lines) {
+			lines = append(lines, outputPanel.lines[start:]...)
+		}
+		outputPanel.shown = outputPanel.firstLine + len(outputPanel.lines)
+		outputPanel.shownID = outputPanel.id
+	}
+	outputPanel.mu.Unlock()
+
+	style := w.Master().Style()
+	if c := outputPanel.ed.Widget(w, rerender); c != nil {
+		outputPanel.ansi = [3]ansiState{}
+		c.Align(richtext.AlignLeftDumb)
+		n := renderOutputLines(c, style, lines)
+		c.End()
+		if outputPanel.follow {
+			outputPanel.ed.Sel.S = int32(n)
+			outputPanel.ed.Sel.E = outputPanel.ed.Sel.S
+			outputPanel.ed.FollowCursor()
+		}
+	} else if len(lines) > 0 {
+		c := outputPanel.ed.Append(outputPanel.follow)
+		renderOutputLines(c, style, lines)
+		c.End()
+		outputPanel.ed.Tail(outputPanel.keep)
+	}
+
+	w.Row(commandLineHeight).Static(60, 0)
+	w.Label("stdin:", "LC")
+	if ev := outputPanel.input.Edit(w); ev&nucular.EditCommitted != 0 {
+		line := string(outputPanel.input.Buffer) + "\n"
+		outputPanel.input.Buffer = outputPanel.input.Buffer[:0]
+		outputPanel.input.Cursor = 0
+		outputPanel.input.CursorFollow = true
+		outputPanel.input.Active = true
+		if err := sendStdin(line); err != nil {
+			fmt.Fprintf(&editorWriter{false}, "Could not write to standard input: %v\n", err)
+		}
+	}
+}
+
+// sendStdin writes line to the standard input of the target.
+func sendStdin(line string) error {
+	if BackendServer.stdinChan == nil {
+		return fmt.Errorf("standard input of the target is not available")
+	}
+	select {
+	case BackendServer.stdinChan <- line:
+		return nil
+	default:
+		return fmt.Errorf("too much pending input")
+	}
+}
+
+// renderOutputLines writes lines to c, returns the length of the text
+// written.
+func renderOutputLines(c *richtext.Ctor, style *style.Style, lines []outputLine) int {
+	normalStyle := richtext.TextStyle{Face: style.Font, Cursor: font.TextCursor}
+	n := 0
+	text := func(s string) {
+		c.Text(s)
+		n += len(s)
+	}
+	for _, line := range lines {
+		if outputPanel.hide[line.Src] {
+			continue
+		}
+		if outputPanel.timestamps && !line.Cont {
+			ts := normalStyle
+			ts.Color = outputTimestampColor
+			c.SetStyle(ts)
+			text(line.Time.Format("15:04:05.000 "))
+		}
+		st := &outputPanel.ansi[line.Src]
+		for _, span := range parseANSI(line.Text, st) {
+			ts := normalStyle
+			if line.Src == scrollbackStderr {
+				ts.Color = outputStderrColor
+			}
+			if span.fg != nil {
+				ts.Color = *span.fg
+			}
+			if span.bg != nil {
+				ts.BgColor = *span.bg
+			}
+			if span.bold {
+				ts.Face = boldFace
+			}
+			if span.reverse {
+				ts.Color, ts.BgColor = style.NormalWindow.Background, ts.Color
+				if ts.BgColor == (color.RGBA{}) {
+					ts.BgColor = style.Text.Color
+				}
+			}
+			c.SetStyle(ts)
+			text(span.text)
+		}
+		c.SetStyle(normalStyle)
+		if line.NL {
+			text("\n")
+		}
+	}
+	return n
+}
+
+// ansiState is the graphic rendition set by ANSI escape sequences.
+type ansiState struct {
+	fg, bg  *color.RGBA
+	bold    bool
+	reverse bool
+}
+
+type ansiSpan struct {
+	text string
+	ansiState
+}
+
+var ansiColors = [16]color.RGBA{
+	{0x00, 0x00, 0x00, 0xff}, {0xcd, 0x00, 0x00, 0xff}, {0x00, 0xcd, 0x00, 0xff}, {0xcd, 0xcd, 0x00, 0xff},
+	{0x00, 0x00, 0xee, 0xff}, {0xcd, 0x00, 0xcd, 0xff}, {0x00, 0xcd, 0xcd, 0xff}, {0xe5, 0xe5, 0xe5, 0xff},
+	{0x7f, 0x7f, 0x7f, 0xff}, {0xff, 0x00, 0x00, 0xff}, {0x00, 0xff, 0x00, 0xff}, {0xff, 0xff, 0x00, 0xff},
+	{0x5c, 0x5c, 0xff, 0xff}, {0xff, 0x00, 0xff, 0xff}, {0x00, 0xff, 0xff, 0xff}, {0xff, 0xff, 0xff, 0xff},
+}
+
+// ansi256 returns color n of the 256 color palette.
+func ansi256(n int) color.RGBA {
+	switch {
+	case n < 16:
+		return ansiColors[n]
+	case n < 232:
+		n -= 16
+		level := func(x int) uint8 {
+			if x == 0 {
+				return 0
+			}
+			return uint8(55 + x*40)
+		}
+		return color.RGBA{level(n / 36), level((n / 6) % 6), level(n % 6), 0xff}
+	default:
+		g := uint8(8 + (n-232)*10)
+		return color.RGBA{g, g, g, 0xff}
+	}
+}
+
+// parseANSI splits text into spans with the same graphic rendition,
+// interpreting SGR escape sequences and removing all other escape
+// sequences. The state at the start of text is read from st, which is
+// updated to the state at the end of text.
+func parseANSI(text string, st *ansiState) []ansiSpan {
+	var r []ansiSpan
+	start := 0
+	flush := func(end int) {
+		if end > start {
+			r = append(r, ansiSpan{text[start:end], *st})
+		}
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\r' {
+			flush(i)
+			start = i + 1
+			continue
+		}
+		if text[i] != 0x1b {
+			continue
+		}
+		flush(i)
+		if i+1 >= len(text) || text[i+1] != '[' {
+			// not a CSI sequence, drop the escape character
+			start = i + 1
+			continue
+		}
+		j := i + 2
+		for j < len(text) && (text[j] < 0x40 || text[j] > 0x7e) {
+			j++
+		}
+		if j >= len(text) {
+			// truncated sequence
+			start = len(text)
+			break
+		}
+		if text[j] == 'm' {
+			st.apply(text[i+2 : j])
+		}
+		i = j
+		start = j + 1
+	}
+	flush(len(text))
+	return r
+}
+
+// apply applies the parameters of a SGR escape sequence.
+func (st *ansiState) apply(params string) {
+	var codes []int
+	for _, p := range strings.Split(params, ";") {
+		n, _ := strconv.Atoi(p)
+		codes = append(codes, n)
+	}
+	extended := func(i int) (*color.RGBA, int) {
+		if i+1 < len(codes) && codes[i+1] == 5 && i+2 < len(codes) {
+			c := ansi256(codes[i+2] & 0xff)
+			return &c, i + 2
+		}
+		if i+1 < len(codes) && codes[i+1] == 2 && i+4 < len(codes) {
+			c := color.RGBA{uint8(codes[i+2]), uint8(codes[i+3]), uint8(codes[i+4]), 0xff}
+			return &c, i + 4
+		}
+		return nil, len(codes)
+	}
+	for i := 0; i < len(codes); i++ {
+		switch n := codes[i]; {
+		case n == 0:
+			*st = ansiState{}
+		case n == 1:
+			st.bold = true
+		case n == 22:
+			st.bold = false
+		case n == 7:
+			st.reverse = true
+		case n == 27:
+			st.reverse = false
+		case n >= 30 && n <= 37:
+			c := ansiColors[n-30]
+			st.fg = &c
+		case n >= 90 && n <= 97:
+			c := ansiColors[n-90+8]
+			st.fg = &c
+		case n == 38:
+			st.fg, i = extended(i)
+		case n == 39:
+			st.fg = nil
+		case n >= 40 && n <= 47:
+			c := ansiColors[n-40]
+			st.bg = &c
+		case n >= 100 && n <= 107:
+			c := ansiColors[n-100+8]
+			st.bg = &c
+		case n == 48:
+			st.bg, i = extended(i)
+		case n == 49:
+			st.bg = nil
+		}
+	}
+}
@@ -27,11 +27,15 @@ var listingPanelHelp = `Displays current listing:
 - first column: a red sign if a breakpoint is set on that line, the sign is
   dimmed for disabled breakpoints.
 - second column: a yellow arrow for the current line of the topmost frame of
-  the current goroutine.
+  the current goroutine. In _test.go files a play button on the first line
+  of each test and subtest, click it to restart the test executable running
+  only that test, with a breakpoint on its first line.
 - third coulumn: line number
 - fourth column: line of source code.
 
-Right click to set or edit breakpoints.`
+Right click to set or edit breakpoints. Drag the mouse over the source code
+to select lines, the selection can be read by starlark scripts with the
+selection builtin.`
 
 var disassemblyPanelHelp = `Displays current disassembly. A yellow arrow marks the current instruction.
 Dimmed lines are unreachable from the current line.`
@@ -75,7 +79,9 @@ Columns from left to right:
 var localsPanelHelp = `Shows local variables and display expressions.
 Add a new expression to evaluate using the 'display' command, see:
 'help display' for more informations.
-Expressions and local variables are refreshed after every stop.`
+Expressions and local variables are refreshed after every stop.
+Formatters for specific types can be defined in the project configuration,
+see 'help config'.`
 
 var autoCheckpointsPanelHelp = `Automatic checkpoints`
 var registersPanelHelp = `Shows registers of the current thread.`
@@ -85,3 +91,39 @@ var checkpointsPanelHelp = `Checkpoints`
 var deferredCallsPanelHelp = `Deferred calls`
 var globalsPanelHelp = `Shows all global variables. Note that keeping this window open can slow down
 debugging.`
+var tasksPanelHelp = `Lists starlark functions running in background, started with the spawn
+builtin. Scripts can change the status of a task by calling set_status.
+Click 'Cancel' to stop a running task.`
+var buildErrorsPanelHelp = `Lists the errors reported by the last build of the target. Click on an
+error to see the corresponding line of source code.
+When 'Rebuild on save' is checked the target is rebuilt and restarted every
+time one of its source files is saved.`
+var testsPanelHelp = `Lists the Test, Benchmark, Fuzz and Example functions of the test
+executable. Select one or more of them and click 'Run selected' to restart
+the program with the corresponding -test.run and -test.bench arguments.
+Click 'Run all' to restart the program without arguments.`
+
+var outputPanelHelp = `Shows the standard output and standard error of the target. While this panel
+is open the output of the target is not written to the command window.
+
+Follow: scrolls automatically to the last line
+Pause: stops updating the panel, output is still collected
+Timestamps: shows the time each line was received
+stdout, stderr: selects which streams are shown
+Load older: loads older lines from the history, which is kept on disk
+Clear: clears the panel, the history is not affected
+
+ANSI color escape sequences are interpreted. Text entered in the 'stdin' line
+is sent to the standard input of the target.`
+
+var terminalPanelHelp = `Shows the terminal of the target, when gdlv is started with the -tty
+option (only available on Linux). The target runs inside a pseudo-terminal, so programs using
+terminal features (line editing, colors, full screen interfaces) work as
+they would in a terminal emulator.
+
+While the panel has keyboard focus all keys, including Escape, are sent to
+the target, except for gdlv's function key shortcuts. Click on another
+panel to move the focus away from the terminal.
+
+Shift-PageUp and Shift-PageDown, or the mouse wheel, scroll through the lines
+that were scrolled off the top of the terminal.`
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// ptySupported is true if the -tty option can be used.
+const ptySupported = true
+
+// openPty allocates a pseudo-terminal and returns its master side and the
+// path of its slave side.
+func openPty() (*os.File, string, error) {
+	fd, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		unix.Close(fd)
+		return nil, "", fmt.Errorf("could not unlock pseudo-terminal: %v", err)
+	}
+	n, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	if err != nil {
+		unix.Close(fd)
+		return nil, "", fmt.Errorf("could not get pseudo-terminal number: %v", err)
+	}
+	return os.NewFile(uintptr(fd), "/dev/ptmx"), fmt.Sprintf("/dev/pts/%d", n), nil
+}
+
+// openPtySlave opens the slave side of a pseudo-terminal without making it
+// the controlling terminal of gdlv.
+func openPtySlave(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR|unix.O_NOCTTY, 0)
+}
+
+// setPtySize changes the size of the pseudo-terminal, the foreground
+// process group of the terminal receives SIGWINCH.
+func setPtySize(master *os.File, cols, rows int) error {
+	return unix.IoctlSetWinsize(int(master.Fd()), unix.TIOCSWINSZ, &unix.Winsize{Row: uint16(rows), Col: uint16(cols)})
+}
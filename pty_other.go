@@ -0,0 +1,26 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// ptySupported is true if the -tty option can be used, pseudo-terminals
+// are only implemented on Linux.
+const ptySupported = false
+
+var errPtyUnsupported = errors.New("pseudo-terminals are only supported on Linux")
+
+func openPty() (*os.File, string, error) {
+	return nil, "", errPtyUnsupported
+}
+
+func openPtySlave(path string) (*os.File, error) {
+	return nil, errPtyUnsupported
+}
+
+func setPtySize(master *os.File, cols, rows int) error {
+	return errPtyUnsupported
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aarzilli/nucular"
+	"golang.org/x/mobile/event/mouse"
+
+	"github.com/aarzilli/gdlv/internal/dlvclient/service/api"
+	"github.com/aarzilli/gdlv/internal/starbind"
+)
+
+// scriptPanel is a panel registered by a starlark script with register_panel.
+type scriptPanel struct {
+	name      string
+	helpMsg   string
+	load      func() ([][]starbind.PanelCell, error)
+	asyncLoad asyncLoad
+	rows      [][]starbind.PanelCell
+	id        int
+}
+
+const scriptPanelCode = '*'
+
+var scriptPanels = map[string]*scriptPanel{}
+
+// getScriptPanel returns the script panel called name, creating it if it
+// doesn't exist. A panel can be created before the script registering it is
+// executed, when it is part of a layout.
+func getScriptPanel(name string) *scriptPanel {
+	p := scriptPanels[name]
+	if p == nil {
+		p = &scriptPanel{name: name}
+		p.asyncLoad.load = p.loadRows
+		scriptPanels[name] = p
+		infoNameToPanel[name] = infoPanel{p.update, 0, &p.asyncLoad}
+	}
+	return p
+}
+
+func (s starlarkContext) RegisterPanel(name, helpMsg string, load func() ([][]starbind.PanelCell, error)) error {
+	if name == "" || strings.ContainsAny(name, " \t*") {
+		return fmt.Errorf("invalid panel name %q", name)
+	}
+	if _, isbuiltin := infoModeToCode[name]; isbuiltin {
+		return fmt.Errorf("panel %q already exists", name)
+	}
+
+	wnd.Lock()
+	defer wnd.Unlock()
+
+	p := getScriptPanel(name)
+	if p.load == nil {
+		infoModes = append(infoModes, name)
+	}
+	p.helpMsg = helpMsg
+	p.load = load
+	p.asyncLoad.clear()
+	return nil
+}
+
+func (p *scriptPanel) loadRows(l *asyncLoad) {
+	rows, err := p.load()
+	p.rows = rows
+	p.id++
+	l.done(err)
+}
+
+func (p *scriptPanel) update(container *nucular.Window) {
+	if p.load == nil {
+		container.Row(0).Dynamic(1)
+		container.Label("Panel not registered by any script", "LT")
+		return
+	}
+	if container.HelpClicked {
+		helpMsg := p.helpMsg
+		if helpMsg == "" {
+			helpMsg = "Panel defined by a starlark script"
+		}
+		showHelp(container.Master(), p.name+" Panel Help", helpMsg)
+	}
+	w := p.asyncLoad.showRequest(container)
+	if w == nil {
+		return
+	}
+
+	for _, row := range p.rows {
+		w.Row(20).Static()
+		for _, cell := range row {
+			w.LayoutFitWidth(p.id, 1)
+			switch cell.Kind {
+			case starbind.PanelLabel:
+				w.Label(cell.Text, "LC")
+			case starbind.PanelLink:
+				w.LabelColored(cell.Text, "LC", linkColor)
+				if w.Input().Mouse.IsClickInRect(mouse.ButtonLeft, w.LastWidgetBounds) {
+					listingPanel.pinnedLoc = &api.Location{File: cell.File, Line: cell.Line}
+					go refreshState(refreshToSameFrame, clearNothing, nil)
+				}
+			case starbind.PanelButton:
+				if w.ButtonText(cell.Text) {
+					doCommand(cell.Command)
+				}
+			}
+		}
+	}
+}
+
+func (s starlarkContext) TaskChanged(task *starbind.Task) {
+	wnd.Changed()
+}
+
+var tasksRefreshPending int32
+
+func updateTasks(w *nucular.Window) {
+	if w.HelpClicked {
+		showHelp(w.Master(), "Tasks Panel Help", tasksPanelHelp)
+	}
+
+	tasks := StarlarkEnv.Tasks()
+
+	w.Row(20).Static(0, 120)
+	w.Spacing(1)
+	if w.ButtonText("Clear finished") {
+		StarlarkEnv.ClearFinishedTasks()
+	}
+
+	if len(tasks) == 0 {
+		w.Row(20).Dynamic(1)
+		w.Label("No tasks", "LC")
+		return
+	}
+
+	running := false
+
+	for _, task := range tasks {
+		status, done, err := task.Status()
+		switch {
+		case err != nil:
+			status = fmt.Sprintf("failed: %v", err)
+		case done && status == "":
+			status = "done"
+		case !done:
+			running = true
+		}
+		w.Row(20).Static(40, 150, 80, 0, 80)
+		w.Label(fmt.Sprintf("%d", task.ID), "LC")
+		w.Label(task.Name, "LC")
+		w.Label(task.Elapsed().Round(time.Second).String(), "LC")
+		w.Label(status, "LC")
+		if done {
+			w.Spacing(1)
+		} else if w.ButtonText("Cancel") {
+			task.Cancel()
+		}
+	}
+
+	if running && atomic.CompareAndSwapInt32(&tasksRefreshPending, 0, 1) {
+		// keep elapsed times updated
+		go func() {
+			time.Sleep(time.Second)
+			atomic.StoreInt32(&tasksRefreshPending, 0)
+			wnd.Changed()
+		}()
+	}
+}
@@ -1,10 +1,23 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 
+	"github.com/aarzilli/nucular"
 	"github.com/aarzilli/nucular/font"
 	"github.com/aarzilli/nucular/richtext"
+	"github.com/aarzilli/nucular/style"
+	"golang.org/x/mobile/event/key"
 )
 
 var silenced bool
@@ -13,19 +26,97 @@ var scrollbackEditor = richtext.New(richtext.Selectable | richtext.ShowTick | ri
 var scrollbackClear bool
 var scrollbackInitialized bool
 var scrollbackMu sync.Mutex
-var scrollbackPreInitWrite []byte
 
-type editorWriter struct {
-	lock bool
+// scrollbackSource is the origin of some text written to the scrollback.
+type scrollbackSource uint8
+
+const (
+	scrollbackGdlv   scrollbackSource = iota // commands and their output
+	scrollbackStdout                         // standard output of the target
+	scrollbackStderr                         // standard error of the target
+)
+
+var scrollbackSourceNames = []string{"gdlv", "stdout", "stderr"}
+
+// scrollbackEntry is a piece of text written to the scrollback.
+type scrollbackEntry struct {
+	Src   scrollbackSource
+	Text  string
+	Links []scrollbackLink `json:",omitempty"`
+
+	id uint64 // identifies entries containing expandable links
+}
+
+// scrollbackLink is a link inside the text of a scrollbackEntry.
+type scrollbackLink struct {
+	S, E int    // byte offsets of the link text
+	Href string `json:",omitempty"` // target of the link when saved as HTML
+
+	fn func()
 }
 
+var scrollback = struct {
+	entries []scrollbackEntry // entries kept in memory, the full transcript is in spool
+	lines   int               // number of lines in entries
+	lastID  uint64            // last id assigned to an entry
+
+	filter   int    // 0 shows everything, otherwise scrollbackSource+1
+	search   string // text being searched, highlighted in the scrollback
+	showBar  bool   // search bar visible
+	searchEd nucular.TextEditor
+
+	pending []scrollbackEntry // entries not yet written to the spool file
+}{}
+
+// scrollbackSpool is the file containing the full transcript of the
+// session, it's written by a separate goroutine so that scrollbackAdd,
+// which is called with wnd locked, doesn't do any I/O.
+var scrollbackSpool = struct {
+	mu    sync.Mutex
+	start sync.Once
+	wake  chan struct{}
+	file  *os.File
+	w     *bufio.Writer
+	err   error
+}{wake: make(chan struct{}, 1)}
+
 const (
 	scrollbackHighMark = 64 * 1024
 	scrollbackLowMark  = 32 * 1024
+
+	scrollbackMaxLines = 10000
 )
 
+var searchMatchColor = color.RGBA{0xff, 0xd7, 0x00, 0xff}
+
+type editorWriter struct {
+	lock bool
+}
+
 func (w *editorWriter) Write(b []byte) (int, error) {
-	if w.lock {
+	return writeScrollback(w.lock, scrollbackGdlv, b)
+}
+
+// outputWriter writes the output of the target program to the output
+// panel and, if the output panel isn't open, to the scrollback.
+type outputWriter struct {
+	src scrollbackSource
+}
+
+func (w *outputWriter) Write(b []byte) (int, error) {
+	outputPanelWrite(w.src, b)
+	wnd.Lock()
+	outputOpen := findWindow(infoOutput) != nil
+	wnd.Unlock()
+	if outputOpen {
+		wnd.Changed()
+		return len(b), nil
+	}
+	return writeScrollback(true, w.src, b)
+}
+
+func writeScrollback(lock bool, src scrollbackSource, b []byte) (int, error) {
+	if lock {
 		wnd.Lock()
 		defer wnd.Unlock()
 		defer wnd.Changed()
@@ -35,20 +126,444 @@ func (w *editorWriter) Write(b []byte) (int, error) {
 		onNewline = b[len(b)-1] == '\n'
 	}
 
-	scrollbackMu.Lock()
-	if !scrollbackInitialized {
-		scrollbackPreInitWrite = append(scrollbackPreInitWrite, b...)
+	scrollbackAdd(scrollbackEntry{Src: src, Text: string(b)})
+	return len(b), nil
+}
+
+// scrollbackCtor accumulates an entry for the scrollback containing links,
+// the entry is added to the scrollback when End is called.
+type scrollbackCtor struct {
+	entry scrollbackEntry
+}
+
+// scrollbackAppend starts a new scrollback entry, must be called with wnd
+// locked.
+func scrollbackAppend() *scrollbackCtor {
+	return &scrollbackCtor{}
+}
+
+func (c *scrollbackCtor) Text(s string) {
+	c.entry.Text += s
+}
+
+func (c *scrollbackCtor) Link(text, href string, fn func()) {
+	s := len(c.entry.Text)
+	c.entry.Text += text
+	c.entry.Links = append(c.entry.Links, scrollbackLink{S: s, E: len(c.entry.Text), Href: href, fn: fn})
+}
+
+// Expandable writes a link with the specified text that, when clicked, is
+// replaced by the text returned by expand.
+func (c *scrollbackCtor) Expandable(text string, expand func() string) {
+	if c.entry.id == 0 {
+		scrollbackMu.Lock()
+		scrollback.lastID++
+		c.entry.id = scrollback.lastID
 		scrollbackMu.Unlock()
-		return len(b), nil
 	}
+	id, s := c.entry.id, len(c.entry.Text)
+	c.Link(text, "", func() {
+		expandScrollbackLink(id, s, expand())
+	})
+}
+
+func (c *scrollbackCtor) End() {
+	scrollbackAdd(c.entry)
+}
+
+// expandScrollbackLink replaces the link starting at byte offset s of the
+// entry id with text, the entry is redrawn in place. Nothing happens if the
+// entry was already removed from the scrollback.
+func expandScrollbackLink(id uint64, s int, text string) {
+	scrollbackMu.Lock()
+	defer scrollbackMu.Unlock()
+	for i := range scrollback.entries {
+		e := &scrollback.entries[i]
+		if e.id != id {
+			continue
+		}
+		for j := range e.Links {
+			l := e.Links[j]
+			if l.S != s {
+				continue
+			}
+			scrollback.lines += strings.Count(text, "\n") - strings.Count(e.Text[l.S:l.E], "\n")
+			e.Text = e.Text[:l.S] + text + e.Text[l.E:]
+			d := len(text) - (l.E - l.S)
+			e.Links = append(e.Links[:j], e.Links[j+1:]...)
+			for k := j; k < len(e.Links); k++ {
+				e.Links[k].S += d
+				e.Links[k].E += d
+			}
+			scrollbackClear = true
+			return
+		}
+		return
+	}
+}
+
+// scrollbackAdd adds e to the scrollback and to the spool file.
+func scrollbackAdd(e scrollbackEntry) {
+	if e.Text == "" {
+		return
+	}
+
+	scrollbackMu.Lock()
+	scrollback.entries = append(scrollback.entries, e)
+	scrollback.lines += strings.Count(e.Text, "\n")
+	trimScrollback()
+	scrollback.pending = append(scrollback.pending, e)
+	show := scrollbackInitialized && scrollbackFilterShows(scrollback.filter, e.Src)
+	search := scrollback.search
 	scrollbackMu.Unlock()
 
-	c := scrollbackEditor.Append(true)
-	c.SetStyle(richtext.TextStyle{Cursor: font.TextCursor})
-	c.Text(string(b))
-	c.End()
-	scrollbackEditor.Tail(10000)
-	return len(b), nil
+	scrollbackSpool.start.Do(func() { go scrollbackSpooler() })
+	select {
+	case scrollbackSpool.wake <- struct{}{}:
+	default:
+	}
+
+	if show {
+		c := scrollbackEditor.Append(true)
+		renderScrollbackEntry(c, wnd.Style(), &e, search)
+		c.End()
+		scrollbackEditor.Tail(scrollbackMaxLines)
+	}
+}
+
+func scrollbackFilterShows(filter int, src scrollbackSource) bool {
+	return filter == 0 || filter == int(src)+1
+}
+
+// trimScrollback removes the oldest entries, keeping at most
+// scrollbackMaxLines lines in memory. Must be called with scrollbackMu
+// locked.
+func trimScrollback() {
+	i := 0
+	for i < len(scrollback.entries)-1 && scrollback.lines > scrollbackMaxLines {
+		scrollback.lines -= strings.Count(scrollback.entries[i].Text, "\n")
+		i++
+	}
+	if i > 0 {
+		scrollback.entries = append(scrollback.entries[:0], scrollback.entries[i:]...)
+	}
+}
+
+func scrollbackSpooler() {
+	for range scrollbackSpool.wake {
+		scrollbackSpool.mu.Lock()
+		spoolScrollbackPending()
+		scrollbackSpool.mu.Unlock()
+	}
+}
+
+// spoolScrollbackPending appends the pending entries to the spool file,
+// which contains the full transcript of the session. Must be called with
+// scrollbackSpool.mu locked.
+func spoolScrollbackPending() {
+	scrollbackMu.Lock()
+	pending := scrollback.pending
+	scrollback.pending = nil
+	scrollbackMu.Unlock()
+
+	if scrollbackSpool.err != nil || len(pending) == 0 {
+		return
+	}
+	if scrollbackSpool.file == nil {
+		scrollbackSpool.file, scrollbackSpool.err = os.CreateTemp("", "gdlv-scrollback-*.jsonl")
+		if scrollbackSpool.err != nil {
+			return
+		}
+		scrollbackSpool.w = bufio.NewWriter(scrollbackSpool.file)
+	}
+	for i := range pending {
+		buf, _ := json.Marshal(&pending[i])
+		buf = append(buf, '\n')
+		if _, err := scrollbackSpool.w.Write(buf); err != nil {
+			scrollbackSpool.err = err
+			return
+		}
+	}
+}
+
+// flushScrollbackSpool writes all pending entries to the spool file and
+// flushes it. Must be called with scrollbackSpool.mu locked.
+func flushScrollbackSpool() {
+	spoolScrollbackPending()
+	if scrollbackSpool.err == nil && scrollbackSpool.w != nil {
+		scrollbackSpool.err = scrollbackSpool.w.Flush()
+	}
+}
+
+// closeScrollbackSpool deletes the spool file.
+func closeScrollbackSpool() {
+	scrollbackSpool.mu.Lock()
+	defer scrollbackSpool.mu.Unlock()
+	if scrollbackSpool.file != nil {
+		scrollbackSpool.file.Close()
+		os.Remove(scrollbackSpool.file.Name())
+		scrollbackSpool.file = nil
+		scrollbackSpool.w = nil
+	}
+	scrollbackSpool.err = io.ErrClosedPipe
+}
+
+// renderScrollback writes all the entries kept in memory to c, returns the
+// length of the text written.
+func renderScrollback(c *richtext.Ctor, style *style.Style) int {
+	scrollbackMu.Lock()
+	defer scrollbackMu.Unlock()
+	n := 0
+	for i := range scrollback.entries {
+		e := &scrollback.entries[i]
+		if scrollbackFilterShows(scrollback.filter, e.Src) {
+			renderScrollbackEntry(c, style, e, scrollback.search)
+			n += len(e.Text)
+		}
+	}
+	return n
+}
+
+// renderScrollbackEntry writes e to c, highlighting the occurences of search.
+func renderScrollbackEntry(c *richtext.Ctor, style *style.Style, e *scrollbackEntry, search string) {
+	normalStyle := richtext.TextStyle{Face: style.Font, Cursor: font.TextCursor}
+	linkStyle := richtext.TextStyle{Face: style.Font, Color: linkColor, Flags: richtext.Underline}
+
+	matches := findMatches(e.Text, search)
+
+	// split the text at the boundaries of links and matches
+	cuts := []int{0, len(e.Text)}
+	for _, l := range e.Links {
+		cuts = append(cuts, l.S, l.E)
+	}
+	for _, m := range matches {
+		cuts = append(cuts, m[0], m[1])
+	}
+	sort.Ints(cuts)
+
+	for i := 0; i+1 < len(cuts); i++ {
+		s, end := cuts[i], cuts[i+1]
+		if s == end {
+			continue
+		}
+		var link *scrollbackLink
+		for j := range e.Links {
+			if e.Links[j].S <= s && end <= e.Links[j].E {
+				link = &e.Links[j]
+				break
+			}
+		}
+		match := false
+		for _, m := range matches {
+			if m[0] <= s && end <= m[1] {
+				match = true
+				break
+			}
+		}
+
+		ts := normalStyle
+		if link != nil {
+			ts = linkStyle
+		}
+		if match {
+			ts.Color = color.RGBA{0x00, 0x00, 0x00, 0xff}
+			ts.BgColor = searchMatchColor
+		}
+		c.SetStyle(ts)
+		if link != nil && link.fn != nil {
+			c.Link(e.Text[s:end], linkHoverColor, link.fn)
+		} else {
+			c.Text(e.Text[s:end])
+		}
+	}
+	c.SetStyle(normalStyle)
+}
+
+// findMatches returns the positions of all occurences of search in text.
+// The search is case insensitive if search doesn't contain uppercase
+// letters, like richtext.(*RichText).Look.
+func findMatches(text, search string) [][2]int {
+	if search == "" {
+		return nil
+	}
+	haystack := text
+	if strings.ToLower(search) == search {
+		haystack = strings.ToLower(text)
+		if len(haystack) != len(text) {
+			// lowercasing changed the byte offsets
+			haystack = text
+		}
+	}
+	var r [][2]int
+	for off := 0; ; {
+		i := strings.Index(haystack[off:], search)
+		if i < 0 {
+			break
+		}
+		r = append(r, [2]int{off + i, off + i + len(search)})
+		off += i + len(search)
+	}
+	return r
+}
+
+// clearScrollback removes all the entries from the scrollback, the spool
+// file is not affected.
+func clearScrollback() {
+	scrollbackMu.Lock()
+	scrollback.entries = nil
+	scrollback.lines = 0
+	scrollbackMu.Unlock()
+	scrollbackClear = true
+}
+
+// setScrollbackView changes the filter and search string of the scrollback
+// and redraws it.
+func setScrollbackView(filter int, search string) {
+	scrollbackMu.Lock()
+	changed := scrollback.filter != filter || scrollback.search != search
+	scrollback.filter = filter
+	scrollback.search = search
+	scrollbackMu.Unlock()
+	if changed {
+		scrollbackClear = true
+	}
+}
+
+// updateScrollbackSearch shows the scrollback search bar, opened with Ctrl+F.
+func updateScrollbackSearch(w *nucular.Window) {
+	for _, k := range w.Input().Keyboard.Keys {
+		if k.Modifiers == key.ModControl && k.Code == key.CodeF {
+			scrollback.showBar = true
+			scrollback.searchEd.Flags = nucular.EditSelectable | nucular.EditSigEnter | nucular.EditClipboard
+			w.Master().ActivateEditor(w, &scrollback.searchEd)
+		}
+	}
+	if !scrollback.showBar {
+		return
+	}
+
+	scrollbackMu.Lock()
+	filter := scrollback.filter
+	scrollbackMu.Unlock()
+
+	w.Row(commandLineHeight).Static(60, 0, 60, 120, 60)
+	w.Label("Search:", "LC")
+	ev := scrollback.searchEd.Edit(w)
+	search := string(scrollback.searchEd.Buffer)
+	next := ev&nucular.EditCommitted != 0
+	if w.ButtonText("Next") {
+		next = true
+	}
+	filter = w.ComboSimple(append([]string{"all"}, scrollbackSourceNames...), filter, 20)
+	if w.ButtonText("Close") || (scrollback.searchEd.Active && w.Input().Keyboard.Pressed(key.CodeEscape)) {
+		scrollback.showBar = false
+		search = ""
+		w.Master().ActivateEditor(w, &commandLineEditor)
+	}
+
+	setScrollbackView(filter, search)
+
+	if next && search != "" {
+		scrollbackEditor.Sel.S = scrollbackEditor.Sel.E
+		if scrollbackEditor.Look(search, true) {
+			scrollbackEditor.FollowCursor()
+		}
+	}
+}
+
+// scrollbackFilterValue returns the filter value for the source named name.
+func scrollbackFilterValue(name string) int {
+	for i := range scrollbackSourceNames {
+		if scrollbackSourceNames[i] == name {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// saveScrollback writes the full transcript of the session to path, as
+// HTML if path ends in .html or .htm and as text otherwise.
+func saveScrollback(path string) error {
+	// keep the spool file locked while it's copied so that no partially
+	// written entries are read.
+	scrollbackSpool.mu.Lock()
+	defer scrollbackSpool.mu.Unlock()
+	flushScrollbackSpool()
+	spool, spoolErr := scrollbackSpool.file, scrollbackSpool.err
+	if spool == nil {
+		if spoolErr != nil {
+			return fmt.Errorf("transcript not available: %v", spoolErr)
+		}
+		return fmt.Errorf("transcript is empty")
+	}
+
+	in, err := os.Open(spool.Name())
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	err = writeTranscript(out, in, ext == ".html" || ext == ".htm")
+	if err2 := out.Close(); err == nil {
+		err = err2
+	}
+	if err == nil && spoolErr != nil {
+		err = fmt.Errorf("transcript is incomplete: %v", spoolErr)
+	}
+	return err
+}
+
+// writeTranscript copies the contents of a spool file to out.
+func writeTranscript(out io.Writer, spool io.Reader, asHTML bool) error {
+	w := bufio.NewWriter(out)
+	if asHTML {
+		fmt.Fprintf(w, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>gdlv transcript</title>\n<style>.stderr { color: #c00000; } .stdout { color: #404040; } .link { text-decoration: underline; }</style>\n</head><body><pre>")
+	}
+	s := bufio.NewScanner(spool)
+	s.Buffer(nil, 64*1024*1024)
+	for s.Scan() {
+		var e scrollbackEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return err
+		}
+		if !asHTML {
+			w.WriteString(e.Text)
+			continue
+		}
+		if e.Src != scrollbackGdlv {
+			fmt.Fprintf(w, "<span class=%q>", scrollbackSourceNames[e.Src])
+		}
+		off := 0
+		for _, l := range e.Links {
+			if l.S < off || l.E > len(e.Text) {
+				continue
+			}
+			w.WriteString(html.EscapeString(e.Text[off:l.S]))
+			if l.Href != "" {
+				fmt.Fprintf(w, "<a href=\"%s\">%s</a>", html.EscapeString(l.Href), html.EscapeString(e.Text[l.S:l.E]))
+			} else {
+				fmt.Fprintf(w, "<span class=\"link\">%s</span>", html.EscapeString(e.Text[l.S:l.E]))
+			}
+			off = l.E
+		}
+		w.WriteString(html.EscapeString(e.Text[off:]))
+		if e.Src != scrollbackGdlv {
+			w.WriteString("</span>")
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	if asHTML {
+		fmt.Fprintf(w, "</pre></body></html>\n")
+	}
+	return w.Flush()
 }
 
 func currentColumn(buf []rune) int {
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -28,6 +31,10 @@ type ServerDescr struct {
 	serverProcess *os.Process
 	// arguments for 'go' used to build the executable
 	buildcmd []string
+	// environment variables for the 'go' command
+	buildenv []string
+	// options used to create buildcmd
+	buildopts *commandLineOptions
 	// directory where the 'go' command to build the executable should be run
 	builddir string
 	// executable file (if we did the build)
@@ -41,13 +48,64 @@ type ServerDescr struct {
 	// connection to delve failed
 	connectionFailed bool
 	debugid          string
+	// environment variables added to the environment of delve, inherited by
+	// the target process
+	env []string
+	// environment variables removed from the environment of delve
+	unsetenv []string
+	// env was changed since delve was started
+	envChanged bool
+	// runs the target in the Terminal panel
+	tty bool
+	// the executable must not be removed when gdlv exits (it is needed by
+	// rr recordings)
+	keepExecutable bool
 }
 
-var RemoveExecutable bool = true
-var BackendServer ServerDescr
+var BackendServer = &ServerDescr{}
 var ScheduledBreakpoints []string
 
-func parseArguments() (descr ServerDescr) {
+func parseArguments() *ServerDescr {
+	if os.Getenv("CGO_CFLAGS") == "" {
+		os.Setenv("CGO_CFLAGS", "-O0 -g")
+	}
+	if os.Getenv("GODEBUG") == "" {
+		os.Setenv("GODEBUG", fmt.Sprintf("tracebackancestors=%d", NumAncestors))
+	}
+
+	opts := parseOptions(os.Args)
+
+	if opts.launch != "" {
+		lc := projectConf.Launch[opts.launch]
+		if lc == nil {
+			usage(fmt.Sprintf("unknown launch configuration %q", opts.launch))
+		}
+		env, wd, tty := opts.env, opts.wd, opts.tty
+		opts = lc.commandLineOptions()
+		opts.env = append(opts.env, env...)
+		if wd != "" {
+			opts.wd = wd
+		}
+		opts.tty = opts.tty || tty
+	}
+
+	if opts.cmd == "version" {
+		fmt.Fprintf(os.Stderr, "Gdlv Debugger\nVersion: 1.15\n")
+		os.Exit(0)
+	}
+
+	descr, err := newServerDescr(&opts)
+	if err != nil {
+		usage(err.Error())
+	}
+	return descr
+}
+
+// newServerDescr returns the description of the backend server described by
+// opts.
+func newServerDescr(opts *commandLineOptions) (*ServerDescr, error) {
+	descr := &ServerDescr{}
+
 	debugname := func(p string) {
 		p = filepath.Base(p)
 		if i := strings.LastIndex(p, "."); i >= 0 {
@@ -57,14 +115,9 @@ func parseArguments() (descr ServerDescr) {
 		if p != "" {
 			template = fmt.Sprintf("%s-gdlv-debug", p)
 		}
-		fh, err := ioutil.TempFile(os.TempDir(), template)
-		if err != nil {
-			descr.exe = fmt.Sprintf("%s/gdlv-debug", os.TempDir())
-			return
-		}
-		descr.exe = fh.Name()
-		fh.Close()
-		os.Remove(descr.exe)
+		// the file is not created here, newServerDescr is also used to
+		// validate launch configurations
+		descr.exe = filepath.Join(os.TempDir(), template+strconv.FormatUint(uint64(rand.Uint32()), 10))
 	}
 
 	finish := func(atStart bool, args ...string) {
@@ -72,47 +125,41 @@ func parseArguments() (descr ServerDescr) {
 		descr.dlvargs = args
 	}
 
-	if os.Getenv("CGO_CFLAGS") == "" {
-		os.Setenv("CGO_CFLAGS", "-O0 -g")
-	}
-	if os.Getenv("GODEBUG") == "" {
-		os.Setenv("GODEBUG", fmt.Sprintf("tracebackancestors=%d", NumAncestors))
-	}
+	descr.keepExecutable = !opts.defaultBackend
 
-	opts := parseOptions(os.Args)
+	descr.env = opts.env
 
-	optflags := []string{"-gcflags", "-N -l"}
-	ver, _ := goversion.Installed()
-	switch {
-	case ver.Major < 0 || ver.AfterOrEqualRel(1, 10):
-		optflags = []string{"-gcflags", "all=-N -l"}
-	case ver.AfterOrEqualRel(1, 9):
-		optflags = []string{"-gcflags", "-N -l", "-a"}
+	switch opts.cmd {
+	case "connect", "attach", "core", "replay":
+		switch {
+		case len(opts.env) > 0:
+			return nil, fmt.Errorf("can not use -env with '%s'", opts.cmd)
+		case opts.wd != "":
+			return nil, fmt.Errorf("can not use -wd with '%s'", opts.cmd)
+		case opts.tty:
+			return nil, fmt.Errorf("can not use -tty with '%s'", opts.cmd)
+		}
 	}
-
-	if !opts.defaultBackend {
-		RemoveExecutable = false
+	if opts.tty && !ptySupported {
+		return nil, errors.New("-tty is only supported on Linux")
+	}
+	if opts.tty && opts.redirects != [3]string{} {
+		return nil, errors.New("can not use -tty with -r")
 	}
 
 	switch opts.cmd {
 	case "connect":
 		if len(opts.cmdArgs) != 1 {
-			usage("wrong number of arguments")
-		}
-		if opts.buildDir != "" {
-			usage("can not use -d with 'connect'")
+			return nil, errors.New("wrong number of arguments")
 		}
-		if opts.tags != "" {
-			usage("can not use -tags with 'connect'")
+		if err := opts.checkBuildOptions(); err != nil {
+			return nil, err
 		}
 		descr.connectString = opts.cmdArgs[0]
 
 	case "attach":
-		if opts.buildDir != "" {
-			usage("can not use -d with 'attach'")
-		}
-		if opts.tags != "" {
-			usage("can not use -tags with 'attach'")
+		if err := opts.checkBuildOptions(); err != nil {
+			return nil, err
 		}
 		switch len(opts.cmdArgs) {
 		case 1:
@@ -120,7 +167,7 @@ func parseArguments() (descr ServerDescr) {
 		case 2:
 			finish(false, opts.backend, "--headless", "attach", opts.cmdArgs[0], opts.cmdArgs[1])
 		default:
-			usage("wrong number of arguments")
+			return nil, errors.New("wrong number of arguments")
 		}
 
 	case "debug":
@@ -131,54 +178,34 @@ func parseArguments() (descr ServerDescr) {
 		debugname(dir)
 		descr.builddir = opts.buildDir
 		descr.debugid = dir
-		descr.buildcmd = []string{"build", "-o", descr.exe}
-		if opts.tags != "" {
-			descr.buildcmd = append(descr.buildcmd, "-tags", opts.tags)
+		if err := descr.setBuildCommand(opts); err != nil {
+			return nil, err
 		}
-		descr.buildcmd = append(descr.buildcmd, optflags...)
-		args := make([]string, 0, len(opts.cmdArgs)+4)
-		args = append(args, opts.redirectArgs()...)
-		args = append(args, opts.backend, "--headless", "exec", descr.exe, "--")
-		args = append(args, opts.cmdArgs...)
-		finish(true, args...)
+		finish(true, opts.execArgs(descr.exe, opts.cmdArgs)...)
 
 	case "run":
 		if len(opts.cmdArgs) < 1 {
-			usage("wrong number of arguments")
+			return nil, errors.New("wrong number of arguments")
 		}
 		if opts.buildDir != "" {
-			usage("can not use -d with 'run'")
+			return nil, errors.New("can not use -d with 'run'")
 		}
 		debugname(opts.cmdArgs[0])
 		descr.debugid, _ = filepath.Abs(opts.cmdArgs[0])
-		descr.buildcmd = []string{"build", "-o", descr.exe}
-		if opts.tags != "" {
-			descr.buildcmd = append(descr.buildcmd, "-tags", opts.tags)
+		if err := descr.setBuildCommand(opts); err != nil {
+			return nil, err
 		}
-		descr.buildcmd = append(descr.buildcmd, optflags...)
-		descr.buildcmd = append(descr.buildcmd, opts.cmdArgs[0])
-		args := make([]string, 0, len(opts.cmdArgs[1:])+4)
-		args = append(args, opts.redirectArgs()...)
-		args = append(args, opts.backend, "--headless", "exec", descr.exe, "--")
-		args = append(args, opts.cmdArgs[1:]...)
-		finish(true, args...)
+		finish(true, opts.execArgs(descr.exe, opts.cmdArgs[1:])...)
 
 	case "exec":
 		if len(opts.cmdArgs) < 1 {
-			usage("wrong number of arguments")
-		}
-		if opts.buildDir != "" {
-			usage("can not use -d with 'exec'")
+			return nil, errors.New("wrong number of arguments")
 		}
-		if opts.tags != "" {
-			usage("can not use -tags with 'exec'")
+		if err := opts.checkBuildOptions(); err != nil {
+			return nil, err
 		}
 		descr.debugid, _ = filepath.Abs(opts.cmdArgs[0])
-		args := make([]string, 0, len(opts.cmdArgs[1:])+5)
-		args = append(args, opts.redirectArgs()...)
-		args = append(args, opts.backend, "--headless", "exec", opts.cmdArgs[0], "--")
-		args = append(args, opts.cmdArgs[1:]...)
-		finish(true, args...)
+		finish(true, opts.execArgs(opts.cmdArgs[0], opts.cmdArgs[1:])...)
 
 	case "test":
 		dir := opts.buildDir
@@ -187,59 +214,242 @@ func parseArguments() (descr ServerDescr) {
 		}
 		debugname(dir)
 		descr.debugid = dir
-		descr.buildcmd = []string{"test"}
-		if opts.tags != "" {
-			descr.buildcmd = append(descr.buildcmd, "-tags", opts.tags)
+		if err := descr.setBuildCommand(opts); err != nil {
+			return nil, err
 		}
-		descr.buildcmd = append(descr.buildcmd, optflags...)
-		descr.buildcmd = append(descr.buildcmd, "-c", "-o", descr.exe)
-		args := make([]string, 0, len(opts.cmdArgs)+4)
-		args = append(args, opts.redirectArgs()...)
-		args = append(args, opts.backend, "--headless", "exec", descr.exe, "--")
-		args = append(args, addTestPrefix(opts.cmdArgs)...)
-		finish(true, args...)
+		finish(true, opts.execArgs(descr.exe, addTestPrefix(opts.cmdArgs))...)
 
 	case "core":
 		if !opts.defaultBackend {
-			usage("invalid backend for 'core' command")
+			return nil, errors.New("invalid backend for 'core' command")
 		}
 		if len(opts.cmdArgs) < 2 {
-			usage("wrong number of arguments")
-		}
-		if opts.buildDir != "" {
-			usage("can not use -d with 'core'")
+			return nil, errors.New("wrong number of arguments")
 		}
-		if opts.tags != "" {
-			usage("can not use -tags with 'core'")
+		if err := opts.checkBuildOptions(); err != nil {
+			return nil, err
 		}
 		descr.debugid, _ = filepath.Abs(opts.cmdArgs[0])
 		finish(true, "--headless", "core", opts.cmdArgs[0], opts.cmdArgs[1])
 
 	case "replay":
 		if !opts.defaultBackend {
-			usage("invalid backend for 'replay' command")
+			return nil, errors.New("invalid backend for 'replay' command")
 		}
 		if len(opts.cmdArgs) < 1 {
-			usage("wrong number of arguments")
-		}
-		if opts.buildDir != "" {
-			usage("can not use -d with 'replay'")
+			return nil, errors.New("wrong number of arguments")
 		}
-		if opts.tags != "" {
-			usage("can not use -tags with 'replay'")
+		if err := opts.checkBuildOptions(); err != nil {
+			return nil, err
 		}
 		descr.debugid = "replay-" + opts.cmdArgs[0]
 		finish(true, "--headless", "replay", opts.cmdArgs[0])
 
-	case "version":
-		fmt.Fprintf(os.Stderr, "Gdlv Debugger\nVersion: 1.15\n")
-		os.Exit(0)
-
 	default:
-		usage(fmt.Sprintf("unknown command %q", opts.cmd))
+		return nil, fmt.Errorf("unknown command %q", opts.cmd)
+	}
+
+	descr.tty = opts.tty
+
+	return descr, nil
+}
+
+// setBuildCommand sets the command used to build the target described by
+// opts, using the build profile opts.profile.
+func (descr *ServerDescr) setBuildCommand(opts *commandLineOptions) error {
+	var profile BuildProfile
+	if opts.profile != "" {
+		p, ok := conf.BuildProfiles[opts.profile]
+		if !ok {
+			return fmt.Errorf("unknown build profile %q", opts.profile)
+		}
+		profile = p
+	}
+
+	var flags []string
+	descr.buildenv = nil
+
+	if !profile.Optimized {
+		flags = []string{"-gcflags", "-N -l"}
+		ver, _ := goversion.Installed()
+		switch {
+		case ver.Major < 0 || ver.AfterOrEqualRel(1, 10):
+			flags = []string{"-gcflags", "all=-N -l"}
+		case ver.AfterOrEqualRel(1, 9):
+			flags = []string{"-gcflags", "-N -l", "-a"}
+		}
+	}
+	if opts.tags != "" {
+		flags = append(flags, "-tags", opts.tags)
+	}
+	flags = append(flags, splitQuotedFields(profile.Flags, '\'')...)
+	flags = append(flags, splitQuotedFields(opts.buildFlags, '\'')...)
+	if profile.GoFlags != "" {
+		descr.buildenv = []string{"GOFLAGS=" + profile.GoFlags}
 	}
 
-	return
+	switch opts.cmd {
+	case "debug":
+		descr.buildcmd = append([]string{"build", "-o", descr.exe}, flags...)
+	case "run":
+		descr.buildcmd = append([]string{"build", "-o", descr.exe}, flags...)
+		descr.buildcmd = append(descr.buildcmd, opts.cmdArgs[0])
+	case "test":
+		descr.buildcmd = append([]string{"test"}, flags...)
+		descr.buildcmd = append(descr.buildcmd, "-c", "-o", descr.exe)
+	}
+	descr.buildopts = opts
+	return nil
+}
+
+// isTest returns true if the target is a test executable built by gdlv.
+func (descr *ServerDescr) isTest() bool {
+	return descr != nil && len(descr.buildcmd) > 0 && descr.buildcmd[0] == "test"
+}
+
+// checkBuildOptions returns an error if any build option was specified for
+// a command that doesn't build the target.
+func (opts *commandLineOptions) checkBuildOptions() error {
+	switch {
+	case opts.buildDir != "":
+		return fmt.Errorf("can not use -d with '%s'", opts.cmd)
+	case opts.tags != "":
+		return fmt.Errorf("can not use -tags with '%s'", opts.cmd)
+	case opts.buildFlags != "":
+		return fmt.Errorf("can not use -buildflags with '%s'", opts.cmd)
+	case opts.profile != "":
+		return fmt.Errorf("can not use -profile with '%s'", opts.cmd)
+	}
+	return nil
+}
+
+// execArgs returns the arguments for delve to execute exe with the
+// specified program arguments.
+func (opts *commandLineOptions) execArgs(exe string, progArgs []string) []string {
+	args := make([]string, 0, len(progArgs)+8)
+	args = append(args, opts.redirectArgs()...)
+	if opts.wd != "" {
+		args = append(args, "--wd", opts.wd)
+	}
+	args = append(args, opts.backend, "--headless", "exec", exe, "--")
+	args = append(args, progArgs...)
+	return args
+}
+
+// relaunchDescr returns a copy of descr that can be used to start a new
+// instance of delve, with the current environment. If resetArgs is set the
+// program arguments and redirects are replaced by argsAndRedirects.
+func (descr *ServerDescr) relaunchDescr(resetArgs bool, argsAndRedirects []string) (*ServerDescr, error) {
+	r := &ServerDescr{
+		buildcmd:       descr.buildcmd,
+		buildenv:       descr.buildenv,
+		buildopts:      descr.buildopts,
+		builddir:       descr.builddir,
+		exe:            descr.exe,
+		atStart:        descr.atStart,
+		debugid:        descr.debugid,
+		env:            descr.env,
+		unsetenv:       descr.unsetenv,
+		dlvargs:        descr.dlvargs,
+		tty:            descr.tty,
+		keepExecutable: descr.keepExecutable,
+	}
+	if !resetArgs {
+		return r, nil
+	}
+	args, redirects, err := parseRedirects(argsAndRedirects)
+	if err != nil {
+		return nil, err
+	}
+	opts := commandLineOptions{redirects: redirects}
+	r.dlvargs = opts.redirectArgs()
+	for i := 0; i < len(descr.dlvargs); i++ {
+		switch descr.dlvargs[i] {
+		case "-r":
+			i++
+			continue
+		case "--":
+			r.dlvargs = append(r.dlvargs, "--")
+			r.dlvargs = append(r.dlvargs, args...)
+			return r, nil
+		}
+		r.dlvargs = append(r.dlvargs, descr.dlvargs[i])
+	}
+	return nil, errors.New("can not change the arguments of this target")
+}
+
+// setenv sets the environment variable described by kv, in the form
+// "name=value", or removes it if kv does not contain '='. Removed variables
+// are also removed from the environment inherited from gdlv.
+func (descr *ServerDescr) setenv(kv string) {
+	name := kv
+	if i := strings.Index(kv, "="); i >= 0 {
+		name = kv[:i]
+	}
+	env := make([]string, 0, len(descr.env)+1)
+	for _, cur := range descr.env {
+		if !strings.HasPrefix(cur, name+"=") {
+			env = append(env, cur)
+		}
+	}
+	unsetenv := make([]string, 0, len(descr.unsetenv)+1)
+	for _, cur := range descr.unsetenv {
+		if cur != name {
+			unsetenv = append(unsetenv, cur)
+		}
+	}
+	if name != kv {
+		env = append(env, kv)
+	} else {
+		unsetenv = append(unsetenv, name)
+	}
+	descr.env = env
+	descr.unsetenv = unsetenv
+	descr.envChanged = true
+}
+
+// environ returns the environment of delve, or nil if it is the same as the
+// environment of gdlv.
+func (descr *ServerDescr) environ() []string {
+	if len(descr.env) == 0 && len(descr.unsetenv) == 0 {
+		return nil
+	}
+	r := []string{}
+	for _, kv := range os.Environ() {
+		removed := false
+		for _, name := range descr.unsetenv {
+			if strings.HasPrefix(kv, name+"=") {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			r = append(r, kv)
+		}
+	}
+	return append(r, descr.env...)
+}
+
+// readEnvFile reads environment variables from path, one per line in the
+// form "name=value". Empty lines and lines starting with '#' are ignored.
+func readEnvFile(path string) ([]string, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var env []string
+	for i, line := range strings.Split(string(buf), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		if !strings.Contains(line, "=") {
+			return nil, fmt.Errorf("%s:%d: expected name=value", path, i+1)
+		}
+		env = append(env, line)
+	}
+	return env, nil
 }
 
 func (opts *commandLineOptions) redirectArgs() []string {
@@ -277,6 +487,7 @@ func (s *ServerDescr) Start() {
 
 func (descr *ServerDescr) stdoutProcess(lenient bool) {
 	var scrollbackOut = editorWriter{true}
+	var programOut = outputWriter{scrollbackStdout}
 
 	bucket := 0
 	t0 := time.Now()
@@ -286,6 +497,8 @@ func (descr *ServerDescr) stdoutProcess(lenient bool) {
 		wnd.Lock()
 		if silenced {
 			wnd.Unlock()
+			outputPanelWrite(scrollbackStdout, text)
+			wnd.Changed()
 			return
 		}
 		wnd.Unlock()
@@ -304,7 +517,7 @@ func (descr *ServerDescr) stdoutProcess(lenient bool) {
 			bucket = 0
 			return
 		}
-		scrollbackOut.Write(text)
+		programOut.Write(text)
 		wnd.Changed()
 	}
 
@@ -341,7 +554,7 @@ func (descr *ServerDescr) stdoutProcess(lenient bool) {
 
 func (descr *ServerDescr) stderrProcess() {
 	var scrollbackOut = editorWriter{true}
-	_, err := io.Copy(&scrollbackOut, descr.stderr)
+	_, err := io.Copy(&outputWriter{scrollbackStderr}, descr.stderr)
 	if err != nil {
 		fmt.Fprintf(&scrollbackOut, "Error reading stderr: %v\n", err)
 	}
@@ -364,6 +577,9 @@ func (descr *ServerDescr) Rebuild() {
 		fmt.Fprintf(sw, "Compiling...")
 		cmd := exec.Command("go", descr.buildcmd...)
 		cmd.Dir = descr.builddir
+		if len(descr.buildenv) > 0 {
+			cmd.Env = append(os.Environ(), descr.buildenv...)
+		}
 		out, err := cmd.CombinedOutput()
 		fmt.Fprintf(sw, "done\n")
 		s := string(out)
@@ -372,6 +588,23 @@ func (descr *ServerDescr) Rebuild() {
 			s += fmt.Sprintf("\n%v\n", err)
 		}
 		io.WriteString(sw, s)
+		dir := descr.builddir
+		if dir == "" {
+			dir, _ = os.Getwd()
+		}
+		errs := parseBuildErrors(s, dir)
+		setBuildErrors(errs)
+		if len(errs) > 0 {
+			wnd.Lock()
+			c := scrollbackAppend()
+			c.Text(fmt.Sprintf("%d build errors, ", len(errs)))
+			writeLink(c, "show", func() {
+				openWindow(infoBuildErrors)
+			})
+			c.Text("\n")
+			c.End()
+			wnd.Unlock()
+		}
 	}
 	if descr.serverProcess == nil && descr.buildok {
 		lenient := false
@@ -380,7 +613,27 @@ func (descr *ServerDescr) Rebuild() {
 				lenient = true
 			}
 		}
-		cmd := exec.Command("dlv", descr.dlvargs...)
+		args := descr.dlvargs
+		if descr.tty {
+			path, err := startTerminal()
+			if err != nil {
+				descr.buildok = false
+				fmt.Fprintf(sw, "Could not allocate terminal: %v\n", err)
+				return
+			}
+			args = append([]string{"--tty", path}, args...)
+			wnd.Lock()
+			c := scrollbackAppend()
+			c.Text(fmt.Sprintf("The target will run in terminal %s, ", path))
+			writeLink(c, "show", func() {
+				openWindow(infoTerminal)
+			})
+			c.Text("\n")
+			c.End()
+			wnd.Unlock()
+		}
+		cmd := exec.Command("dlv", args...)
+		cmd.Env = descr.environ()
 		descr.stdinChan = make(chan string, 10)
 		descr.stdin, _ = cmd.StdinPipe()
 		descr.stdout, _ = cmd.StdoutPipe()
@@ -536,11 +789,13 @@ func loadProgramInfo(out io.Writer) {
 var closeOnce sync.Once
 
 func (descr *ServerDescr) Close() {
-	closeOnce.Do(func() {
-		if descr.exe != "" && RemoveExecutable {
-			os.Remove(descr.exe)
-		}
-	})
+	closeOnce.Do(descr.removeExecutable)
+}
+
+func (descr *ServerDescr) removeExecutable() {
+	if descr.exe != "" && !descr.keepExecutable {
+		os.Remove(descr.exe)
+	}
 }
 
 var testArguments = []string{"-bench", "-benchtime", "-count", "-cover", "-covermode", "-coverpkg", "-cpu", "-parallel", "-run", "-short", "-timeout", "-v", "-benchmem", "-blockprofile", "-blockprofilerate", "-coverprofile", "-cpuprofile", "-memprofile", "-memprofilerate", "-mutexprofile", "-mutexprofilefraction", "-outputdir", "-trace", "-failfast"}
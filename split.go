@@ -33,6 +33,11 @@ const (
 	infoCheckpoints     = "Checkpoints"
 	infoDeferredCalls   = "DeferredCalls"
 	infoAutoCheckpoints = "AutoCheckpoints"
+	infoTasks           = "Tasks"
+	infoBuildErrors     = "BuildErrors"
+	infoTests           = "Tests"
+	infoOutput          = "Output"
+	infoTerminal        = "Terminal"
 )
 
 type infoPanel struct {
@@ -44,7 +49,7 @@ type infoPanel struct {
 var infoNameToPanel map[string]infoPanel
 
 var infoModes = []string{
-	infoCommand, infoListing, infoDisassembly, infoGoroutines, infoStacktrace, infoLocals, infoGlobal, infoBps, infoThreads, infoRegisters, infoSources, infoFuncs, infoTypes, infoCheckpoints, infoDeferredCalls, infoAutoCheckpoints,
+	infoCommand, infoListing, infoDisassembly, infoGoroutines, infoStacktrace, infoLocals, infoGlobal, infoBps, infoThreads, infoRegisters, infoSources, infoFuncs, infoTypes, infoCheckpoints, infoDeferredCalls, infoAutoCheckpoints, infoTasks, infoBuildErrors, infoTests, infoOutput, infoTerminal,
 }
 
 var codeToInfoMode = map[byte]string{
@@ -64,6 +69,11 @@ var codeToInfoMode = map[byte]string{
 	'k': infoCheckpoints,
 	'd': infoDeferredCalls,
 	'A': infoAutoCheckpoints,
+	'K': infoTasks,
+	'E': infoBuildErrors,
+	'u': infoTests,
+	'o': infoOutput,
+	'y': infoTerminal,
 }
 
 var infoModeToCode = map[string]byte{}
@@ -87,6 +97,11 @@ func init() {
 	infoNameToPanel[infoCheckpoints] = infoPanel{updateCheckpoints, 0, &checkpointsPanel.asyncLoad}
 	infoNameToPanel[infoDeferredCalls] = infoPanel{updateDeferredCalls, 0, &stackPanel.asyncLoad}
 	infoNameToPanel[infoAutoCheckpoints] = infoPanel{updateAutoCheckpoints, 0, &autoCheckpointsPanel.asyncLoad}
+	infoNameToPanel[infoTasks] = infoPanel{updateTasks, 0, nil}
+	infoNameToPanel[infoBuildErrors] = infoPanel{updateBuildErrors, 0, nil}
+	infoNameToPanel[infoTests] = infoPanel{updateTests, 0, nil}
+	infoNameToPanel[infoOutput] = infoPanel{updateOutput, nucular.WindowNoScrollbar, nil}
+	infoNameToPanel[infoTerminal] = infoPanel{updateTerminal, nucular.WindowNoScrollbar, nil}
 
 	for k, v := range codeToInfoMode {
 		infoModeToCode[v] = k
@@ -155,10 +170,10 @@ func loadPanelDescr(in string, curDockSplit *nucular.DockSplit) (rest string) {
 		rest = loadPanelDescr(rest, right)
 		return rest
 	default:
-		m := codeToInfoMode[in[0]]
+		var m string
+		m, rest = parsePanelCode(in)
 		p := infoNameToPanel[m]
 		curDockSplit.Open(m, p.Flags(m), rect.Rect{0, 0, 500, 300}, true, p.update)
-		rest = in[1:]
 		return rest
 	}
 }
@@ -192,13 +207,38 @@ func loadFloatingDescr(rest string) {
 			}
 		}
 
-		m := codeToInfoMode[rest[0]]
+		var m string
+		m, rest = parsePanelCode(rest)
 		p := infoNameToPanel[m]
-		rest = rest[1:]
 		wnd.PopupOpen(m, p.Flags(m), rect.Rect{dim[0], dim[1], dim[2], dim[3]}, true, p.update)
 	}
 }
 
+// parsePanelCode parses the code of a panel at the start of in, returning
+// the panel name and the rest of the input. Panels registered by scripts are
+// encoded as their name surrounded by scriptPanelCode.
+func parsePanelCode(in string) (m string, rest string) {
+	if in[0] == scriptPanelCode {
+		if end := strings.IndexByte(in[1:], scriptPanelCode); end >= 0 {
+			m = in[1 : end+1]
+			getScriptPanel(m)
+			return m, in[end+2:]
+		}
+	}
+	return codeToInfoMode[in[0]], in[1:]
+}
+
+// panelCode returns the code of panel m used by serializeLayout.
+func panelCode(m string) string {
+	if c := infoModeToCode[m]; c != 0 {
+		return string(c)
+	}
+	if scriptPanels[m] != nil {
+		return fmt.Sprintf("%c%s%c", scriptPanelCode, m, scriptPanelCode)
+	}
+	return "?"
+}
+
 func cleanWindowTitle(title string) string {
 	if idx := strings.Index(title, " "); idx >= 0 {
 		title = title[:idx]
@@ -222,11 +262,7 @@ func serializeLayout() string {
 		return int(float64(x) / conf.Scaling)
 	}
 	wnd.Walk(func(_ *nucular.Window, title string, data interface{}, docked bool, size int, rect rect.Rect) {
-		title = cleanWindowTitle(title)
-		c := infoModeToCode[title]
-		if c == 0 {
-			c = '?'
-		}
+		c := panelCode(cleanWindowTitle(title))
 		if cnt == 0 {
 			fmt.Fprintf(&out, "$%d,%d$", descale(rect.W), descale(rect.H))
 		} else if docked {
@@ -240,10 +276,10 @@ func serializeLayout() string {
 				if cnt == 1 {
 					fmt.Fprintf(&out, "0")
 				}
-				fmt.Fprintf(&out, "%c", c)
+				fmt.Fprintf(&out, "%s", c)
 			}
 		} else {
-			fmt.Fprintf(&out, ",%d,%d,%d,%d%c", descale(rect.X), descale(rect.Y), descale(rect.W), descale(rect.H), c)
+			fmt.Fprintf(&out, ",%d,%d,%d,%d%s", descale(rect.X), descale(rect.Y), descale(rect.W), descale(rect.H), c)
 		}
 		cnt++
 	})
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"go.starlark.net/starlark"
 
@@ -73,6 +80,337 @@ func (s starlarkContext) LoadConfig() api.LoadConfig {
 	return getVariableLoadConfig()
 }
 
+func (s starlarkContext) SelectGoroutine(gid int64) error {
+	if client == nil || client.Running() {
+		return errors.New("target is running")
+	}
+	state, err := client.SwitchGoroutine(gid)
+	if err != nil {
+		return err
+	}
+	refreshState(refreshToFrameZero, clearGoroutineSwitch, state)
+	return nil
+}
+
+func (s starlarkContext) SelectFrame(frame int) error {
+	if client == nil || client.Running() {
+		return errors.New("target is running")
+	}
+	wnd.Lock()
+	if frame < 0 || (stackPanel.asyncLoad.loaded && frame >= len(stackPanel.stack)) {
+		wnd.Unlock()
+		return fmt.Errorf("frame %d out of range", frame)
+	}
+	curFrame = frame
+	stackPanel.deferID++
+	curDeferredCall = 0
+	wnd.Unlock()
+	refreshState(refreshToSameFrame, clearFrameSwitch, nil)
+	return nil
+}
+
+func (s starlarkContext) ListingPosition() (string, int) {
+	wnd.Lock()
+	defer wnd.Unlock()
+	if listingPanel.pinnedLoc != nil {
+		return listingPanel.pinnedLoc.File, listingPanel.pinnedLoc.Line
+	}
+	for _, line := range listingPanel.listing {
+		if line.pc {
+			return listingPanel.file, line.lineno
+		}
+	}
+	return listingPanel.file, 0
+}
+
+func (s starlarkContext) ShowLocation(file string, line int) {
+	wnd.Lock()
+	listingPanel.pinnedLoc = &api.Location{File: file, Line: line}
+	wnd.Unlock()
+	refreshState(refreshToSameFrame, clearNothing, nil)
+}
+
+func (s starlarkContext) Selection() (listing, variables string) {
+	wnd.Lock()
+	defer wnd.Unlock()
+	if ed := perFrameRichTextSelected; ed != nil && ed.Sel.S != ed.Sel.E {
+		variables = ed.Get(ed.Sel)
+	}
+	return listingSelectedText(), variables
+}
+
+func (s starlarkContext) OpenWindow(name string) error {
+	return windowCommand(nil, name)
+}
+
+func (s starlarkContext) CloseWindow(name string) error {
+	if _, ok := infoNameToPanel[name]; !ok {
+		return fmt.Errorf("unknown window kind %q", name)
+	}
+	wnd.Lock()
+	defer wnd.Unlock()
+	w := findWindow(name)
+	if w == nil {
+		return fmt.Errorf("window %q is not open", name)
+	}
+	w.Close()
+	wnd.Changed()
+	return nil
+}
+
+func (s starlarkContext) LoadLayout(name string) error {
+	ld, ok := conf.Layouts[name]
+	if !ok {
+		return fmt.Errorf("unknown layout %q", name)
+	}
+	loadPanelDescrToplevel(ld.Layout)
+	wnd.Changed()
+	return nil
+}
+
+func (s starlarkContext) Expressions() []string {
+	wnd.Lock()
+	defer wnd.Unlock()
+	r := make([]string, len(localsPanel.expressions))
+	for i := range localsPanel.expressions {
+		r[i] = localsPanel.expressions[i].Expr
+	}
+	return r
+}
+
+func (s starlarkContext) AddExpression(expr string) {
+	addExpression(expr, false)
+	wnd.Changed()
+}
+
+func (s starlarkContext) RemoveExpression(expr string) error {
+	wnd.Lock()
+	defer wnd.Unlock()
+	for i := range localsPanel.expressions {
+		if localsPanel.expressions[i].Expr == expr {
+			removeExpression(i)
+			wnd.Changed()
+			return nil
+		}
+	}
+	return fmt.Errorf("expression %q not found", expr)
+}
+
+func (s starlarkContext) PrintLink(text, file string, line int) {
+	wnd.Lock()
+	defer wnd.Unlock()
+	defer wnd.Changed()
+	c := scrollbackAppend()
+	defer c.End()
+	writeLink(c, text, func() {
+		listingPanel.pinnedLoc = &api.Location{File: file, Line: line}
+		go refreshState(refreshToSameFrame, clearNothing, nil)
+	})
+	c.Text("\n")
+}
+
+func (s starlarkContext) PrintVar(sv starlark.Value) {
+	v := wrapApiVariableSimple(convertStarlarkToVariable("", sv))
+
+	wnd.Lock()
+	defer wnd.Unlock()
+	defer wnd.Changed()
+	c := scrollbackAppend()
+	defer c.End()
+	if v.Name != "" {
+		c.Text(v.Name + " = ")
+	}
+	valstr := v.SinglelineString(true, false)
+	if len(v.Children) == 0 {
+		c.Text(valstr + "\n")
+		return
+	}
+	c.Expandable(valstr, func() string {
+		return v.MultilineString("", nil)
+	})
+	c.Text("\n")
+}
+
+var (
+	// stopHooks records whether callStopHooks is running and the last stop
+	// that happened while it was running (because a hook resumed the target).
+	stopHooks struct {
+		sync.Mutex
+		running bool
+		pending *api.DebuggerState
+	}
+	exitHookDone int32
+)
+
+// callHook calls the starlark hook function name, if one was defined, and
+// returns its return value.
+func callHook(name string, args ...interface{}) starlark.Value {
+	if !StarlarkEnv.HasHook(name) {
+		return starlark.None
+	}
+	out := editorWriter{true}
+	v, err := StarlarkEnv.CallHook(&out, name, args...)
+	if err != nil {
+		fmt.Fprintf(&out, "Error executing %s: %v\n", name, err)
+		return starlark.None
+	}
+	return v
+}
+
+// callStopHooks evaluates the starlark conditions of the breakpoints that
+// stopped the target and calls the on_stop and on_breakpoint hooks for
+// state. If the conditions are false or either hook returns True the target
+// is continued and everything is repeated on the next stop.
+// If a hook resumes the target the stop where it stopped again replaces
+// state.
+func callStopHooks(state *api.DebuggerState) {
+	if client == nil {
+		return
+	}
+	starlarkCondsMu.Lock()
+	hasConds := len(starlarkConds) > 0
+	starlarkCondsMu.Unlock()
+	if !hasConds && !StarlarkEnv.HasHook(starbind.OnStopHook) && !StarlarkEnv.HasHook(starbind.OnBreakpointHook) {
+		return
+	}
+	stopHooks.Lock()
+	if stopHooks.running {
+		// called for a stop caused by a hook (or by the loop below), the
+		// loop below will take care of it
+		stopHooks.pending = state
+		stopHooks.Unlock()
+		return
+	}
+	stopHooks.running = true
+	stopHooks.Unlock()
+
+	out := editorWriter{true}
+
+	for {
+		cont := false
+		if state != nil && state.Err == nil && !state.Exited && !state.Running {
+			cont = !evalStarlarkConds(state)
+			if !cont {
+				cont = callHook(starbind.OnStopHook, state) == starlark.True
+				for _, th := range state.Threads {
+					if th.Breakpoint == nil {
+						continue
+					}
+					if callHook(starbind.OnBreakpointHook, th.Breakpoint, threadGoroutine(state, th)) == starlark.True {
+						cont = true
+					}
+				}
+			}
+		}
+
+		stopHooks.Lock()
+		if stopHooks.pending != nil {
+			// a hook resumed the target, the new stop replaces this one
+			state, stopHooks.pending = stopHooks.pending, nil
+			stopHooks.Unlock()
+			continue
+		}
+		if !cont {
+			stopHooks.running = false
+			stopHooks.Unlock()
+			return
+		}
+		stopHooks.Unlock()
+
+		for state = range client.Continue() {
+			if state.Err != nil {
+				break
+			}
+			printcontext(&out, state)
+		}
+		refreshState(refreshToFrameZero, clearStop, state)
+
+		// refreshState recorded state as pending
+		stopHooks.Lock()
+		stopHooks.pending = nil
+		stopHooks.Unlock()
+	}
+}
+
+// evalStarlarkConds evaluates the starlark conditions of the breakpoints
+// that stopped the threads in state, it returns false if the stop should
+// be ignored because every thread stopped at a breakpoint has a starlark
+// condition that evaluated to false.
+// Each condition is evaluated in the scope of the goroutine stopped at the
+// breakpoint, the result is remembered so that the conditions are evaluated
+// only once for each stop.
+func evalStarlarkConds(state *api.DebuggerState) bool {
+	starlarkCondResult.Lock()
+	defer starlarkCondResult.Unlock()
+	if starlarkCondResult.state == state {
+		return starlarkCondResult.result
+	}
+	r := evalStarlarkCondsIntl(state)
+	starlarkCondResult.state, starlarkCondResult.result = state, r
+	return r
+}
+
+var starlarkCondResult struct {
+	sync.Mutex
+	state  *api.DebuggerState
+	result bool
+}
+
+func evalStarlarkCondsIntl(state *api.DebuggerState) bool {
+	if state.CurrentThread == nil || state.CurrentThread.Breakpoint == nil {
+		return true
+	}
+	ignore := false
+	for _, th := range state.Threads {
+		if th.Breakpoint == nil || th.Breakpoint.Tracepoint || th.Breakpoint.TraceReturn {
+			continue
+		}
+		cond := starlarkCond(th.Breakpoint.ID)
+		if cond == "" || evalStarlarkCond(th, cond) {
+			return true
+		}
+		ignore = true
+	}
+	return !ignore
+}
+
+// evalStarlarkCond evaluates the starlark condition cond of the breakpoint
+// where thread th stopped, using the goroutine running on th as the scope.
+func evalStarlarkCond(th *api.Thread, cond string) bool {
+	out := editorWriter{true}
+	v, err := StarlarkEnv.EvalCondition(&out, cond, api.EvalScope{GoroutineID: th.GoroutineID})
+	if err != nil {
+		fmt.Fprintf(&out, "Error evaluating condition of breakpoint %d: %v\n", th.Breakpoint.ID, err)
+		return true
+	}
+	return bool(v.Truth())
+}
+
+// threadGoroutine returns the goroutine running on thread th.
+func threadGoroutine(state *api.DebuggerState, th *api.Thread) *api.Goroutine {
+	if th.BreakpointInfo != nil && th.BreakpointInfo.Goroutine != nil {
+		return th.BreakpointInfo.Goroutine
+	}
+	if state.SelectedGoroutine != nil && state.SelectedGoroutine.ID == th.GoroutineID {
+		return state.SelectedGoroutine
+	}
+	loc := api.Location{PC: th.PC, File: th.File, Line: th.Line, Function: th.Function}
+	return &api.Goroutine{ID: th.GoroutineID, ThreadID: th.ID, CurrentLoc: loc, UserCurrentLoc: loc}
+}
+
+// callExitHook calls the on_exit hook, once, if err reports that the target
+// process exited.
+func callExitHook(err error) {
+	const exitedWithStatus = " has exited with status "
+	msg := err.Error()
+	idx := strings.Index(msg, exitedWithStatus)
+	if idx < 0 || !atomic.CompareAndSwapInt32(&exitHookDone, 0, 1) {
+		return
+	}
+	status, _ := strconv.Atoi(strings.Fields(msg[idx+len(exitedWithStatus):] + " ")[0])
+	callHook(starbind.OnExitHook, status)
+}
+
 const defaultInitFile = `
 def command_find_array(arr, pred):
 	"""Calls pred for each element of the array or slice 'arr' returns the index of
@@ -132,33 +470,64 @@ def command_flaky(args):
 
 func executeInit() {
 	scrollbackOut := editorWriter{true}
+
+	scriptDirs := []string{scriptsDir(), filepath.Join(projectDir(), "scripts")}
+
+	scriptPath := make([]string, 0, len(conf.ScriptPath)+len(scriptDirs))
+	for _, dir := range conf.ScriptPath {
+		scriptPath = append(scriptPath, expandTilde(dir))
+	}
+	scriptPath = append(scriptPath, scriptDirs...)
+	StarlarkEnv.SetScriptPath(scriptPath)
+
+	executeInitFile(&scrollbackOut)
+
+	for i, dir := range scriptDirs {
+		scripts, _ := filepath.Glob(filepath.Join(dir, "*.star"))
+		sort.Strings(scripts)
+		if i == len(scriptDirs)-1 && len(scripts) > 0 {
+			fmt.Fprintf(&scrollbackOut, "Executing %d project scripts found in %s\n", len(scripts), dir)
+		}
+		for _, script := range scripts {
+			fmt.Fprintf(&scrollbackOut, "Loading script %q...", script)
+			_, err := StarlarkEnv.Execute(&scrollbackOut, script, nil, "main", nil, nil)
+			if err != nil {
+				fmt.Fprintf(&scrollbackOut, "\n%v\n", err)
+				continue
+			}
+			fmt.Fprintf(&scrollbackOut, "done\n")
+		}
+	}
+}
+
+func executeInitFile(scrollbackOut io.Writer) {
 	initPath := configLoc() + ".star"
-	fmt.Fprintf(&scrollbackOut, "Loading init file %q...", initPath)
+	fmt.Fprintf(scrollbackOut, "Loading init file %q...", initPath)
 	fh, err := os.Open(initPath)
 	if err != nil {
 		if !os.IsNotExist(err) {
-			fmt.Fprintf(&scrollbackOut, "could not read init file: %q: %v", initPath, err)
+			fmt.Fprintf(scrollbackOut, "could not read init file: %q: %v", initPath, err)
 			return
 		}
 
 		err := ioutil.WriteFile(initPath, []byte(defaultInitFile), 0660)
 		if err != nil {
-			fmt.Fprintf(&scrollbackOut, "could not create init file: %q: %v\n", initPath, err)
+			fmt.Fprintf(scrollbackOut, "could not create init file: %q: %v\n", initPath, err)
 			return
 		}
 
 		fh, err = os.Open(initPath)
 		if err != nil {
-			fmt.Fprintf(&scrollbackOut, "could not read init file: %q: %v\n", initPath, err)
+			fmt.Fprintf(scrollbackOut, "could not read init file: %q: %v\n", initPath, err)
 			return
 		}
 	}
 	fh.Close()
 
-	_, err = StarlarkEnv.Execute(&scrollbackOut, initPath, nil, "main", nil, nil)
+	_, err = StarlarkEnv.Execute(scrollbackOut, initPath, nil, "main", nil, nil)
 	if err != nil {
-		fmt.Fprintf(&scrollbackOut, "\n%v\n", err)
+		fmt.Fprintf(scrollbackOut, "\n%v\n", err)
 		return
 	}
-	fmt.Fprintf(&scrollbackOut, "done\n")
+	fmt.Fprintf(scrollbackOut, "done\n")
 }
@@ -0,0 +1,775 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/aarzilli/nucular"
+	"github.com/aarzilli/nucular/rect"
+	nstyle "github.com/aarzilli/nucular/style"
+
+	"golang.org/x/mobile/event/key"
+)
+
+const (
+	termHistoryLines = 1000
+	termMaxPending   = 4096 // maximum length of an incomplete escape sequence
+)
+
+// termCell is a character cell of the terminal emulator.
+type termCell struct {
+	ch rune
+	ansiState
+}
+
+type termCursor struct {
+	x, y int
+	st   ansiState
+}
+
+// termScreen is the state of a VT100/xterm compatible terminal emulator.
+type termScreen struct {
+	cols, rows int
+	lines      [][]termCell
+	history    [][]termCell // lines scrolled off the top of the main screen
+	main       [][]termCell // main screen while the alternate screen is shown
+	st         ansiState
+	cx, cy     int
+	wrap       bool // the next character goes to the next line
+	top, bot   int  // scroll region, inclusive
+	saved      termCursor
+	hideCursor bool
+	appCursor  bool   // application cursor keys mode
+	pending    []byte // incomplete escape or UTF-8 sequence
+	reply      []byte // answers to queries, to be written to the terminal
+}
+
+func newTermScreen(cols, rows int) *termScreen {
+	s := &termScreen{cols: cols, rows: rows, bot: rows - 1}
+	s.lines = s.blankScreen()
+	return s
+}
+
+func (s *termScreen) blankLine() []termCell {
+	line := make([]termCell, s.cols)
+	for i := range line {
+		line[i] = termCell{ch: ' ', ansiState: ansiState{bg: s.st.bg}}
+	}
+	return line
+}
+
+func (s *termScreen) blankScreen() [][]termCell {
+	lines := make([][]termCell, s.rows)
+	for i := range lines {
+		lines[i] = s.blankLine()
+	}
+	return lines
+}
+
+// resize changes the size of the screen, lines that don't fit are moved to
+// the history.
+func (s *termScreen) resize(cols, rows int) {
+	if cols < 1 || rows < 1 || (cols == s.cols && rows == s.rows) {
+		return
+	}
+	resizeLines := func(lines [][]termCell, cy int) ([][]termCell, int) {
+		if excess := len(lines) - rows; excess > 0 {
+			// drop the lines below the cursor first
+			below := len(lines) - 1 - cy
+			if below > excess {
+				below = excess
+			}
+			lines = lines[:len(lines)-below]
+			excess -= below
+			if excess > 0 {
+				s.addHistory(lines[:excess]...)
+				lines = lines[excess:]
+				cy -= excess
+			}
+		}
+		for i := range lines {
+			line := lines[i]
+			if len(line) > cols {
+				line = line[:cols]
+			}
+			for len(line) < cols {
+				line = append(line, termCell{ch: ' '})
+			}
+			lines[i] = line
+		}
+		for len(lines) < rows {
+			line := make([]termCell, cols)
+			for i := range line {
+				line[i].ch = ' '
+			}
+			lines = append(lines, line)
+		}
+		return lines, cy
+	}
+	if s.main != nil {
+		s.main, _ = resizeLines(s.main, s.rows-1)
+	}
+	s.lines, s.cy = resizeLines(s.lines, s.cy)
+	s.cols, s.rows = cols, rows
+	s.top, s.bot = 0, rows-1
+	s.cx, s.cy = clampInt(s.cx, 0, cols-1), clampInt(s.cy, 0, rows-1)
+	s.wrap = false
+}
+
+func (s *termScreen) addHistory(lines ...[]termCell) {
+	if s.main != nil {
+		return
+	}
+	s.history = append(s.history, lines...)
+	if n := len(s.history) - termHistoryLines; n > 0 {
+		s.history = append(s.history[:0], s.history[n:]...)
+	}
+}
+
+// Write interprets b as output of the program running in the terminal.
+func (s *termScreen) Write(b []byte) (int, error) {
+	n := len(b)
+	if len(s.pending) > 0 {
+		b = append(s.pending, b...)
+		s.pending = nil
+	}
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c == 0x1b:
+			l := s.escape(b[i:])
+			if l == 0 {
+				if len(b)-i < termMaxPending {
+					s.pending = append([]byte(nil), b[i:]...)
+					return n, nil
+				}
+				// runaway sequence, drop the escape character
+				l = 1
+			}
+			i += l
+		case c < 0x20 || c == 0x7f:
+			s.control(c)
+			i++
+		default:
+			if !utf8.FullRune(b[i:]) {
+				s.pending = append([]byte(nil), b[i:]...)
+				return n, nil
+			}
+			r, sz := utf8.DecodeRune(b[i:])
+			s.put(r)
+			i += sz
+		}
+	}
+	return n, nil
+}
+
+func (s *termScreen) control(c byte) {
+	switch c {
+	case '\r':
+		s.cx = 0
+		s.wrap = false
+	case '\n', 0x0b, 0x0c:
+		s.index()
+	case '\b':
+		if s.cx > 0 {
+			s.cx--
+		}
+		s.wrap = false
+	case '\t':
+		s.cx = clampInt((s.cx/8+1)*8, 0, s.cols-1)
+	}
+}
+
+func (s *termScreen) put(r rune) {
+	if s.wrap {
+		s.cx = 0
+		s.index()
+	}
+	s.lines[s.cy][s.cx] = termCell{ch: r, ansiState: s.st}
+	if s.cx == s.cols-1 {
+		s.wrap = true
+	} else {
+		s.cx++
+	}
+}
+
+// index moves the cursor down one line, scrolling if it is at the bottom of
+// the scroll region.
+func (s *termScreen) index() {
+	s.wrap = false
+	switch {
+	case s.cy == s.bot:
+		s.scrollUp(s.top, 1)
+	case s.cy < s.rows-1:
+		s.cy++
+	}
+}
+
+func (s *termScreen) reverseIndex() {
+	s.wrap = false
+	switch {
+	case s.cy == s.top:
+		s.scrollDown(s.top, 1)
+	case s.cy > 0:
+		s.cy--
+	}
+}
+
+// scrollUp scrolls the lines between top and the bottom of the scroll
+// region up by n lines.
+func (s *termScreen) scrollUp(top, n int) {
+	n = clampInt(n, 0, s.bot-top+1)
+	if top == 0 && s.bot == s.rows-1 {
+		s.addHistory(s.lines[:n]...)
+	}
+	copy(s.lines[top:s.bot+1], s.lines[top+n:s.bot+1])
+	for i := s.bot - n + 1; i <= s.bot; i++ {
+		s.lines[i] = s.blankLine()
+	}
+}
+
+// scrollDown scrolls the lines between top and the bottom of the scroll
+// region down by n lines.
+func (s *termScreen) scrollDown(top, n int) {
+	n = clampInt(n, 0, s.bot-top+1)
+	copy(s.lines[top+n:s.bot+1], s.lines[top:s.bot+1-n])
+	for i := top; i < top+n; i++ {
+		s.lines[i] = s.blankLine()
+	}
+}
+
+// erase blanks the cells from x0 to x1 (excluded) of line y.
+func (s *termScreen) erase(y, x0, x1 int) {
+	x0, x1 = clampInt(x0, 0, s.cols), clampInt(x1, 0, s.cols)
+	for x := x0; x < x1; x++ {
+		s.lines[y][x] = termCell{ch: ' ', ansiState: ansiState{bg: s.st.bg}}
+	}
+}
+
+// escape interprets the escape sequence at the start of b and returns its
+// length, or 0 if the sequence is incomplete.
+func (s *termScreen) escape(b []byte) int {
+	if len(b) < 2 {
+		return 0
+	}
+	switch b[1] {
+	case '[':
+		j := 2
+		for j < len(b) && (b[j] < 0x40 || b[j] > 0x7e) {
+			j++
+		}
+		if j >= len(b) {
+			return 0
+		}
+		s.csi(string(b[2:j]), b[j])
+		return j + 1
+	case ']', 'P', '_', '^':
+		// OSC, DCS, APC and PM strings are ignored
+		for j := 2; j < len(b); j++ {
+			if b[j] == 0x07 {
+				return j + 1
+			}
+			if b[j] == 0x1b && j+1 < len(b) && b[j+1] == '\\' {
+				return j + 2
+			}
+		}
+		return 0
+	case '(', ')', '*', '+', '#', '%':
+		// character set selection
+		if len(b) < 3 {
+			return 0
+		}
+		return 3
+	case '7':
+		s.saved = termCursor{s.cx, s.cy, s.st}
+	case '8':
+		s.restoreCursor()
+	case 'D':
+		s.index()
+	case 'E':
+		s.cx = 0
+		s.index()
+	case 'M':
+		s.reverseIndex()
+	case 'c':
+		history := s.history
+		*s = *newTermScreen(s.cols, s.rows)
+		s.history = history
+	}
+	return 2
+}
+
+func (s *termScreen) restoreCursor() {
+	s.cx, s.cy, s.st = clampInt(s.saved.x, 0, s.cols-1), clampInt(s.saved.y, 0, s.rows-1), s.saved.st
+	s.wrap = false
+}
+
+// maxCSIParam is the maximum value of a parameter of a control sequence,
+// larger values are truncated.
+const maxCSIParam = 1<<16 - 1
+
+// csi interprets a control sequence with the specified parameters and final
+// byte.
+func (s *termScreen) csi(params string, final byte) {
+	var prefix byte
+	if len(params) > 0 && params[0] >= '<' && params[0] <= '?' {
+		prefix = params[0]
+		params = params[1:]
+	}
+	var args []int
+	if params != "" {
+		for _, p := range strings.Split(params, ";") {
+			n, err := strconv.Atoi(p)
+			if err != nil || n < 0 {
+				// use the default value for negative or malformed parameters
+				n = 0
+			}
+			args = append(args, clampInt(n, 0, maxCSIParam))
+		}
+	}
+	arg := func(i, def int) int {
+		if i < len(args) && args[i] != 0 {
+			return args[i]
+		}
+		return def
+	}
+
+	if prefix == '?' {
+		if final == 'h' || final == 'l' {
+			for _, mode := range args {
+				s.setMode(mode, final == 'h')
+			}
+		}
+		return
+	}
+	if prefix != 0 {
+		return
+	}
+
+	switch final {
+	case 'A':
+		s.cy = clampInt(s.cy-arg(0, 1), 0, s.rows-1)
+	case 'B':
+		s.cy = clampInt(s.cy+arg(0, 1), 0, s.rows-1)
+	case 'C':
+		s.cx = clampInt(s.cx+arg(0, 1), 0, s.cols-1)
+	case 'D':
+		s.cx = clampInt(s.cx-arg(0, 1), 0, s.cols-1)
+	case 'E':
+		s.cx, s.cy = 0, clampInt(s.cy+arg(0, 1), 0, s.rows-1)
+	case 'F':
+		s.cx, s.cy = 0, clampInt(s.cy-arg(0, 1), 0, s.rows-1)
+	case 'G', '`':
+		s.cx = clampInt(arg(0, 1)-1, 0, s.cols-1)
+	case 'd':
+		s.cy = clampInt(arg(0, 1)-1, 0, s.rows-1)
+	case 'H', 'f':
+		s.cy, s.cx = clampInt(arg(0, 1)-1, 0, s.rows-1), clampInt(arg(1, 1)-1, 0, s.cols-1)
+	case 'J':
+		switch arg(0, 0) {
+		case 0:
+			s.erase(s.cy, s.cx, s.cols)
+			for y := s.cy + 1; y < s.rows; y++ {
+				s.erase(y, 0, s.cols)
+			}
+		case 1:
+			for y := 0; y < s.cy; y++ {
+				s.erase(y, 0, s.cols)
+			}
+			s.erase(s.cy, 0, s.cx+1)
+		case 3:
+			s.history = nil
+			fallthrough
+		case 2:
+			for y := 0; y < s.rows; y++ {
+				s.erase(y, 0, s.cols)
+			}
+		}
+	case 'K':
+		switch arg(0, 0) {
+		case 0:
+			s.erase(s.cy, s.cx, s.cols)
+		case 1:
+			s.erase(s.cy, 0, s.cx+1)
+		case 2:
+			s.erase(s.cy, 0, s.cols)
+		}
+	case 'L':
+		if s.cy >= s.top && s.cy <= s.bot {
+			s.scrollDown(s.cy, arg(0, 1))
+			s.cx = 0
+		}
+	case 'M':
+		if s.cy >= s.top && s.cy <= s.bot {
+			bot := s.bot
+			n := clampInt(arg(0, 1), 0, bot-s.cy+1)
+			copy(s.lines[s.cy:bot+1], s.lines[s.cy+n:bot+1])
+			for i := bot - n + 1; i <= bot; i++ {
+				s.lines[i] = s.blankLine()
+			}
+			s.cx = 0
+		}
+	case 'P':
+		line := s.lines[s.cy]
+		n := clampInt(arg(0, 1), 0, s.cols-s.cx)
+		copy(line[s.cx:], line[s.cx+n:])
+		s.erase(s.cy, s.cols-n, s.cols)
+	case '@':
+		line := s.lines[s.cy]
+		n := clampInt(arg(0, 1), 0, s.cols-s.cx)
+		copy(line[s.cx+n:], line[s.cx:])
+		s.erase(s.cy, s.cx, s.cx+n)
+	case 'X':
+		s.erase(s.cy, s.cx, s.cx+arg(0, 1))
+	case 'S':
+		s.scrollUp(s.top, arg(0, 1))
+	case 'T':
+		s.scrollDown(s.top, arg(0, 1))
+	case 'm':
+		s.st.apply(params)
+	case 'r':
+		top, bot := arg(0, 1)-1, arg(1, s.rows)-1
+		if top >= 0 && top < bot && bot < s.rows {
+			s.top, s.bot = top, bot
+			s.cx, s.cy = 0, 0
+		}
+	case 's':
+		s.saved = termCursor{s.cx, s.cy, s.st}
+	case 'u':
+		s.restoreCursor()
+	case 'n':
+		switch arg(0, 0) {
+		case 5:
+			s.reply = append(s.reply, "\x1b[0n"...)
+		case 6:
+			s.reply = append(s.reply, fmt.Sprintf("\x1b[%d;%dR", s.cy+1, s.cx+1)...)
+		}
+	case 'c':
+		s.reply = append(s.reply, "\x1b[?1;2c"...)
+	}
+	if final != 'm' && final != 'n' && final != 'c' {
+		s.wrap = false
+	}
+}
+
+// setMode sets or resets a DEC private mode.
+func (s *termScreen) setMode(mode int, set bool) {
+	switch mode {
+	case 1:
+		s.appCursor = set
+	case 25:
+		s.hideCursor = !set
+	case 47, 1047, 1049:
+		if set == (s.main != nil) {
+			return
+		}
+		if set {
+			if mode == 1049 {
+				s.saved = termCursor{s.cx, s.cy, s.st}
+			}
+			s.main = s.lines
+			s.lines = s.blankScreen()
+		} else {
+			s.lines = s.main
+			s.main = nil
+			if mode == 1049 {
+				s.restoreCursor()
+			}
+		}
+	}
+}
+
+// text returns the lines of the screen, without trailing spaces.
+func (s *termScreen) text() []string {
+	r := make([]string, len(s.lines))
+	for i, line := range s.lines {
+		r[i] = termLineString(line)
+	}
+	return r
+}
+
+func termLineString(line []termCell) string {
+	var sb strings.Builder
+	for _, c := range line {
+		sb.WriteRune(c.ch)
+	}
+	return strings.TrimRight(sb.String(), " ")
+}
+
+func clampInt(n, min, max int) int {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+var terminalPanel = struct {
+	mu     sync.Mutex
+	screen *termScreen
+	master *os.File
+	slave  *os.File // kept open so that reading master doesn't fail when the target exits
+	path   string
+	input  chan []byte
+
+	// fields below are only accessed by the UI goroutine
+
+	focused  bool // the terminal panel had keyboard focus during the previous frame
+	focusing bool // the terminal panel has keyboard focus during this frame
+	scroll   int  // number of history lines scrolled back
+}{}
+
+// startTerminal allocates the pseudo-terminal used by the target, if it
+// wasn't already allocated, and returns the path of its slave side.
+func startTerminal() (string, error) {
+	terminalPanel.mu.Lock()
+	defer terminalPanel.mu.Unlock()
+	if terminalPanel.path != "" {
+		return terminalPanel.path, nil
+	}
+	master, path, err := openPty()
+	if err != nil {
+		return "", err
+	}
+	slave, err := openPtySlave(path)
+	if err != nil {
+		master.Close()
+		return "", err
+	}
+	const cols, rows = 80, 24
+	setPtySize(master, cols, rows)
+	terminalPanel.screen = newTermScreen(cols, rows)
+	terminalPanel.master, terminalPanel.slave, terminalPanel.path = master, slave, path
+	terminalPanel.input = make(chan []byte, 64)
+	go terminalReader(master)
+	go terminalWriter(master, terminalPanel.input)
+	return path, nil
+}
+
+func terminalReader(master *os.File) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := master.Read(buf)
+		if n > 0 {
+			terminalPanel.mu.Lock()
+			terminalPanel.screen.Write(buf[:n])
+			reply := terminalPanel.screen.reply
+			terminalPanel.screen.reply = nil
+			terminalPanel.mu.Unlock()
+			if len(reply) > 0 {
+				sendTerminalInput(reply)
+			}
+			wnd.Changed()
+		}
+		if err != nil {
+			fmt.Fprintf(&editorWriter{true}, "Error reading terminal: %v\n", err)
+			return
+		}
+	}
+}
+
+func terminalWriter(master *os.File, input chan []byte) {
+	for b := range input {
+		if _, err := master.Write(b); err != nil {
+			fmt.Fprintf(&editorWriter{true}, "Error writing to terminal: %v\n", err)
+		}
+	}
+}
+
+func sendTerminalInput(b []byte) {
+	select {
+	case terminalPanel.input <- b:
+	default:
+		// the target isn't reading its input
+	}
+}
+
+// terminalKeys returns the bytes that should be sent to the terminal for
+// the keyboard input kbd.
+func terminalKeys(kbd *nucular.KeyboardInput, appCursor bool) []byte {
+	var r []byte
+	for _, e := range kbd.Keys {
+		switch {
+		case e.Modifiers == key.ModControl && e.Code >= key.CodeA && e.Code <= key.CodeZ:
+			r = append(r, byte(e.Code-key.CodeA+1))
+		case e.Modifiers == key.ModControl && e.Code == key.CodeLeftSquareBracket:
+			r = append(r, 0x1b)
+		case e.Modifiers == key.ModControl && e.Code == key.CodeBackslash:
+			r = append(r, 0x1c)
+		case e.Modifiers == key.ModControl && e.Code == key.CodeRightSquareBracket:
+			r = append(r, 0x1d)
+		case e.Modifiers == key.ModAlt && e.Code >= key.CodeA && e.Code <= key.CodeZ && e.Rune > 0:
+			r = append(r, 0x1b)
+			r = utf8.AppendRune(r, e.Rune)
+		case e.Modifiers&^key.ModShift != 0:
+			// other shortcuts are left to gdlv
+		default:
+			r = append(r, terminalKeySequence(e.Code, appCursor)...)
+		}
+	}
+	for _, ch := range kbd.Text {
+		if ch == '\n' {
+			ch = '\r'
+		}
+		r = utf8.AppendRune(r, ch)
+	}
+	return r
+}
+
+func terminalKeySequence(code key.Code, appCursor bool) string {
+	cursor := func(c byte) string {
+		if appCursor {
+			return "\x1bO" + string(c)
+		}
+		return "\x1b[" + string(c)
+	}
+	switch code {
+	case key.CodeDeleteBackspace:
+		return "\x7f"
+	case key.CodeEscape:
+		return "\x1b"
+	case key.CodeUpArrow:
+		return cursor('A')
+	case key.CodeDownArrow:
+		return cursor('B')
+	case key.CodeRightArrow:
+		return cursor('C')
+	case key.CodeLeftArrow:
+		return cursor('D')
+	case key.CodeHome:
+		return cursor('H')
+	case key.CodeEnd:
+		return cursor('F')
+	case key.CodeInsert:
+		return "\x1b[2~"
+	case key.CodeDeleteForward:
+		return "\x1b[3~"
+	case key.CodePageUp:
+		return "\x1b[5~"
+	case key.CodePageDown:
+		return "\x1b[6~"
+	}
+	return ""
+}
+
+func updateTerminal(w *nucular.Window) {
+	if w.HelpClicked {
+		showHelp(w.Master(), "Terminal Panel Help", terminalPanelHelp)
+	}
+
+	style := w.Master().Style()
+	in := w.Input()
+	focused := in == w.Master().Input()
+	terminalPanel.focusing = focused
+
+	terminalPanel.mu.Lock()
+	defer terminalPanel.mu.Unlock()
+	s := terminalPanel.screen
+
+	w.Row(20).Dynamic(1)
+	if s == nil {
+		w.Label("No terminal, start gdlv with the -tty option to run the target in a terminal", "LC")
+		return
+	}
+	w.Label(fmt.Sprintf("%s %dx%d", terminalPanel.path, s.cols, s.rows), "LC")
+
+	w.Row(0).Dynamic(1)
+	bounds, out := w.Custom(nstyle.WidgetStateInactive)
+	if out == nil {
+		return
+	}
+
+	cw := nucular.FontWidth(style.Font, "M")
+	ch := nucular.FontHeight(style.Font)
+	if cw <= 0 || ch <= 0 {
+		return
+	}
+	if cols, rows := bounds.W/cw, bounds.H/ch; cols > 0 && rows > 0 && (cols != s.cols || rows != s.rows) {
+		s.resize(cols, rows)
+		setPtySize(terminalPanel.master, cols, rows)
+	}
+
+	if focused {
+		for _, e := range in.Keyboard.Keys {
+			switch {
+			case e.Modifiers == key.ModShift && e.Code == key.CodePageUp:
+				terminalPanel.scroll += s.rows / 2
+			case e.Modifiers == key.ModShift && e.Code == key.CodePageDown:
+				terminalPanel.scroll -= s.rows / 2
+			}
+		}
+		if in.Mouse.HoveringRect(bounds) && in.Mouse.ScrollDelta != 0 {
+			terminalPanel.scroll += int(in.Mouse.ScrollDelta) * 3
+			in.Mouse.ScrollDelta = 0
+		}
+		if b := terminalKeys(&in.Keyboard, s.appCursor); len(b) > 0 {
+			terminalPanel.scroll = 0
+			sendTerminalInput(b)
+		}
+		in.Keyboard.Keys = in.Keyboard.Keys[:0]
+		in.Keyboard.Text = ""
+	}
+	terminalPanel.scroll = clampInt(terminalPanel.scroll, 0, len(s.history))
+
+	fg0, bg0 := style.Text.Color, style.NormalWindow.Background
+	history := s.history[len(s.history)-terminalPanel.scroll:]
+	for y := 0; y < s.rows; y++ {
+		var line []termCell
+		if y < len(history) {
+			line = history[y]
+		} else {
+			line = s.lines[y-len(history)]
+		}
+		for x := 0; x < len(line) && x < s.cols; {
+			st := line[x].ansiState
+			j := x
+			var sb strings.Builder
+			for j < len(line) && j < s.cols && line[j].ansiState == st {
+				sb.WriteRune(line[j].ch)
+				j++
+			}
+			fg, bg := fg0, bg0
+			if st.fg != nil {
+				fg = *st.fg
+			}
+			if st.bg != nil {
+				bg = *st.bg
+			}
+			if st.reverse {
+				fg, bg = bg, fg
+			}
+			r := rect.Rect{X: bounds.X + x*cw, Y: bounds.Y + y*ch, W: (j - x) * cw, H: ch}
+			if bg != bg0 {
+				out.FillRect(r, 0, bg)
+			}
+			if text := sb.String(); strings.TrimSpace(text) != "" {
+				face := style.Font
+				if st.bold {
+					face = boldFace
+				}
+				out.DrawText(r, text, face, fg)
+			}
+			x = j
+		}
+	}
+
+	if !s.hideCursor && terminalPanel.scroll == 0 {
+		r := rect.Rect{X: bounds.X + s.cx*cw, Y: bounds.Y + s.cy*ch, W: cw, H: ch}
+		if focused {
+			out.FillRect(r, 0, fg0)
+			if c := s.lines[s.cy][s.cx]; c.ch != ' ' {
+				out.DrawText(r, string(c.ch), style.Font, bg0)
+			}
+		} else {
+			r.Y += r.H - 2
+			r.H = 2
+			out.FillRect(r, 0, fg0)
+		}
+	}
+}
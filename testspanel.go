@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aarzilli/nucular"
+)
+
+var testsPanel = struct {
+	funcsID  int // value of funcsPanel.id when tests was computed
+	tests    []testFunc
+	selected map[string]bool
+}{funcsID: -1, selected: map[string]bool{}}
+
+// testFunc is a Test, Benchmark, Fuzz or Example function of the package
+// being tested.
+type testFunc struct {
+	Kind string // one of "Test", "Benchmark", "Fuzz" or "Example"
+	Name string
+}
+
+var testKinds = []string{"Test", "Benchmark", "Fuzz", "Example"}
+
+// closureRe matches the names of closures and range-over-func loop bodies,
+// methods with a pointer receiver and generic functions are excluded by
+// looking for '(' and '['.
+var closureRe = regexp.MustCompile(`\.func\d+(\.|$)|-range\d+`)
+
+// valueRecvRe matches the package part of the name of a method with a value
+// receiver, i.e. a package path whose last element ends with a type name.
+// Major version suffixes (as in gopkg.in/yaml.v3) are matched by versionRe
+// and are not type names.
+var (
+	valueRecvRe = regexp.MustCompile(`/[^/]*\.[\pL_][\pL\pN_]*$`)
+	versionRe   = regexp.MustCompile(`\.v\d+$`)
+)
+
+// findTestFuncs returns the test functions in the list of functions of a
+// test executable.
+func findTestFuncs(funcs []string) []testFunc {
+	var r []testFunc
+	seen := map[string]bool{}
+	for _, fn := range funcs {
+		if strings.ContainsAny(fn, "()[") {
+			continue
+		}
+		dot := strings.LastIndex(fn, ".")
+		if dot < 0 {
+			continue
+		}
+		pkg, name := fn[:dot], fn[dot+1:]
+		if name == "TestMain" {
+			continue
+		}
+		if pkg == "testing" || strings.HasPrefix(pkg, "testing/") || strings.HasPrefix(pkg, "internal/") || pkg == "main" {
+			continue
+		}
+		if closureRe.MatchString(fn) {
+			continue
+		}
+		if valueRecvRe.MatchString(pkg) && !versionRe.MatchString(pkg) {
+			continue
+		}
+		for _, kind := range testKinds {
+			if isTestName(name, kind) && !seen[name] {
+				seen[name] = true
+				r = append(r, testFunc{kind, name})
+				break
+			}
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Name < r[j].Name })
+	return r
+}
+
+// isTestName returns true if name is a valid name for a function of the
+// specified kind, i.e. kind followed either by nothing or by a character
+// that isn't a lowercase letter.
+func isTestName(name, kind string) bool {
+	if !strings.HasPrefix(name, kind) {
+		return false
+	}
+	if len(name) == len(kind) {
+		return kind != "Example"
+	}
+	r, _ := utf8.DecodeRuneInString(name[len(kind):])
+	return !unicode.IsLower(r)
+}
+
+// testArgs returns the arguments for the test executable to run the
+// selected tests.
+func testArgs(tests []testFunc, selected map[string]bool) []string {
+	var run, bench []string
+	for _, t := range tests {
+		if !selected[t.Name] {
+			continue
+		}
+		if t.Kind == "Benchmark" {
+			bench = append(bench, t.Name)
+		} else {
+			run = append(run, t.Name)
+		}
+	}
+	var args []string
+	if len(run) > 0 {
+		args = append(args, "-run", "^("+strings.Join(run, "|")+")$")
+	} else if len(bench) > 0 {
+		args = append(args, "-run", "^$")
+	}
+	if len(bench) > 0 {
+		args = append(args, "-bench", "^("+strings.Join(bench, "|")+")$")
+	}
+	return args
+}
+
+func updateTests(w *nucular.Window) {
+	if w.HelpClicked {
+		showHelp(w.Master(), "Tests Panel Help", testsPanelHelp)
+	}
+
+	if testsPanel.funcsID != funcsPanel.id {
+		testsPanel.funcsID = funcsPanel.id
+		testsPanel.tests = findTestFuncs(funcsPanel.slice)
+	}
+
+	if len(testsPanel.tests) == 0 {
+		w.Row(20).Dynamic(1)
+		w.Label("No tests found", "LC")
+		return
+	}
+
+	w.Row(20).Static(120, 120, 120)
+	if w.ButtonText("Run selected") {
+		args := testArgs(testsPanel.tests, testsPanel.selected)
+		if len(args) > 0 {
+			doCommand("restart " + strings.Join(args, " "))
+		}
+	}
+	if w.ButtonText("Run all") {
+		doCommand("restart --")
+	}
+	if w.ButtonText("Clear selection") {
+		testsPanel.selected = map[string]bool{}
+	}
+
+	for _, t := range testsPanel.tests {
+		sel := testsPanel.selected[t.Name]
+		w.Row(20).Static(0, 100)
+		if w.CheckboxText(t.Name, &sel) {
+			if sel {
+				testsPanel.selected[t.Name] = true
+			} else {
+				delete(testsPanel.selected, t.Name)
+			}
+		}
+		w.Label(t.Kind, "LC")
+	}
+}
+
+// listingTest is a test or subtest defined in the file shown by the listing
+// panel.
+type listingTest struct {
+	Pattern string // argument of -test.run selecting the test
+	BpLine  int    // first line of the body of the test
+}
+
+// findListingTests returns the tests and subtests defined in path, indexed
+// by the line where they are defined.
+func findListingTests(path string) map[int]listingTest {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, 0)
+	if err != nil {
+		return nil
+	}
+
+	r := map[int]listingTest{}
+
+	firstLine := func(body *ast.BlockStmt) int {
+		if len(body.List) > 0 {
+			return fset.Position(body.List[0].Pos()).Line
+		}
+		return fset.Position(body.Lbrace).Line
+	}
+
+	var findSubtests func(body *ast.BlockStmt, pattern string)
+	findSubtests = func(body *ast.BlockStmt, pattern string) {
+		ast.Inspect(body, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) != 2 {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || sel.Sel.Name != "Run" {
+				return true
+			}
+			lit, ok := call.Args[0].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			fn, ok := call.Args[1].(*ast.FuncLit)
+			if !ok {
+				return true
+			}
+			name, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				return true
+			}
+			subpattern := pattern + "/" + subtestPattern(name)
+			r[fset.Position(call.Pos()).Line] = listingTest{subpattern, firstLine(fn.Body)}
+			findSubtests(fn.Body, subpattern)
+			return false
+		})
+	}
+
+	for _, decl := range f.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Recv != nil || fd.Body == nil || fd.Name.Name == "TestMain" || !isTestName(fd.Name.Name, "Test") {
+			continue
+		}
+		pattern := "^" + fd.Name.Name + "$"
+		r[fset.Position(fd.Pos()).Line] = listingTest{pattern, firstLine(fd.Body)}
+		findSubtests(fd.Body, pattern)
+	}
+	return r
+}
+
+// subtestPattern returns a regular expression matching exactly the subtest
+// called name, taking into account how the testing package rewrites subtest
+// names (see rewrite in testing/match.go). Since -test.run matches each
+// level of a test name separately a name containing '/' results in a
+// pattern for each level.
+func subtestPattern(name string) string {
+	if name == "" {
+		name = "#00"
+	}
+	var buf strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsSpace(r):
+			buf.WriteByte('_')
+		case !strconv.IsPrint(r):
+			s := strconv.QuoteRune(r)
+			buf.WriteString(s[1 : len(s)-1])
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	levels := strings.Split(buf.String(), "/")
+	for i := range levels {
+		levels[i] = "^" + regexp.QuoteMeta(levels[i]) + "$"
+	}
+	return strings.Join(levels, "/")
+}
+
+// debugListingTest sets a breakpoint on the first line of t and restarts the
+// test executable so that only t is run.
+func debugListingTest(t listingTest) {
+	file := listingPanel.file
+	setbp := t.BpLine-1 < len(listingPanel.listing) && listingPanel.listing[t.BpLine-1].bp == nil
+	pattern := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(t.Pattern)
+	go func() {
+		if setbp {
+			listingSetBreakpoint(file, t.BpLine)
+		}
+		doCommand(fmt.Sprintf("restart -run '%s'", pattern))
+	}()
+}
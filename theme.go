@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	nstyle "github.com/aarzilli/nucular/style"
+)
+
+// Theme is a theme loaded from a theme definition file.
+type Theme struct {
+	Name   string
+	Base   string            // built-in theme providing sizes and the colors not specified
+	Style  map[string]string // colors of the nucular style, by field path (for example "Button.Normal.Data.Color")
+	Colors map[string]string // other colors used by gdlv
+}
+
+// themeColors are the colors used by gdlv outside of the nucular style.
+var themeColors = []struct {
+	name string
+	p    *color.RGBA
+	def  color.RGBA
+}{
+	{name: "ChangedVariable", p: &changedVariableBaseColor},
+	{name: "Link", p: &linkColor},
+	{name: "LinkHover", p: &linkHoverColor},
+	{name: "Breakpoint", p: &breakpointColor},
+	{name: "DisabledBreakpoint", p: &disabledBreakpointColor},
+	{name: "CurrentLine", p: &currentLineColor},
+	{name: "SearchMatch", p: &searchMatchColor},
+	{name: "OutputTimestamp", p: &outputTimestampColor},
+	{name: "OutputStderr", p: &outputStderrColor},
+}
+
+func init() {
+	for i := range themeColors {
+		themeColors[i].def = *themeColors[i].p
+	}
+}
+
+// themeNames returns the names of the built-in themes followed by the
+// names of the loaded themes.
+func themeNames() []string {
+	r := []string{darkTheme, whiteTheme, redTheme, boringTheme}
+	custom := []string{}
+	for name := range conf.Themes {
+		custom = append(custom, name)
+	}
+	sort.Strings(custom)
+	return append(r, custom...)
+}
+
+func isBuiltinTheme(name string) bool {
+	switch name {
+	case darkTheme, whiteTheme, redTheme, boringTheme:
+		return true
+	}
+	return false
+}
+
+// baseStyle returns the style of the built-in theme called name.
+func baseStyle(name string, scaling float64) *nstyle.Style {
+	switch name {
+	default:
+		fallthrough
+	case darkTheme:
+		return nstyle.FromTheme(nstyle.DarkTheme, scaling)
+	case whiteTheme:
+		return nstyle.FromTheme(nstyle.WhiteTheme, scaling)
+	case redTheme:
+		return nstyle.FromTheme(nstyle.RedTheme, scaling)
+	case boringTheme:
+		style := makeBoringStyle()
+		style.Scale(scaling)
+		return style
+	}
+}
+
+// themeStyle returns the style for the theme called name and sets the
+// other colors used by gdlv.
+func themeStyle(name string, scaling float64) *nstyle.Style {
+	for i := range themeColors {
+		*themeColors[i].p = themeColors[i].def
+	}
+	theme := conf.Themes[name]
+	if theme == nil {
+		return baseStyle(name, scaling)
+	}
+	style := baseStyle(theme.Base, scaling)
+	// errors were reported when the theme was loaded
+	theme.applyStyle(style)
+	theme.applyStyle(style.Unscaled())
+	for name, s := range theme.Colors {
+		if p := findThemeColor(name); p != nil {
+			if c, err := parseColor(s); err == nil {
+				*p = c
+			}
+		}
+	}
+	return style
+}
+
+func findThemeColor(name string) *color.RGBA {
+	for _, tc := range themeColors {
+		if tc.name == name {
+			return tc.p
+		}
+	}
+	return nil
+}
+
+// applyStyle sets the colors of the theme in style.
+func (theme *Theme) applyStyle(style *nstyle.Style) error {
+	props := styleColors(style)
+	for path, s := range theme.Style {
+		p := props[path]
+		if p == nil {
+			return fmt.Errorf("unknown style property %q", path)
+		}
+		c, err := parseColor(s)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		*p = c
+	}
+	return nil
+}
+
+// check returns an error if the theme has unknown or malformed colors.
+func (theme *Theme) check() error {
+	if err := theme.applyStyle(baseStyle(theme.Base, 1.0)); err != nil {
+		return err
+	}
+	for name, s := range theme.Colors {
+		if findThemeColor(name) == nil {
+			return fmt.Errorf("unknown color %q", name)
+		}
+		if _, err := parseColor(s); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// styleColors returns all the colors of style, by field path.
+func styleColors(style *nstyle.Style) map[string]*color.RGBA {
+	r := map[string]*color.RGBA{}
+	var walk func(v reflect.Value, path string)
+	walk = func(v reflect.Value, path string) {
+		if p, ok := v.Addr().Interface().(*color.RGBA); ok {
+			r[path] = p
+			return
+		}
+		if v.Kind() != reflect.Struct {
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			p := f.Name
+			if path != "" {
+				p = path + "." + f.Name
+			}
+			walk(v.Field(i), p)
+		}
+	}
+	walk(reflect.ValueOf(style).Elem(), "")
+	return r
+}
+
+// parseColor parses a color in the form #rrggbb or #rrggbbaa.
+func parseColor(s string) (color.RGBA, error) {
+	var c color.RGBA
+	c.A = 0xff
+	var err error
+	switch len(s) {
+	case 7:
+		_, err = fmt.Sscanf(s, "#%02x%02x%02x", &c.R, &c.G, &c.B)
+	case 9:
+		_, err = fmt.Sscanf(s, "#%02x%02x%02x%02x", &c.R, &c.G, &c.B, &c.A)
+	default:
+		err = fmt.Errorf("wrong length")
+	}
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("malformed color %q, must be #rrggbb or #rrggbbaa", s)
+	}
+	return c, nil
+}
+
+func formatColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
+
+// loadTheme reads a theme definition file, if the theme does not have a
+// name the name of the file is used.
+func loadTheme(path string) (*Theme, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	theme := &Theme{}
+	if err := json.Unmarshal(buf, theme); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if theme.Name == "" {
+		theme.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if isBuiltinTheme(theme.Name) {
+		return nil, fmt.Errorf("%s: theme name %q is reserved for a built-in theme", path, theme.Name)
+	}
+	if theme.Base == "" {
+		theme.Base = darkTheme
+	}
+	if !isBuiltinTheme(theme.Base) {
+		return nil, fmt.Errorf("%s: base theme %q is not a built-in theme", path, theme.Base)
+	}
+	if err := theme.check(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return theme, nil
+}
+
+// currentTheme returns a theme definition with all the colors of the
+// current theme, named name.
+func currentTheme(name string) *Theme {
+	style := themeStyle(conf.Theme, 1.0)
+	theme := &Theme{Name: name, Base: conf.Theme, Style: map[string]string{}, Colors: map[string]string{}}
+	if t := conf.Themes[conf.Theme]; t != nil {
+		theme.Base = t.Base
+	} else if !isBuiltinTheme(theme.Base) {
+		theme.Base = darkTheme
+	}
+	for path, p := range styleColors(style) {
+		theme.Style[path] = formatColor(*p)
+	}
+	for _, tc := range themeColors {
+		theme.Colors[tc.name] = formatColor(*tc.p)
+	}
+	return theme
+}
+
+// configureTheme implements 'config theme'.
+func configureTheme(out io.Writer, rest string) error {
+	const (
+		loadPrefix   = "load "
+		exportPrefix = "export "
+	)
+	switch {
+	case rest == "":
+		for _, name := range themeNames() {
+			if name == conf.Theme {
+				fmt.Fprintf(out, "* %s\n", name)
+			} else {
+				fmt.Fprintf(out, "  %s\n", name)
+			}
+		}
+		return nil
+
+	case strings.HasPrefix(rest, loadPrefix):
+		theme, err := loadTheme(expandTilde(strings.TrimSpace(rest[len(loadPrefix):])))
+		if err != nil {
+			return err
+		}
+		if conf.Themes == nil {
+			conf.Themes = make(map[string]*Theme)
+		}
+		conf.Themes[theme.Name] = theme
+		rest = theme.Name
+
+	case strings.HasPrefix(rest, exportPrefix):
+		path := expandTilde(strings.TrimSpace(rest[len(exportPrefix):]))
+		theme := currentTheme(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+		buf, err := json.MarshalIndent(theme, "", "\t")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, append(buf, '\n'), 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Theme saved to %s\n", path)
+		return nil
+	}
+
+	if !isBuiltinTheme(rest) && conf.Themes[rest] == nil {
+		return fmt.Errorf("unknown theme %q", rest)
+	}
+	conf.Theme = rest
+	setupStyle()
+	saveConfiguration()
+	return nil
+}